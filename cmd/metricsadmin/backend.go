@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ValentinaKh/go-metrics/internal/apperror"
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	"github.com/ValentinaKh/go-metrics/internal/migrator"
+	"github.com/ValentinaKh/go-metrics/internal/repository"
+	"github.com/ValentinaKh/go-metrics/internal/retry"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+	"github.com/ValentinaKh/go-metrics/migrations"
+)
+
+const (
+	dbConnectTimeout = 10 * time.Second
+	// fileRetain - при записи в файл предыдущее содержимое сохраняется как path.1
+	fileRetain = 1
+)
+
+// backend - хранилище сервера, открытое по адресу
+type backend struct {
+	service.Storage
+	name string
+	// flush сохраняет изменения: файл перезаписывается целиком, в базу они уже записаны
+	flush func() error
+	close func() error
+}
+
+// openBackend открывает хранилище по адресу: file://path или путь к файлу - файл метрик сервера
+// (FILE_STORAGE_PATH), postgres://... - база данных (DATABASE_DSN). Файл читается в память целиком
+// и, если write, перезаписывается при flush. Схема базы приводится к текущей версии, как при запуске сервера.
+func openBackend(ctx context.Context, addr string, write bool) (*backend, error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme == "" || u.Scheme == "file" {
+		return openFile(filePath(addr, u), write)
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return openDB(ctx, addr, u)
+	}
+	return nil, fmt.Errorf("unsupported backend %q: expected file://path or postgres://dsn", u.Scheme)
+}
+
+// filePath - путь из file://metrics.json (относительный), file:///var/metrics.json или просто пути
+func filePath(addr string, u *url.URL) string {
+	if u == nil || u.Scheme != "file" {
+		return addr
+	}
+	return u.Host + u.Path
+}
+
+func openFile(path string, write bool) (*backend, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file path is empty")
+	}
+	// источник должен существовать, а файл назначения создается при записи
+	if _, err := os.Stat(path); err != nil && !write {
+		return nil, err
+	}
+	mem := storage.NewMemStorage()
+	if err := service.LoadMetrics(path, mem); err != nil {
+		return nil, err
+	}
+	noop := func() error { return nil }
+	b := &backend{Storage: mem, name: "file " + path, flush: noop, close: noop}
+	if write {
+		writer, err := fileworker.NewSnapshotWriter(path, fileRetain)
+		if err != nil {
+			return nil, err
+		}
+		b.flush = func() error {
+			metrics, err := service.ExportMetrics(context.Background(), mem)
+			if err != nil {
+				return err
+			}
+			return writer.Write(metrics)
+		}
+	}
+	return b, nil
+}
+
+func openDB(ctx context.Context, dsn string, u *url.URL) (*backend, error) {
+	db := repository.MustConnectDB(dsn, repository.DBConfig{MaxOpenConns: 4})
+	if err := repository.WaitForDB(ctx, db, dbConnectTimeout); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	m, err := migrator.New(db, migrations.FS)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if _, err := m.Up(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	retrier := retry.NewRetrier(
+		retry.NewClassifierRetryPolicy(apperror.NewPostgresErrorClassifier(), 3),
+		retry.NewStaticDelayStrategy([]time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}),
+		&retry.SleepTimeProvider{})
+	return &backend{
+		Storage: repository.NewMetricsRepository(db, retrier),
+		// пароль из строки подключения в вывод не попадает
+		name:  "database " + strings.TrimPrefix(u.Redacted(), u.Scheme+"://"),
+		flush: func() error { return nil },
+		close: db.Close,
+	}, nil
+}
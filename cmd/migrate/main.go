@@ -0,0 +1,113 @@
+// Команда migrate управляет схемой базы данных сервера метрик.
+//
+//	migrate -d <dsn> up        применить все новые миграции
+//	migrate -d <dsn> down N    откатить N последних миграций
+//	migrate -d <dsn> status    показать состояние миграций
+//
+// Строка подключения также берется из переменной окружения DATABASE_DSN.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	"github.com/ValentinaKh/go-metrics/internal/migrator"
+	"github.com/ValentinaKh/go-metrics/internal/repository"
+	"github.com/ValentinaKh/go-metrics/migrations"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	dsn := flag.String("d", os.Getenv("DATABASE_DSN"), "database connection string")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-d dsn] up | down N | status\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return fmt.Errorf("command is required")
+	}
+
+	if err := logger.InitializeZapLogger("info"); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *dsn == "" {
+		return fmt.Errorf("database connection string is empty: use -d or DATABASE_DSN")
+	}
+	db := repository.MustConnectDB(*dsn, repository.DBConfig{MaxOpenConns: 1})
+	defer db.Close()
+
+	m, err := migrator.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mg := range applied {
+			fmt.Printf("applied %06d_%s\n", mg.Version, mg.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no new migrations")
+		}
+		return err
+	case "down":
+		if flag.NArg() != 2 {
+			return fmt.Errorf("usage: down N")
+		}
+		n, err := strconv.Atoi(flag.Arg(1))
+		if err != nil {
+			return fmt.Errorf("invalid number of migrations %q: %w", flag.Arg(1), err)
+		}
+		rolledBack, err := m.Down(ctx, n)
+		for _, mg := range rolledBack {
+			fmt.Printf("rolled back %06d_%s\n", mg.Version, mg.Name)
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(statuses)
+		return nil
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func printStatus(statuses []migrator.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range statuses {
+		state, at := "pending", ""
+		if s.Applied {
+			state, at = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Missing {
+			state = "applied, file missing"
+		}
+		fmt.Fprintf(w, "%06d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+	}
+	_ = w.Flush()
+}
@@ -4,9 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
-	"go/format"
 	"go/types"
 	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
 	"os"
 	"path/filepath"
 	"strings"
@@ -31,6 +31,13 @@ type (
 	}
 )
 
+// writersWithReset - writer'ы сжатия, у которых Reset принимает io.Writer. Для их сброса подставляется io.Discard.
+var writersWithReset = map[string]bool{
+	"compress/gzip.Writer":                       true,
+	"compress/zlib.Writer":                       true,
+	"github.com/klauspost/compress/zstd.Encoder": true,
+}
+
 func main() {
 	rootDir := "."
 	if len(os.Args) > 1 {
@@ -40,8 +47,9 @@ func main() {
 	fmt.Printf("Scanning for structures with '// generate:reset' comment starting from: %s\n", rootDir)
 
 	cfg := &packages.Config{
-		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
-		Dir:  rootDir,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo |
+			packages.NeedImports | packages.NeedDeps,
+		Dir: rootDir,
 	}
 
 	pkgs, err := packages.Load(cfg, "./...")
@@ -169,12 +177,13 @@ func generateResetFile(pkgDir string, structs []StructInfo) error {
 		return err
 	}
 
-	formatted, err := format.Source(buf.Bytes())
+	outputFile := filepath.Join(pkgDir, "reset.gen.go")
+	// imports.Process дополнительно добавляет импорты, нужные сгенерированному коду (например, io)
+	formatted, err := imports.Process(outputFile, buf.Bytes(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to format generated code: %v", err)
 	}
 
-	outputFile := filepath.Join(pkgDir, "reset.gen.go")
 	return os.WriteFile(outputFile, formatted, 0644)
 }
 
@@ -213,7 +222,7 @@ func generateReset(field *FieldInfo, fieldName string) string {
 		elem := ptr.Elem()
 		if named, ok := elem.(*types.Named); ok {
 			obj := named.Obj()
-			if obj.Name() == "Writer" && obj.Pkg().Path() == "compress/gzip" {
+			if obj.Pkg() != nil && writersWithReset[obj.Pkg().Path()+"."+obj.Name()] {
 				return fieldName + ".Reset(io.Discard)"
 			}
 		}
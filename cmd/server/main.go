@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -54,14 +55,31 @@ func run() {
 	shutdownCtx, cancel := context.WithCancel(context.Background())
 
 	var db *sql.DB
+	var replicas []*repository.Replica
 	if args.ConnStr != "" {
-		db = repository.MustConnectDB(args.ConnStr)
+		dbConfig := repository.DBConfig{
+			MaxOpenConns:    int(args.DBMaxOpenConns),
+			MaxIdleConns:    int(args.DBMaxIdleConns),
+			ConnMaxLifetime: time.Duration(args.DBConnMaxLifetime) * time.Second,
+			QueryTimeout:    time.Duration(args.DBQueryTimeout) * time.Millisecond,
+		}
+		db = repository.MustConnectDB(args.ConnStr, dbConfig)
+		if err := repository.WaitForDB(ctx, db, time.Duration(args.DBConnectTimeout)*time.Second); err != nil {
+			logger.Log.Fatal("База данных недоступна", zap.Error(err))
+		}
+		// реплики не ждем: пока они недоступны, чтение идет с основной базы
+		replicas = repository.MustConnectReplicas(args.DBReadDSNs, dbConfig)
 	}
-	wg, err := server.ConfigureServer(shutdownCtx, args, db)
+	wg, err := server.ConfigureServer(shutdownCtx, args, db, replicas)
 	if err != nil {
 		logger.Log.Fatal("Ошибка при запуске сервера", zap.Error(err))
 	}
 	defer func() {
+		for _, r := range replicas {
+			if err := r.DB.Close(); err != nil {
+				logger.Log.Error("Ошибка при закрытии реплики", zap.String("replica", r.Name), zap.Error(err))
+			}
+		}
 		if db != nil {
 			err := db.Close()
 			if err != nil {
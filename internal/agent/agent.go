@@ -3,16 +3,17 @@ package agent
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
 	"github.com/ValentinaKh/go-metrics/internal/crypto"
 	"sync"
 	"time"
 
 	"github.com/ValentinaKh/go-metrics/internal/apperror"
+	"github.com/ValentinaKh/go-metrics/internal/codec"
+	"github.com/ValentinaKh/go-metrics/internal/compress"
 	"github.com/ValentinaKh/go-metrics/internal/config"
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 	"github.com/ValentinaKh/go-metrics/internal/retry"
+	"github.com/ValentinaKh/go-metrics/internal/service"
 	"github.com/ValentinaKh/go-metrics/internal/service/collector"
 	"github.com/ValentinaKh/go-metrics/internal/service/provider"
 	"github.com/ValentinaKh/go-metrics/internal/service/writer"
@@ -21,11 +22,23 @@ import (
 
 // ConfigureAgent - создает и запускает агента.
 func ConfigureAgent(shutdownCtx context.Context, cfg *config.AgentArg, rCfg *config.RetryConfig, mChan chan []models.Metrics) (*sync.WaitGroup, error) {
+	c, err := codec.ByName(cfg.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	var enc compress.Encoding
+	if cfg.Compression != "" && cfg.Compression != "identity" {
+		enc, err = compress.New(cfg.Compression, cfg.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	st := storage.NewMemStorage()
-	metricPublisher, msgCh := NewMetricsPublisher(st, time.Duration(cfg.ReportInterval)*time.Second)
+	metricPublisher, msgCh := NewMetricsPublisher(st, time.Duration(cfg.ReportInterval)*time.Second, c)
 
-	var cs *crypto.CryptoService[*x509.Certificate, *rsa.PublicKey]
-	var err error
+	var cs *crypto.CryptoService
 	if cfg.CryptoKey != "" {
 		cs, err = crypto.NewPublicKeyService(cfg.CryptoKey)
 		if err != nil {
@@ -34,6 +47,15 @@ func ConfigureAgent(shutdownCtx context.Context, cfg *config.AgentArg, rCfg *con
 	}
 
 	var wg sync.WaitGroup
+	// сервер pull-режима запускается до остальных горутин: если адрес занят, агенту нечего останавливать
+	var target service.Storage = st
+	if cfg.ScrapeAddr != "" {
+		scrapeStorage := storage.NewMemStorage()
+		if err := runScrapeServer(shutdownCtx, cfg.ScrapeAddr, scrapeStorage, &wg); err != nil {
+			return nil, err
+		}
+		target = &teeStorage{Storage: st, scrape: scrapeStorage}
+	}
 	for idx := 0; idx < int(cfg.RateLimit); idx++ {
 		wg.Add(1)
 		go func() {
@@ -42,7 +64,7 @@ func ConfigureAgent(shutdownCtx context.Context, cfg *config.AgentArg, rCfg *con
 				retry.NewRetrier(
 					retry.NewClassifierRetryPolicy(apperror.NewNetworkErrorClassifier(), rCfg.MaxAttempts),
 					retry.NewStaticDelayStrategy(rCfg.Delays),
-					&retry.SleepTimeProvider{}), cfg.Key, cs), msgCh).
+					&retry.SleepTimeProvider{}), cfg.Key, cs, c.ContentType(), enc), msgCh).
 				Push(shutdownCtx)
 		}()
 	}
@@ -50,7 +72,7 @@ func ConfigureAgent(shutdownCtx context.Context, cfg *config.AgentArg, rCfg *con
 	duration := time.Duration(cfg.PollInterval)
 	runtimeCollector := collector.NewMetricCollector(provider.NewRuntimeProvider(), duration*time.Second, mChan)
 	systemCollector := collector.NewMetricCollector(provider.NewSystemProvider(), duration*time.Second, mChan)
-	w := writer.NewMetricWriter(st, mChan)
+	w := writer.NewMetricWriter(target, mChan)
 
 	//по заданию надо добавить еще одну горутину с новыми метриками
 	wg.Add(1)
@@ -2,11 +2,9 @@ package agent
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
 	"fmt"
+	"github.com/ValentinaKh/go-metrics/internal/compress"
 	"github.com/ValentinaKh/go-metrics/internal/crypto"
 	"net/url"
 
@@ -20,41 +18,52 @@ import (
 
 // HTTPSender - позволяет отправлять данные по HTTP. Имеет возможность повторной отправки в случае неудачной попытки.
 type HTTPSender struct {
-	client    *resty.Client
-	url       string
-	retrier   *retry.Retrier
-	secureKey string
-	cs        *crypto.CryptoService[*x509.Certificate, *rsa.PublicKey]
+	client      *resty.Client
+	url         string
+	retrier     *retry.Retrier
+	secureKey   string
+	cs          *crypto.CryptoService
+	contentType string
+	encoding    compress.Encoding
 }
 
 func NewPostSender(host string, retrier *retry.Retrier, secureKey string,
-	cs *crypto.CryptoService[*x509.Certificate, *rsa.PublicKey]) *HTTPSender {
-	return &HTTPSender{client: resty.New(), url: buildURL(host), retrier: retrier, secureKey: secureKey, cs: cs}
+	cs *crypto.CryptoService, contentType string, encoding compress.Encoding) *HTTPSender {
+	return &HTTPSender{client: resty.New(), url: buildURL(host), retrier: retrier, secureKey: secureKey, cs: cs,
+		contentType: contentType, encoding: encoding}
 }
 
-// Send - Отправляет сжатые по gzip, а так же подписанные, если задан ключ, SHA256 данные на сервер.
+// Send - Отправляет сжатые выбранным алгоритмом (без сжатия, если алгоритм не задан), а так же подписанные,
+// если задан ключ, SHA256 данные на сервер.
 // В случае неудачи повторяет попытку в соотвествии с настройками retrier.
 func (s *HTTPSender) Send(data []byte) error {
-	var compressedBody bytes.Buffer
-	gz := gzip.NewWriter(&compressedBody)
-	_, err := gz.Write(data)
-	if err != nil {
-		return err
-	}
-	err = gz.Close()
-	if err != nil {
-		return err
+	headers := map[string]string{"Content-Type": s.contentType}
+	compressedBody := data
+	if s.encoding != nil {
+		var buf bytes.Buffer
+		zw := s.encoding.NewWriter(&buf)
+		_, err := zw.Write(data)
+		if err != nil {
+			return err
+		}
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+		compressedBody = buf.Bytes()
+		headers["Content-Encoding"] = s.encoding.Name()
 	}
 
 	response, err := retry.DoWithRetry(context.TODO(), s.retrier, func() (*resty.Response, error) {
-		body := compressedBody.Bytes()
+		body := compressedBody
 		prep := s.client.R().
-			SetHeaders(map[string]string{"Content-Type": "application/json", "Content-Encoding": "gzip"})
+			SetHeaders(headers)
 
 		if s.secureKey != "" {
 			hash := utils.Hash(s.secureKey, body)
 			prep.SetHeader("HashSHA256", fmt.Sprintf("%x", hash))
 		}
+		var err error
 		if s.cs != nil {
 			body, err = s.cs.Transform(body)
 			if err != nil {
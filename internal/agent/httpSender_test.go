@@ -16,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/ValentinaKh/go-metrics/internal/apperror"
+	"github.com/ValentinaKh/go-metrics/internal/compress"
 	"github.com/ValentinaKh/go-metrics/internal/retry"
 )
 
@@ -29,7 +30,7 @@ func TestNewPostSender(t *testing.T) {
 		&retry.SleepTimeProvider{},
 	)
 
-	sender := NewPostSender(host, retrier, secureKey, nil)
+	sender := NewPostSender(host, retrier, secureKey, nil, "application/json", nil)
 
 	require.NotNil(t, sender)
 
@@ -80,7 +81,7 @@ func TestHTTPSender_Send_Success(t *testing.T) {
 	sender := &HTTPSender{client: resty.New(), url: server.URL, retrier: retry.NewRetrier(
 		retry.NewClassifierRetryPolicy(apperror.NewNetworkErrorClassifier(), 1),
 		retry.NewStaticDelayStrategy([]time.Duration{1}),
-		&retry.SleepTimeProvider{})}
+		&retry.SleepTimeProvider{}), contentType: "application/json", encoding: mustEncoding(t, compress.Gzip)}
 
 	err := sender.Send([]byte(expected))
 
@@ -118,12 +119,61 @@ func TestHTTPSender_Send_WithSecureKey(t *testing.T) {
 	sender := &HTTPSender{client: resty.New(), url: server.URL, retrier: retry.NewRetrier(
 		retry.NewClassifierRetryPolicy(apperror.NewNetworkErrorClassifier(), 1),
 		retry.NewStaticDelayStrategy([]time.Duration{1}),
-		&retry.SleepTimeProvider{}), secureKey: secureKey}
+		&retry.SleepTimeProvider{}), secureKey: secureKey, contentType: "application/json",
+		encoding: mustEncoding(t, compress.Gzip)}
 
 	err = sender.Send(rq)
 	require.NoError(t, err)
 }
 
+func TestHTTPSender_Send_Encodings(t *testing.T) {
+	rq := []byte(`{"id":"test","type":"gauge","value":42.0}`)
+	tests := []struct {
+		name     string
+		encoding string
+	}{
+		{name: "zstd", encoding: compress.Zstd},
+		{name: "deflate", encoding: compress.Deflate},
+		{name: "identity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var enc compress.Encoding
+			if tt.encoding != "" {
+				enc = mustEncoding(t, tt.encoding)
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tt.encoding, r.Header.Get("Content-Encoding"))
+				var body io.Reader = r.Body
+				if enc != nil {
+					zr, err := enc.NewReader(r.Body)
+					require.NoError(t, err)
+					defer zr.Close()
+					body = zr
+				}
+				data, err := io.ReadAll(body)
+				require.NoError(t, err)
+				assert.Equal(t, rq, data)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			sender := &HTTPSender{client: resty.New(), url: server.URL, retrier: retry.NewRetrier(
+				retry.NewClassifierRetryPolicy(apperror.NewNetworkErrorClassifier(), 1),
+				retry.NewStaticDelayStrategy([]time.Duration{1}),
+				&retry.SleepTimeProvider{}), contentType: "application/json", encoding: enc}
+
+			require.NoError(t, sender.Send(rq))
+		})
+	}
+}
+
+func mustEncoding(t *testing.T, name string) compress.Encoding {
+	enc, err := compress.New(name, 0)
+	require.NoError(t, err)
+	return enc
+}
+
 func TestHTTPSender_Send_InvalidURL(t *testing.T) {
 	sender := &HTTPSender{client: resty.New(), url: "://invalid-url", retrier: retry.NewRetrier(
 		retry.NewClassifierRetryPolicy(apperror.NewNetworkErrorClassifier(), 1),
@@ -2,9 +2,10 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
+	"sort"
 	"time"
 
+	"github.com/ValentinaKh/go-metrics/internal/codec"
 	"github.com/ValentinaKh/go-metrics/internal/logger"
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
@@ -12,23 +13,24 @@ import (
 // TempStorage - интерфейс для хранилища метрик
 type TempStorage interface {
 	// GetAndClear овозвращаем то, что находится в хранилище и очищаем хранилище
-	GetAndClear() map[string]*models.Metrics
+	GetAndClear() map[models.MetricKey]*models.Metrics
 }
 
 type Publisher interface {
 	Publish(ctx context.Context)
 }
 
-// MetricsPublisher - содержит используемое хранилище, а так же канал для отправки метрик
+// MetricsPublisher - содержит используемое хранилище, формат сериализации, а так же канал для отправки метрик
 type MetricsPublisher struct {
 	s              TempStorage
 	reportInterval time.Duration
+	codec          codec.Codec
 	mChan          chan []byte
 }
 
-func NewMetricsPublisher(s TempStorage, reportInterval time.Duration) (*MetricsPublisher, chan []byte) {
+func NewMetricsPublisher(s TempStorage, reportInterval time.Duration, c codec.Codec) (*MetricsPublisher, chan []byte) {
 	mChan := make(chan []byte, 10)
-	return &MetricsPublisher{s: s, reportInterval: reportInterval, mChan: mChan}, mChan
+	return &MetricsPublisher{s: s, reportInterval: reportInterval, codec: c, mChan: mChan}, mChan
 }
 
 // Publish - забирает из хранилища метрики и отправляет их в канал для последующей отправки на сервер
@@ -59,7 +61,11 @@ func (s *MetricsPublisher) send() error {
 	for _, m := range metrics {
 		request = append(request, m)
 	}
-	rs, err := json.Marshal(request)
+	// порядок обхода map случаен, сортируем, чтобы тело запроса было детерминированным
+	sort.Slice(request, func(i, j int) bool {
+		return request[i].Key().Less(request[j].Key())
+	})
+	rs, err := s.codec.Marshal(request)
 	if err != nil {
 		return err
 	}
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/ValentinaKh/go-metrics/internal/codec"
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
 
@@ -15,9 +16,9 @@ type MockTempStorage struct {
 	mock.Mock
 }
 
-func (m *MockTempStorage) GetAndClear() map[string]*models.Metrics {
+func (m *MockTempStorage) GetAndClear() map[models.MetricKey]*models.Metrics {
 	args := m.Called()
-	return args.Get(0).(map[string]*models.Metrics)
+	return args.Get(0).(map[models.MetricKey]*models.Metrics)
 }
 
 // Вспомогательная функция для создания тестовой метрики
@@ -33,17 +34,17 @@ func TestMetricsPublisher_Publish_SendsMetricsOnTick(t *testing.T) {
 	mockStorage := new(MockTempStorage)
 	interval := 100 * time.Millisecond
 
-	publisher, outChan := NewMetricsPublisher(mockStorage, interval)
+	publisher, outChan := NewMetricsPublisher(mockStorage, interval, codec.JSON)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	metrics := map[string]*models.Metrics{
-		"metric1": newGauge("metric1", 123.45),
-		"metric2": newGauge("metric2", 678.90),
+	metrics := map[models.MetricKey]*models.Metrics{
+		{MType: models.Gauge, ID: "metric1"}: newGauge("metric1", 123.45),
+		{MType: models.Gauge, ID: "metric2"}: newGauge("metric2", 678.90),
 	}
 
 	mockStorage.On("GetAndClear").Return(metrics).Once()
-	mockStorage.On("GetAndClear").Return(map[string]*models.Metrics{}).Maybe()
+	mockStorage.On("GetAndClear").Return(map[models.MetricKey]*models.Metrics{}).Maybe()
 
 	go publisher.Publish(ctx)
 
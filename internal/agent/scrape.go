@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+)
+
+// ScrapeSource - источник метрик для pull-режима
+type ScrapeSource interface {
+	GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error)
+}
+
+// teeStorage пишет метрики в буфер отправки и в хранилище для pull-режима. Буфер отправки очищается
+// после каждой отправки, а хранилище pull-режима - никогда, поэтому счетчики в нем накапливаются
+// с момента запуска агента, как ожидает Prometheus.
+type teeStorage struct {
+	service.Storage
+	scrape service.Storage
+}
+
+func (t *teeStorage) UpdateMetric(ctx context.Context, value models.Metrics) error {
+	if err := t.Storage.UpdateMetric(ctx, value); err != nil {
+		return err
+	}
+	return t.scrape.UpdateMetric(ctx, value)
+}
+
+func (t *teeStorage) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	if err := t.Storage.UpdateMetrics(ctx, values); err != nil {
+		return err
+	}
+	return t.scrape.UpdateMetrics(ctx, values)
+}
+
+// ScrapeHandler отдает последние собранные метрики в формате Prometheus text или JSON. JSON выбирается
+// параметром format=json или заголовком Accept: application/json.
+func ScrapeHandler(s ScrapeSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := s.GetAllMetrics(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		metrics := make([]*models.Metrics, 0, len(values))
+		for _, m := range values {
+			metrics = append(metrics, m)
+		}
+		sort.Slice(metrics, func(i, j int) bool {
+			return metrics[i].Key().Less(metrics[j].Key())
+		})
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			rs, err := json.Marshal(metrics)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, err = w.Write(rs)
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(prometheusText(metrics))
+		if err != nil {
+			return
+		}
+	}
+}
+
+func prometheusText(metrics []*models.Metrics) []byte {
+	var b strings.Builder
+	for _, m := range metrics {
+		name := prometheusName(m.ID)
+		switch m.MType {
+		case models.Counter:
+			if m.Delta == nil {
+				continue
+			}
+			fmt.Fprintf(&b, "# TYPE %s counter\n%s %d\n", name, name, *m.Delta)
+		case models.Gauge:
+			if m.Value == nil {
+				continue
+			}
+			fmt.Fprintf(&b, "# TYPE %s gauge\n%s %s\n", name, name, strconv.FormatFloat(*m.Value, 'g', -1, 64))
+		}
+	}
+	return []byte(b.String())
+}
+
+// prometheusName заменяет символы, недопустимые в имени метрики Prometheus, на подчеркивание
+func prometheusName(id string) string {
+	var b strings.Builder
+	for i, c := range id {
+		valid := c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')
+		if !valid {
+			c = '_'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// runScrapeServer открывает сокет pull-режима и обслуживает его до отмены ctx
+func runScrapeServer(ctx context.Context, addr string, s ScrapeSource, wg *sync.WaitGroup) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", ScrapeHandler(s))
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Log.Error("Scrape server failed", zap.Error(err))
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		if err := srv.Shutdown(context.Background()); err != nil {
+			logger.Log.Error("Error during scrape server shutdown", zap.Error(err))
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/config"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+func TestTeeStorage_KeepsScrapeValuesAfterPush(t *testing.T) {
+	push := storage.NewMemStorage()
+	scrape := storage.NewMemStorage()
+	tee := &teeStorage{Storage: push, scrape: scrape}
+
+	batch := []models.Metrics{
+		{ID: models.PollCount, MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: models.Alloc, MType: models.Gauge, Value: toPtr(10.0)},
+	}
+	require.NoError(t, tee.UpdateMetrics(context.Background(), batch))
+	push.GetAndClear()
+	require.NoError(t, tee.UpdateMetrics(context.Background(), batch))
+
+	assert.Equal(t, int64(1), *push.GetAndClear()[models.MetricKey{MType: models.Counter, ID: models.PollCount}].Delta)
+
+	metrics, err := scrape.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *metrics[models.MetricKey{MType: models.Counter, ID: models.PollCount}].Delta)
+	assert.Equal(t, 10.0, *metrics[models.MetricKey{MType: models.Gauge, ID: models.Alloc}].Value)
+}
+
+func TestScrapeHandler(t *testing.T) {
+	st := storage.NewMemStorage()
+	require.NoError(t, st.UpdateMetrics(context.Background(), []models.Metrics{
+		{ID: models.PollCount, MType: models.Counter, Delta: toPtr(int64(3))},
+		{ID: models.Alloc, MType: models.Gauge, Value: toPtr(1.5)},
+		{ID: "CPUutilization1", MType: models.Gauge, Value: toPtr(0.25)},
+		{ID: "disk.free-bytes", MType: models.Gauge, Value: toPtr(1e10)},
+	}))
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		contentType string
+		want        string
+	}{
+		{
+			name:        "prometheus",
+			url:         "/metrics",
+			contentType: "text/plain; version=0.0.4; charset=utf-8",
+			want: "# TYPE Alloc gauge\nAlloc 1.5\n" +
+				"# TYPE CPUutilization1 gauge\nCPUutilization1 0.25\n" +
+				"# TYPE PollCount counter\nPollCount 3\n" +
+				"# TYPE disk_free_bytes gauge\ndisk_free_bytes 1e+10\n",
+		},
+		{name: "json by query", url: "/metrics?format=json", contentType: "application/json"},
+		{name: "json by accept", url: "/metrics", accept: "application/json", contentType: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			ScrapeHandler(st).ServeHTTP(w, r)
+
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, tt.contentType, res.Header.Get("Content-Type"))
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, string(body))
+				return
+			}
+			var metrics []models.Metrics
+			require.NoError(t, json.Unmarshal(body, &metrics))
+			require.Len(t, metrics, 4)
+			assert.Equal(t, models.Alloc, metrics[0].ID)
+		})
+	}
+
+	// чтение не очищает буфер отправки
+	assert.Len(t, st.GetAndClear(), 4)
+}
+
+func TestConfigureAgent_ScrapeAddrInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	before := runtime.NumGoroutine()
+	cfg := &config.AgentArg{ReportInterval: 10, PollInterval: 2, RateLimit: 3, Codec: "json", ScrapeAddr: ln.Addr().String()}
+	_, err = ConfigureAgent(context.Background(), cfg, &config.RetryConfig{MaxAttempts: 1}, make(chan []models.Metrics))
+	require.Error(t, err)
+	// при ошибке запуска не должно остаться горутин отправки
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
@@ -0,0 +1,63 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// FileStore хранит окна снимком в отдельном файле рядом с файлом метрик. Файл принадлежит одному
+// серверу, поэтому снимок собирается из окон, загруженных и сохраненных через этот FileStore.
+type FileStore struct {
+	path   string
+	writer *fileworker.SnapshotWriter
+
+	mu      sync.Mutex
+	windows map[models.WindowKey]models.GaugeWindow
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	writer, err := fileworker.NewSnapshotWriter(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{path: path, writer: writer, windows: make(map[models.WindowKey]models.GaugeWindow)}, nil
+}
+
+func (s *FileStore) SaveWindows(_ context.Context, windows []models.GaugeWindow, removed []models.WindowKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range removed {
+		delete(s.windows, key)
+	}
+	for _, w := range windows {
+		s.windows[w.Key()] = w
+	}
+	snapshot := make([]models.GaugeWindow, 0, len(s.windows))
+	for _, w := range s.windows {
+		snapshot = append(snapshot, w)
+	}
+	sortWindows(snapshot)
+	return s.writer.Write(snapshot)
+}
+
+// LoadWindows читает сохраненные окна; если файла еще нет, окон нет
+func (s *FileStore) LoadWindows(_ context.Context) ([]models.GaugeWindow, error) {
+	var windows []models.GaugeWindow
+	if _, err := fileworker.ReadSnapshot(s.path, &windows); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range windows {
+		s.windows[w.Key()] = w
+	}
+	return windows, nil
+}
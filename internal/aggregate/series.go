@@ -0,0 +1,159 @@
+// Package aggregate считает min/max/sum/count значений gauge-метрик за скользящие окна
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// bucketsPerWindow - на сколько корзин делится окно. Статистика окна собирается из корзин целиком,
+// поэтому охватывает от window-window/bucketsPerWindow до window последних значений.
+const bucketsPerWindow = 60
+
+// ParseWindows разбирает список окон через запятую, например "1m,5m,1h"
+func ParseWindows(s string) ([]time.Duration, error) {
+	var windows []time.Duration
+	seen := make(map[time.Duration]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregation window %q: %w", part, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid aggregation window %q: must be at least 1s", part)
+		}
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		windows = append(windows, d)
+	}
+	return windows, nil
+}
+
+// FormatWindow - короткая запись окна: 1m вместо 1m0s
+func FormatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return d.String()
+}
+
+type bucket struct {
+	// start - начало корзины в наносекундах unix-времени
+	start int64
+	min   float64
+	max   float64
+	sum   float64
+	count int64
+	last  float64
+}
+
+// series - окно одной метрики: кольцо корзин одинаковой ширины
+type series struct {
+	window  time.Duration
+	width   int64
+	buckets [bucketsPerWindow]bucket
+}
+
+func newSeries(window time.Duration) *series {
+	return &series{window: window, width: int64(window) / bucketsPerWindow}
+}
+
+func (s *series) slot(at int64) (*bucket, int64) {
+	start := at - at%s.width
+	return &s.buckets[(start/s.width)%bucketsPerWindow], start
+}
+
+func (s *series) observe(value float64, at time.Time) {
+	b, start := s.slot(at.UnixNano())
+	switch {
+	case b.start > start:
+		// значение старше корзины, которая уже заняла это место в кольце
+		return
+	case b.start < start || b.count == 0:
+		*b = bucket{start: start, min: value, max: value, sum: value, count: 1, last: value}
+		return
+	}
+	b.min = math.Min(b.min, value)
+	b.max = math.Max(b.max, value)
+	b.sum += value
+	b.count++
+	b.last = value
+}
+
+// aggregate собирает корзины, пересекающиеся с окном (now-window, now]. ok = false, если значений не было.
+func (s *series) aggregate(now time.Time) (models.Aggregate, bool) {
+	from := now.UnixNano() - int64(s.window)
+	to := now.UnixNano()
+	a := models.Aggregate{Window: FormatWindow(s.window)}
+	var lastStart int64
+	for _, b := range s.buckets {
+		if b.count == 0 || b.start+s.width <= from || b.start > to {
+			continue
+		}
+		if a.Count == 0 {
+			a.Min, a.Max = b.min, b.max
+		} else {
+			a.Min = math.Min(a.Min, b.min)
+			a.Max = math.Max(a.Max, b.max)
+		}
+		a.Sum += b.sum
+		a.Count += b.count
+		if b.start >= lastStart {
+			lastStart = b.start
+			a.Last = b.last
+		}
+	}
+	if a.Count == 0 {
+		return a, false
+	}
+	a.Avg = a.Sum / float64(a.Count)
+	return a, true
+}
+
+// state возвращает непустые корзины, еще не вышедшие из окна к моменту now
+func (s *series) state(now time.Time) []models.WindowBucket {
+	from := now.UnixNano() - int64(s.window)
+	var result []models.WindowBucket
+	for _, b := range s.buckets {
+		if b.count == 0 || b.start+s.width <= from {
+			continue
+		}
+		result = append(result, models.WindowBucket{
+			Start: time.Unix(0, b.start).UTC(),
+			Min:   b.min,
+			Max:   b.max,
+			Sum:   b.sum,
+			Count: b.count,
+			Last:  b.last,
+		})
+	}
+	return result
+}
+
+// restore раскладывает сохраненные корзины по кольцу. Корзины, не совпадающие с границами кольца,
+// пропускаются.
+func (s *series) restore(buckets []models.WindowBucket) {
+	for _, sb := range buckets {
+		at := sb.Start.UnixNano()
+		b, start := s.slot(at)
+		if start != at || sb.Count <= 0 || b.start > start {
+			continue
+		}
+		*b = bucket{start: start, min: sb.Min, max: sb.Max, sum: sb.Sum, count: sb.Count, last: sb.Last}
+	}
+}
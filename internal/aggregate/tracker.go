@@ -0,0 +1,213 @@
+package aggregate
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// Store сохраняет окна между перезапусками сервера
+type Store interface {
+	// SaveWindows добавляет или заменяет windows и удаляет removed, остальные сохраненные окна не меняются
+	SaveWindows(ctx context.Context, windows []models.GaugeWindow, removed []models.WindowKey) error
+	LoadWindows(ctx context.Context) ([]models.GaugeWindow, error)
+}
+
+// Tracker ведет окна для каждой gauge-метрики. Окна хранятся только в памяти и периодически
+// сохраняются в Store, поэтому после сбоя теряются значения, полученные после последнего сохранения.
+type Tracker struct {
+	windows []time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	series map[string][]*series
+	// dirty - метрики, получившие значения после последнего сохранения
+	dirty map[string]struct{}
+	// saved - окна, которые этот трекер сохранил или восстановил и поэтому может удалить
+	saved map[models.WindowKey]struct{}
+}
+
+func NewTracker(windows []time.Duration) *Tracker {
+	return &Tracker{
+		windows: windows,
+		now:     time.Now,
+		series:  make(map[string][]*series),
+		dirty:   make(map[string]struct{}),
+		saved:   make(map[models.WindowKey]struct{}),
+	}
+}
+
+// Observe учитывает новое значение gauge id
+func (t *Tracker) Observe(id string, value float64) {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.get(id) {
+		s.observe(value, now)
+	}
+	t.dirty[id] = struct{}{}
+}
+
+// Aggregates возвращает статистику gauge id по окнам в порядке настройки; окна без значений пропускаются
+func (t *Tracker) Aggregates(id string) []models.Aggregate {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var result []models.Aggregate
+	for _, s := range t.series[id] {
+		if a, ok := s.aggregate(now); ok {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// Remove забывает окна удаленных метрик
+func (t *Tracker) Remove(ids ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, id := range ids {
+		delete(t.series, id)
+		delete(t.dirty, id)
+	}
+}
+
+// Windows возвращает окна для сохранения, отсортированные по имени метрики
+func (t *Tracker) Windows() []models.GaugeWindow {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var result []models.GaugeWindow
+	for id, list := range t.series {
+		for _, s := range list {
+			if buckets := s.state(now); len(buckets) > 0 {
+				result = append(result, models.GaugeWindow{ID: id, Window: s.window, Buckets: buckets})
+			}
+		}
+	}
+	sortWindows(result)
+	return result
+}
+
+// Restore загружает сохраненные окна. Окна, которых больше нет в настройках, пропускаются
+// и удаляются из Store при следующем сохранении.
+func (t *Tracker) Restore(windows []models.GaugeWindow) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, w := range windows {
+		t.saved[w.Key()] = struct{}{}
+		for _, s := range t.get(w.ID) {
+			if s.window == w.Window {
+				s.restore(w.Buckets)
+			}
+		}
+	}
+}
+
+// Run сохраняет окна в store раз в interval и при отмене ctx
+func (t *Tracker) Run(ctx context.Context, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// контекст уже отменен, а последнее сохранение нужно выполнить
+			if err := t.Save(context.WithoutCancel(ctx), store); err != nil {
+				logger.Log.Error("Error saving gauge windows", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := t.Save(ctx, store); err != nil {
+				logger.Log.Error("Error saving gauge windows", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Save сохраняет окна метрик, получивших значения после прошлого сохранения, и удаляет из store окна
+// удаленных и опустевших рядов. Окна, которые трекер не сохранял, не затрагиваются: в общей базе
+// их могут вести другие серверы.
+func (t *Tracker) Save(ctx context.Context, store Store) error {
+	now := t.now()
+	t.mu.Lock()
+	var changed []models.GaugeWindow
+	current := make(map[models.WindowKey]struct{})
+	for id, list := range t.series {
+		_, dirty := t.dirty[id]
+		for _, s := range list {
+			buckets := s.state(now)
+			if len(buckets) == 0 {
+				continue
+			}
+			w := models.GaugeWindow{ID: id, Window: s.window, Buckets: buckets}
+			current[w.Key()] = struct{}{}
+			if dirty {
+				changed = append(changed, w)
+			}
+		}
+	}
+	var removed []models.WindowKey
+	for key := range t.saved {
+		if _, ok := current[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	dirty := t.dirty
+	t.dirty = make(map[string]struct{})
+	t.mu.Unlock()
+
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	sortWindows(changed)
+	sort.Slice(removed, func(i, j int) bool {
+		return windowKeyLess(removed[i], removed[j])
+	})
+	if err := store.SaveWindows(ctx, changed, removed); err != nil {
+		// изменения будут сохранены в следующий раз
+		t.mu.Lock()
+		for id := range dirty {
+			if _, ok := t.series[id]; ok {
+				t.dirty[id] = struct{}{}
+			}
+		}
+		t.mu.Unlock()
+		return err
+	}
+	t.mu.Lock()
+	t.saved = current
+	t.mu.Unlock()
+	return nil
+}
+
+func sortWindows(windows []models.GaugeWindow) {
+	sort.Slice(windows, func(i, j int) bool {
+		return windowKeyLess(windows[i].Key(), windows[j].Key())
+	})
+}
+
+func windowKeyLess(a, b models.WindowKey) bool {
+	if a.ID != b.ID {
+		return a.ID < b.ID
+	}
+	return a.Window < b.Window
+}
+
+// get возвращает окна метрики, создавая их при первом обращении. Вызывается под t.mu.
+func (t *Tracker) get(id string) []*series {
+	list, ok := t.series[id]
+	if !ok {
+		list = make([]*series, len(t.windows))
+		for i, w := range t.windows {
+			list[i] = newSeries(w)
+		}
+		t.series[id] = list
+	}
+	return list
+}
@@ -0,0 +1,236 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func TestParseWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []time.Duration
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "several", value: "1m, 5m,,1h,1m", want: []time.Duration{time.Minute, 5 * time.Minute, time.Hour}},
+		{name: "bad duration", value: "1m,hour", wantErr: true},
+		{name: "too short", value: "500ms", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWindows(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFormatWindow(t *testing.T) {
+	assert.Equal(t, "1h", FormatWindow(time.Hour))
+	assert.Equal(t, "90m", FormatWindow(90*time.Minute))
+	assert.Equal(t, "30s", FormatWindow(30*time.Second))
+	assert.Equal(t, "1.5s", FormatWindow(1500*time.Millisecond))
+}
+
+// clock - управляемое время для Tracker
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestTracker(windows ...time.Duration) (*Tracker, *clock) {
+	c := &clock{now: time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)}
+	t := NewTracker(windows)
+	t.now = c.Now
+	return t, c
+}
+
+func TestTracker_Aggregates(t *testing.T) {
+	tr, c := newTestTracker(time.Minute, time.Hour)
+
+	tr.Observe("cpu", 10)
+	c.now = c.now.Add(30 * time.Second)
+	tr.Observe("cpu", 90)
+	c.now = c.now.Add(20 * time.Second)
+	tr.Observe("cpu", 20)
+
+	assert.Equal(t, []models.Aggregate{
+		{Window: "1m", Min: 10, Max: 90, Sum: 120, Count: 3, Avg: 40, Last: 20},
+		{Window: "1h", Min: 10, Max: 90, Sum: 120, Count: 3, Avg: 40, Last: 20},
+	}, tr.Aggregates("cpu"))
+
+	// пик в 90 ушел из минутного окна, но остался в часовом
+	c.now = c.now.Add(41 * time.Second)
+	assert.Equal(t, []models.Aggregate{
+		{Window: "1m", Min: 20, Max: 20, Sum: 20, Count: 1, Avg: 20, Last: 20},
+		{Window: "1h", Min: 10, Max: 90, Sum: 120, Count: 3, Avg: 40, Last: 20},
+	}, tr.Aggregates("cpu"))
+
+	// минутное окно опустело и не возвращается
+	c.now = c.now.Add(2 * time.Minute)
+	got := tr.Aggregates("cpu")
+	require.Len(t, got, 1)
+	assert.Equal(t, "1h", got[0].Window)
+
+	assert.Empty(t, tr.Aggregates("unknown"))
+}
+
+func TestTracker_RingReuse(t *testing.T) {
+	tr, c := newTestTracker(time.Minute)
+
+	// ровно через окно значение попадает в ту же корзину кольца и вытесняет старое
+	tr.Observe("g", 100)
+	c.now = c.now.Add(time.Minute)
+	tr.Observe("g", 1)
+
+	assert.Equal(t, []models.Aggregate{
+		{Window: "1m", Min: 1, Max: 1, Sum: 1, Count: 1, Avg: 1, Last: 1},
+	}, tr.Aggregates("g"))
+}
+
+func TestTracker_Remove(t *testing.T) {
+	tr, _ := newTestTracker(time.Minute)
+	tr.Observe("a", 1)
+	tr.Observe("b", 2)
+	tr.Remove("a")
+
+	assert.Empty(t, tr.Aggregates("a"))
+	assert.Len(t, tr.Aggregates("b"), 1)
+}
+
+func TestTracker_WindowsRestore(t *testing.T) {
+	tr, c := newTestTracker(time.Minute, time.Hour)
+	tr.Observe("cpu", 10)
+	c.now = c.now.Add(10 * time.Second)
+	tr.Observe("cpu", 30)
+	tr.Observe("mem", 5)
+
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "metrics.json.windows"))
+	require.NoError(t, err)
+	require.NoError(t, tr.Save(context.Background(), store))
+
+	saved, err := store.LoadWindows(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, saved, 4)
+
+	// после перезапуска окно 5m новое, а 1h восстанавливается; 1m из настроек убрали
+	restored := NewTracker([]time.Duration{time.Hour, 5 * time.Minute})
+	restored.now = c.Now
+	restored.Restore(saved)
+
+	assert.Equal(t, []models.Aggregate{
+		{Window: "1h", Min: 10, Max: 30, Sum: 40, Count: 2, Avg: 20, Last: 30},
+	}, restored.Aggregates("cpu"))
+	assert.Equal(t, tr.Aggregates("mem")[1], restored.Aggregates("mem")[0])
+}
+
+// memoryStore - Store в памяти, запоминающий последнее сохранение
+type memoryStore struct {
+	windows map[models.WindowKey]models.GaugeWindow
+	changed []models.GaugeWindow
+	removed []models.WindowKey
+	err     error
+}
+
+func (s *memoryStore) SaveWindows(_ context.Context, windows []models.GaugeWindow, removed []models.WindowKey) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.changed, s.removed = windows, removed
+	for _, k := range removed {
+		delete(s.windows, k)
+	}
+	for _, w := range windows {
+		s.windows[w.Key()] = w
+	}
+	return nil
+}
+
+func (s *memoryStore) LoadWindows(context.Context) ([]models.GaugeWindow, error) {
+	var result []models.GaugeWindow
+	for _, w := range s.windows {
+		result = append(result, w)
+	}
+	return result, nil
+}
+
+func TestTracker_SaveChangesOnly(t *testing.T) {
+	ctx := context.Background()
+	tr, c := newTestTracker(time.Minute)
+	// окно другого сервера с общей базой
+	other := models.GaugeWindow{ID: "remote", Window: time.Minute, Buckets: []models.WindowBucket{{Start: c.now, Count: 1}}}
+	store := &memoryStore{windows: map[models.WindowKey]models.GaugeWindow{other.Key(): other}}
+
+	tr.Observe("a", 1)
+	tr.Observe("b", 2)
+	require.NoError(t, tr.Save(ctx, store))
+	assert.Len(t, store.changed, 2)
+	assert.Empty(t, store.removed)
+
+	// сохраняются только обновленные метрики, удаленные метрики удаляются
+	store.changed = nil
+	tr.Observe("a", 3)
+	tr.Remove("b")
+	require.NoError(t, tr.Save(ctx, store))
+	require.Len(t, store.changed, 1)
+	assert.Equal(t, "a", store.changed[0].ID)
+	assert.Equal(t, []models.WindowKey{{ID: "b", Window: time.Minute}}, store.removed)
+
+	// опустевшее окно удаляется, окно другого сервера остается
+	c.now = c.now.Add(2 * time.Minute)
+	require.NoError(t, tr.Save(ctx, store))
+	assert.Equal(t, []models.WindowKey{{ID: "a", Window: time.Minute}}, store.removed)
+	assert.Equal(t, map[models.WindowKey]models.GaugeWindow{other.Key(): other}, store.windows)
+}
+
+func TestTracker_SaveRetriesAfterError(t *testing.T) {
+	ctx := context.Background()
+	tr, _ := newTestTracker(time.Minute)
+	store := &memoryStore{windows: map[models.WindowKey]models.GaugeWindow{}, err: errors.New("db is down")}
+
+	tr.Observe("a", 1)
+	require.Error(t, tr.Save(ctx, store))
+	store.err = nil
+	require.NoError(t, tr.Save(ctx, store))
+	assert.Len(t, store.windows, 1)
+}
+
+func TestFileStore_SaveChanges(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json.windows")
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	a := models.GaugeWindow{ID: "a", Window: time.Minute, Buckets: []models.WindowBucket{{Count: 1}}}
+	b := models.GaugeWindow{ID: "b", Window: time.Minute, Buckets: []models.WindowBucket{{Count: 2}}}
+	require.NoError(t, store.SaveWindows(ctx, []models.GaugeWindow{a, b}, nil))
+	require.NoError(t, store.SaveWindows(ctx, nil, []models.WindowKey{a.Key()}))
+
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	windows, err := reopened.LoadWindows(ctx)
+	require.NoError(t, err)
+	require.Len(t, windows, 1)
+	assert.Equal(t, "b", windows[0].ID)
+}
+
+func TestFileStore_LoadMissing(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "missing.windows"))
+	require.NoError(t, err)
+	windows, err := store.LoadWindows(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, windows)
+}
@@ -6,13 +6,21 @@ import (
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
 
+// Действия, попадающие в аудит
+const (
+	ActionUpdate = "update"
+	ActionExpire = "expire"
+)
+
 type Publisher interface {
 	Register(observer)
 	Notify(request []models.Metrics, ip string)
+	// NotifyExpired оповещает об удалении устаревших метрик
+	NotifyExpired(metrics []models.Metrics)
 }
 
 type observer interface {
-	Update(request []models.Metrics, ip string)
+	Update(action string, request []models.Metrics, ip string)
 }
 
 type Auditor struct {
@@ -33,15 +41,20 @@ func (e *Auditor) Register(o observer) {
 	e.observers = append(e.observers, o)
 }
 
-func (e *Auditor) notify(request []models.Metrics, ip string) {
+func (e *Auditor) notify(t task) {
 	for _, observer := range e.observers {
-		observer.Update(request, ip)
+		observer.Update(t.action, t.metrics, t.ip)
 	}
 }
 
 // Notify вызывает метод update у всех наблюдателей, оповещает об изменении метрики
 func (e *Auditor) Notify(request []models.Metrics, ip string) {
-	e.tasks <- task{request, ip}
+	e.tasks <- task{action: ActionUpdate, metrics: request, ip: ip}
+}
+
+// NotifyExpired оповещает наблюдателей об удалении устаревших метрик сервером
+func (e *Auditor) NotifyExpired(metrics []models.Metrics) {
+	e.tasks <- task{action: ActionExpire, metrics: metrics}
 }
 
 func (e *Auditor) startWorker(ctx context.Context) {
@@ -52,7 +65,7 @@ func (e *Auditor) startWorker(ctx context.Context) {
 				if !ok {
 					return
 				}
-				e.notify(task.metrics, task.ip)
+				e.notify(task)
 			case <-ctx.Done():
 				return
 			}
@@ -62,11 +75,13 @@ func (e *Auditor) startWorker(ctx context.Context) {
 
 type Dto struct {
 	TS        int64            `json:"ts"`
+	Action    string           `json:"action"`
 	Metrics   []models.Metrics `json:"metrics"`
 	IPAddress string           `json:"ip_address"`
 }
 
 type task struct {
+	action  string
 	metrics []models.Metrics
 	ip      string
 }
@@ -20,8 +20,8 @@ func newMockObserver() *mockObserver {
 		updates: make(chan task, 1),
 	}
 }
-func (m *mockObserver) Update(metrics []models.Metrics, ip string) {
-	m.updates <- task{metrics, ip}
+func (m *mockObserver) Update(action string, metrics []models.Metrics, ip string) {
+	m.updates <- task{action: action, metrics: metrics, ip: ip}
 }
 
 func (m *mockObserver) AwaitUpdate(timeout time.Duration) (*task, bool) {
@@ -50,6 +50,25 @@ func TestAuditor_RegisterAndAsyncNotify(t *testing.T) {
 
 	task, ok := observer.AwaitUpdate(500 * time.Millisecond)
 	require.True(t, ok)
+	assert.Equal(t, ActionUpdate, task.action)
 	assert.Equal(t, metrics, task.metrics)
 	assert.Equal(t, ip, task.ip)
 }
+
+func TestAuditor_NotifyExpired(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	auditor := NewAuditor(ctx, 10)
+	observer := newMockObserver()
+	auditor.Register(observer)
+
+	metrics := []models.Metrics{{ID: "stale", MType: "gauge", Value: float64Ptr(1)}}
+	auditor.NotifyExpired(metrics)
+
+	task, ok := observer.AwaitUpdate(500 * time.Millisecond)
+	require.True(t, ok)
+	assert.Equal(t, ActionExpire, task.action)
+	assert.Equal(t, metrics, task.metrics)
+	assert.Empty(t, task.ip)
+}
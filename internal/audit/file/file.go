@@ -19,9 +19,10 @@ func NewFileAuditHandler(writer fileworker.Writer) *AuditHandler {
 	}
 }
 
-func (e *AuditHandler) Update(request []models.Metrics, ip string) {
+func (e *AuditHandler) Update(action string, request []models.Metrics, ip string) {
 	err := e.writer.Write(audit.Dto{
 		TS:        time.Now().Unix(),
+		Action:    action,
 		Metrics:   request,
 		IPAddress: ip,
 	})
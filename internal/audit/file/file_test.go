@@ -34,10 +34,11 @@ func TestAuditHandler_Update_Success(t *testing.T) {
 		dtoArg = args.Get(0).(audit.Dto)
 	}).Return(nil)
 
-	handler.Update(request, ip)
+	handler.Update(audit.ActionUpdate, request, ip)
 
 	mockWriter.AssertExpectations(t)
 
+	assert.Equal(t, audit.ActionUpdate, dtoArg.Action)
 	assert.Equal(t, ip, dtoArg.IPAddress)
 	assert.Equal(t, request, dtoArg.Metrics)
 
@@ -53,7 +54,7 @@ func TestAuditHandler_Update_WriteError(t *testing.T) {
 
 	mockWriter.On("Write", mock.AnythingOfType("audit.Dto")).Return(expectedError)
 
-	handler.Update(request, ip)
+	handler.Update(audit.ActionUpdate, request, ip)
 
 	mockWriter.AssertExpectations(t)
 }
@@ -22,9 +22,10 @@ func NewAuditHandler(url string) *AuditHandler {
 	}
 }
 
-func (s *AuditHandler) Update(request []models.Metrics, ip string) {
+func (s *AuditHandler) Update(action string, request []models.Metrics, ip string) {
 	rs, err := json.Marshal(audit.Dto{
 		TS:        time.Now().Unix(),
+		Action:    action,
 		Metrics:   request,
 		IPAddress: ip,
 	})
@@ -35,6 +35,7 @@ func TestAuditHandler_Update_Success(t *testing.T) {
 		err = json.Unmarshal(body, &dto)
 		require.NoError(t, err)
 
+		assert.Equal(t, audit.ActionUpdate, dto.Action)
 		assert.Equal(t, "localhost", dto.IPAddress)
 		assert.Equal(t, metrics, dto.Metrics)
 		w.WriteHeader(http.StatusOK)
@@ -43,7 +44,7 @@ func TestAuditHandler_Update_Success(t *testing.T) {
 
 	handler := NewAuditHandler(ts.URL)
 
-	handler.Update(metrics, "localhost")
+	handler.Update(audit.ActionUpdate, metrics, "localhost")
 
 }
 
@@ -0,0 +1,124 @@
+// Package codec содержит форматы сериализации метрик (JSON, MessagePack, Protobuf) и выбор формата
+// по заголовкам Content-Type и Accept.
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec описывает формат сериализации тела запроса и ответа
+type Codec interface {
+	// Name - короткое имя формата, используемое в конфигурации
+	Name() string
+	// ContentType - основной MIME-тип формата
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// ErrUnsupportedMediaType - формат тела запроса не зарегистрирован
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+var (
+	// JSON используется по умолчанию, если клиент не указал формат
+	JSON Codec = jsonCodec{}
+	// MsgPack - формат MessagePack
+	MsgPack Codec = msgpackCodec{}
+	// Protobuf - формат Protocol Buffers, схема описана в api/proto/metrics.proto
+	Protobuf Codec = protobufCodec{}
+)
+
+var (
+	byName        = map[string]Codec{}
+	byContentType = map[string]Codec{}
+)
+
+func init() {
+	Register(JSON)
+	Register(MsgPack, "application/x-msgpack", "application/vnd.msgpack")
+	Register(Protobuf, "application/protobuf", "application/vnd.google.protobuf")
+}
+
+// Register регистрирует формат под его основным MIME-типом и дополнительными псевдонимами
+func Register(c Codec, aliases ...string) {
+	byName[c.Name()] = c
+	byContentType[c.ContentType()] = c
+	for _, alias := range aliases {
+		byContentType[alias] = c
+	}
+}
+
+// ByName возвращает формат по имени из конфигурации. Пустое имя означает JSON.
+func ByName(name string) (Codec, error) {
+	if name == "" {
+		return JSON, nil
+	}
+	c, ok := byName[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return c, nil
+}
+
+// ForContentType возвращает формат по заголовку Content-Type. Пустой заголовок означает JSON.
+func ForContentType(header string) (Codec, error) {
+	if header == "" {
+		return JSON, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, header)
+	}
+	c, ok := byContentType[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+	return c, nil
+}
+
+// ForAccept выбирает формат ответа по заголовку Accept с учетом весов q. Если ни один из
+// перечисленных типов не поддерживается, возвращается fallback.
+func ForAccept(header string, fallback Codec) Codec {
+	if header == "" {
+		return fallback
+	}
+
+	type candidate struct {
+		mediaType string
+		q         float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	for _, c := range candidates {
+		if c.mediaType == "*/*" || c.mediaType == "application/*" {
+			return fallback
+		}
+		if codec, ok := byContentType[c.mediaType]; ok {
+			return codec
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,211 @@
+package codec
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+// testBatch повторяет типичный пакет агента: runtime-метрики gauge и счетчик PollCount
+func testBatch(size int) []models.Metrics {
+	batch := make([]models.Metrics, 0, size+1)
+	for i := 0; i < size; i++ {
+		batch = append(batch, models.Metrics{
+			ID:    fmt.Sprintf("CPUutilization%d", i),
+			MType: models.Gauge,
+			Value: toPtr(float64(i) * 1234.5678),
+		})
+	}
+	batch = append(batch, models.Metrics{ID: models.PollCount, MType: models.Counter, Delta: toPtr(int64(-42))})
+	return batch
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	for _, c := range []Codec{JSON, MsgPack, Protobuf} {
+		t.Run(c.Name(), func(t *testing.T) {
+			batch := testBatch(5)
+			data, err := c.Marshal(batch)
+			require.NoError(t, err)
+
+			var decoded []models.Metrics
+			require.NoError(t, c.Unmarshal(data, &decoded))
+			assert.Equal(t, batch, decoded)
+
+			single := models.Metrics{ID: "Alloc", MType: models.Gauge, Value: toPtr(0.0)}
+			data, err = c.Marshal(&single)
+			require.NoError(t, err)
+
+			var decodedSingle models.Metrics
+			require.NoError(t, c.Unmarshal(data, &decodedSingle))
+			assert.Equal(t, single, decodedSingle)
+		})
+	}
+}
+
+func TestCodecs_PointerSlice(t *testing.T) {
+	for _, c := range []Codec{JSON, MsgPack, Protobuf} {
+		t.Run(c.Name(), func(t *testing.T) {
+			metric := models.Metrics{ID: "PollCount", MType: models.Counter, Delta: toPtr(int64(5))}
+			data, err := c.Marshal([]*models.Metrics{&metric})
+			require.NoError(t, err)
+
+			var decoded []models.Metrics
+			require.NoError(t, c.Unmarshal(data, &decoded))
+			assert.Equal(t, []models.Metrics{metric}, decoded)
+		})
+	}
+}
+
+func TestProtobuf_UpdatedAtAndAggregates(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.UTC)
+	beforeEpoch := time.Date(1969, 12, 31, 23, 59, 59, 500, time.UTC)
+	metrics := []models.Metrics{
+		{
+			ID: "Alloc", MType: models.Gauge, Value: toPtr(2.5), UpdatedAt: &updatedAt,
+			Aggregates: []models.Aggregate{
+				{Window: "1m0s", Min: -1.5, Max: 2.5, Sum: 3, Count: 3, Avg: 1, Last: 2.5},
+				{Window: "5m0s"},
+			},
+		},
+		{ID: models.PollCount, MType: models.Counter, Delta: toPtr(int64(7)), UpdatedAt: &beforeEpoch},
+	}
+
+	data, err := Protobuf.Marshal(metrics)
+	require.NoError(t, err)
+	var decoded []models.Metrics
+	require.NoError(t, Protobuf.Unmarshal(data, &decoded))
+	assert.Equal(t, metrics, decoded)
+
+	data, err = Protobuf.Marshal(&metrics[0])
+	require.NoError(t, err)
+	var single models.Metrics
+	require.NoError(t, Protobuf.Unmarshal(data, &single))
+	assert.Equal(t, metrics[0], single)
+}
+
+func TestProtobuf_UnsupportedType(t *testing.T) {
+	_, err := Protobuf.Marshal("metric")
+	assert.Error(t, err)
+
+	var s string
+	assert.Error(t, Protobuf.Unmarshal([]byte{}, &s))
+}
+
+func TestProtobuf_Truncated(t *testing.T) {
+	data, err := Protobuf.Marshal(testBatch(1))
+	require.NoError(t, err)
+
+	var decoded []models.Metrics
+	assert.Error(t, Protobuf.Unmarshal(data[:len(data)-1], &decoded))
+}
+
+func TestForContentType(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    Codec
+		wantErr bool
+	}{
+		{header: "", want: JSON},
+		{header: "application/json", want: JSON},
+		{header: "application/json; charset=utf-8", want: JSON},
+		{header: "application/msgpack", want: MsgPack},
+		{header: "application/x-msgpack", want: MsgPack},
+		{header: "application/x-protobuf", want: Protobuf},
+		{header: "application/protobuf", want: Protobuf},
+		{header: "text/plain", wantErr: true},
+		{header: ";;", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			c, err := ForContentType(tt.header)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, c)
+		})
+	}
+}
+
+func TestForAccept(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Codec
+	}{
+		{header: "", want: MsgPack},
+		{header: "*/*", want: MsgPack},
+		{header: "application/json", want: JSON},
+		{header: "text/html, application/x-protobuf", want: Protobuf},
+		{header: "application/json;q=0.5, application/msgpack", want: MsgPack},
+		{header: "application/json;q=0, */*", want: MsgPack},
+		{header: "text/html", want: MsgPack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, ForAccept(tt.header, MsgPack))
+		})
+	}
+}
+
+func TestByName(t *testing.T) {
+	c, err := ByName("")
+	require.NoError(t, err)
+	assert.Equal(t, JSON, c)
+
+	c, err = ByName("Protobuf")
+	require.NoError(t, err)
+	assert.Equal(t, Protobuf, c)
+
+	_, err = ByName("xml")
+	assert.Error(t, err)
+}
+
+// BenchmarkMarshal сравнивает время кодирования и размер тела (bytes/payload) для пакета агента
+func BenchmarkMarshal(b *testing.B) {
+	batch := testBatch(40)
+	for _, c := range []Codec{JSON, MsgPack, Protobuf} {
+		b.Run(c.Name(), func(b *testing.B) {
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := c.Marshal(batch)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/payload")
+		})
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	batch := testBatch(40)
+	for _, c := range []Codec{JSON, MsgPack, Protobuf} {
+		b.Run(c.Name(), func(b *testing.B) {
+			data, err := c.Marshal(batch)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var decoded []models.Metrics
+				if err := c.Unmarshal(data, &decoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/payload")
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// Номера полей из api/proto/metrics.proto
+const (
+	fieldMetricID         protowire.Number = 1
+	fieldMetricType       protowire.Number = 2
+	fieldMetricDelta      protowire.Number = 3
+	fieldMetricValue      protowire.Number = 4
+	fieldMetricHash       protowire.Number = 5
+	fieldMetricUpdatedAt  protowire.Number = 6
+	fieldMetricAggregates protowire.Number = 7
+
+	fieldListMetrics protowire.Number = 1
+
+	// google.protobuf.Timestamp
+	fieldTimestampSeconds protowire.Number = 1
+	fieldTimestampNanos   protowire.Number = 2
+
+	fieldAggregateWindow protowire.Number = 1
+	fieldAggregateMin    protowire.Number = 2
+	fieldAggregateMax    protowire.Number = 3
+	fieldAggregateSum    protowire.Number = 4
+	fieldAggregateCount  protowire.Number = 5
+	fieldAggregateAvg    protowire.Number = 6
+	fieldAggregateLast   protowire.Number = 7
+)
+
+// protobufCodec кодирует одиночную метрику как сообщение Metric, а срез метрик - как MetricList.
+// Сообщения кодируются вручную через protowire, поэтому генерация кода не требуется.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	switch m := v.(type) {
+	case models.Metrics:
+		return appendMetric(nil, &m), nil
+	case *models.Metrics:
+		return appendMetric(nil, m), nil
+	case []models.Metrics:
+		var b, scratch []byte
+		for i := range m {
+			b, scratch = appendListItem(b, scratch, &m[i])
+		}
+		return b, nil
+	case []*models.Metrics:
+		var b, scratch []byte
+		for _, metric := range m {
+			b, scratch = appendListItem(b, scratch, metric)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("protobuf: unsupported type %T", v)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	switch m := v.(type) {
+	case *models.Metrics:
+		return consumeMetric(data, m)
+	case *[]models.Metrics:
+		return consumeList(data, func(metric models.Metrics) {
+			*m = append(*m, metric)
+		})
+	case *[]*models.Metrics:
+		return consumeList(data, func(metric models.Metrics) {
+			*m = append(*m, &metric)
+		})
+	}
+	return fmt.Errorf("protobuf: unsupported type %T", v)
+}
+
+// appendListItem дописывает метрику как вложенное сообщение; scratch переиспользуется между вызовами
+func appendListItem(b, scratch []byte, m *models.Metrics) ([]byte, []byte) {
+	scratch = appendMetric(scratch[:0], m)
+	b = protowire.AppendTag(b, fieldListMetrics, protowire.BytesType)
+	return protowire.AppendBytes(b, scratch), scratch
+}
+
+func appendMetric(b []byte, m *models.Metrics) []byte {
+	if m.ID != "" {
+		b = protowire.AppendTag(b, fieldMetricID, protowire.BytesType)
+		b = protowire.AppendString(b, m.ID)
+	}
+	if m.MType != "" {
+		b = protowire.AppendTag(b, fieldMetricType, protowire.BytesType)
+		b = protowire.AppendString(b, m.MType)
+	}
+	if m.Delta != nil {
+		b = protowire.AppendTag(b, fieldMetricDelta, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(*m.Delta))
+	}
+	if m.Value != nil {
+		b = protowire.AppendTag(b, fieldMetricValue, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*m.Value))
+	}
+	if m.Hash != "" {
+		b = protowire.AppendTag(b, fieldMetricHash, protowire.BytesType)
+		b = protowire.AppendString(b, m.Hash)
+	}
+	if m.UpdatedAt != nil {
+		b = protowire.AppendTag(b, fieldMetricUpdatedAt, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendTimestamp(nil, *m.UpdatedAt))
+	}
+	for i := range m.Aggregates {
+		b = protowire.AppendTag(b, fieldMetricAggregates, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendAggregate(nil, &m.Aggregates[i]))
+	}
+	return b
+}
+
+func appendTimestamp(b []byte, t time.Time) []byte {
+	if s := t.Unix(); s != 0 {
+		b = protowire.AppendTag(b, fieldTimestampSeconds, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s))
+	}
+	if n := t.Nanosecond(); n != 0 {
+		b = protowire.AppendTag(b, fieldTimestampNanos, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(n))
+	}
+	return b
+}
+
+func appendAggregate(b []byte, a *models.Aggregate) []byte {
+	b = protowire.AppendTag(b, fieldAggregateWindow, protowire.BytesType)
+	b = protowire.AppendString(b, a.Window)
+	for _, f := range []struct {
+		num   protowire.Number
+		value float64
+	}{
+		{fieldAggregateMin, a.Min},
+		{fieldAggregateMax, a.Max},
+		{fieldAggregateSum, a.Sum},
+		{fieldAggregateAvg, a.Avg},
+		{fieldAggregateLast, a.Last},
+	} {
+		b = protowire.AppendTag(b, f.num, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(f.value))
+	}
+	b = protowire.AppendTag(b, fieldAggregateCount, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(a.Count))
+}
+
+func consumeList(b []byte, add func(models.Metrics)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if num == fieldListMetrics && typ == protowire.BytesType {
+			raw, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+			}
+			var m models.Metrics
+			if err := consumeMetric(raw, &m); err != nil {
+				return err
+			}
+			add(m)
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeMetric(b []byte, m *models.Metrics) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch {
+		case num == fieldMetricID && typ == protowire.BytesType:
+			m.ID, n = protowire.ConsumeString(b)
+		case num == fieldMetricType && typ == protowire.BytesType:
+			m.MType, n = protowire.ConsumeString(b)
+		case num == fieldMetricHash && typ == protowire.BytesType:
+			m.Hash, n = protowire.ConsumeString(b)
+		case num == fieldMetricDelta && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			delta := protowire.DecodeZigZag(v)
+			m.Delta = &delta
+		case num == fieldMetricValue && typ == protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(b)
+			value := math.Float64frombits(v)
+			m.Value = &value
+		case num == fieldMetricUpdatedAt && typ == protowire.BytesType:
+			var raw []byte
+			raw, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				t, err := consumeTimestamp(raw)
+				if err != nil {
+					return err
+				}
+				m.UpdatedAt = &t
+			}
+		case num == fieldMetricAggregates && typ == protowire.BytesType:
+			var raw []byte
+			raw, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				var a models.Aggregate
+				if err := consumeAggregate(raw, &a); err != nil {
+					return err
+				}
+				m.Aggregates = append(m.Aggregates, a)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// consumeTimestamp декодирует google.protobuf.Timestamp во время UTC
+func consumeTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v uint64
+		switch {
+		case num == fieldTimestampSeconds && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			seconds = int64(v)
+		case num == fieldTimestampNanos && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			nanos = int64(int32(v))
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return time.Time{}, fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
+
+func consumeAggregate(b []byte, a *models.Aggregate) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v uint64
+		switch {
+		case num == fieldAggregateWindow && typ == protowire.BytesType:
+			a.Window, n = protowire.ConsumeString(b)
+		case num == fieldAggregateCount && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			a.Count = int64(v)
+		case typ == protowire.Fixed64Type && num >= fieldAggregateMin && num <= fieldAggregateLast:
+			v, n = protowire.ConsumeFixed64(b)
+			value := math.Float64frombits(v)
+			switch num {
+			case fieldAggregateMin:
+				a.Min = value
+			case fieldAggregateMax:
+				a.Max = value
+			case fieldAggregateSum:
+				a.Sum = value
+			case fieldAggregateAvg:
+				a.Avg = value
+			case fieldAggregateLast:
+				a.Last = value
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
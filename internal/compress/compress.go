@@ -0,0 +1,227 @@
+// Package compress содержит алгоритмы сжатия тела HTTP-запросов и ответов (gzip, deflate, zstd)
+// с пулами writer'ов и выбор алгоритма по заголовкам Content-Encoding и Accept-Encoding.
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ValentinaKh/go-metrics/internal/pool"
+)
+
+// Имена алгоритмов в заголовках Content-Encoding и Accept-Encoding
+const (
+	Gzip    = "gzip"
+	Deflate = "deflate"
+	Zstd    = "zstd"
+)
+
+// ErrUnsupportedEncoding - алгоритм сжатия тела запроса не поддерживается
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// Encoding - алгоритм сжатия
+type Encoding interface {
+	// Name - значение заголовка Content-Encoding
+	Name() string
+	// NewReader возвращает reader, распаковывающий r
+	NewReader(r io.Reader) (io.ReadCloser, error)
+	// NewWriter возвращает writer из пула, сжимающий данные в w. Close дописывает хвост потока и
+	// возвращает writer в пул.
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+// encoderWriter - обертка над writer'ом алгоритма, которую можно переиспользовать через пул
+type encoderWriter interface {
+	io.WriteCloser
+	pool.Resetter
+	start(w io.Writer)
+}
+
+type encoding[T encoderWriter] struct {
+	name      string
+	pool      *pool.Pool[T]
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+func (e *encoding[T]) Name() string {
+	return e.name
+}
+
+func (e *encoding[T]) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return e.newReader(r)
+}
+
+func (e *encoding[T]) NewWriter(w io.Writer) io.WriteCloser {
+	zw := e.pool.Get()
+	zw.start(w)
+	return &pooledWriter[T]{zw: zw, pool: e.pool}
+}
+
+type pooledWriter[T encoderWriter] struct {
+	zw   T
+	pool *pool.Pool[T]
+	done bool
+}
+
+func (p *pooledWriter[T]) Write(b []byte) (int, error) {
+	return p.zw.Write(b)
+}
+
+func (p *pooledWriter[T]) Close() error {
+	if p.done {
+		return nil
+	}
+	p.done = true
+	err := p.zw.Close()
+	p.pool.Put(p.zw)
+	return err
+}
+
+// New создает алгоритм сжатия по имени. Уровень 0 означает уровень алгоритма по умолчанию,
+// для gzip и deflate допустимы уровни 1-9, для zstd - 1-22.
+func New(name string, level int) (Encoding, error) {
+	switch strings.ToLower(name) {
+	case Gzip:
+		return newGzip(level)
+	case Deflate:
+		return newDeflate(level)
+	case Zstd:
+		return newZstd(level)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, name)
+}
+
+func newGzip(level int) (Encoding, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	return &encoding[*GzipWriter]{
+		name: Gzip,
+		pool: pool.New(func() *GzipWriter {
+			gw, _ := gzip.NewWriterLevel(io.Discard, level)
+			return &GzipWriter{s: gw}
+		}),
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	}, nil
+}
+
+// newDeflate - Content-Encoding: deflate по RFC 9110 означает поток zlib, а не "сырой" deflate
+func newDeflate(level int) (Encoding, error) {
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+	if _, err := zlib.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, fmt.Errorf("deflate: %w", err)
+	}
+	return &encoding[*DeflateWriter]{
+		name: Deflate,
+		pool: pool.New(func() *DeflateWriter {
+			zw, _ := zlib.NewWriterLevel(io.Discard, level)
+			return &DeflateWriter{s: zw}
+		}),
+		newReader: zlib.NewReader,
+	}, nil
+}
+
+func newZstd(level int) (Encoding, error) {
+	encoderLevel := zstd.SpeedDefault
+	if level != 0 {
+		if level < 1 || level > 22 {
+			return nil, fmt.Errorf("zstd: invalid compression level: %d", level)
+		}
+		encoderLevel = zstd.EncoderLevelFromZstd(level)
+	}
+	return &encoding[*ZstdWriter]{
+		name: Zstd,
+		pool: pool.New(func() *ZstdWriter {
+			// writer из пула используется одной горутиной, дополнительная конкурентность не нужна
+			zw, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(encoderLevel), zstd.WithEncoderConcurrency(1))
+			return &ZstdWriter{s: zw}
+		}),
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	}, nil
+}
+
+// Registry - набор поддерживаемых алгоритмов с общим уровнем сжатия
+type Registry struct {
+	encodings map[string]Encoding
+}
+
+// NewRegistry создает набор из gzip, deflate и zstd с уровнем сжатия level
+func NewRegistry(level int) (*Registry, error) {
+	r := &Registry{encodings: make(map[string]Encoding)}
+	for _, name := range []string{Gzip, Deflate, Zstd} {
+		e, err := New(name, level)
+		if err != nil {
+			return nil, err
+		}
+		r.encodings[name] = e
+	}
+	return r, nil
+}
+
+// ForContentEncoding возвращает алгоритм для заголовка Content-Encoding. Для пустого заголовка
+// и identity возвращается nil.
+func (r *Registry) ForContentEncoding(header string) (Encoding, error) {
+	name := strings.ToLower(strings.TrimSpace(header))
+	if name == "" || name == "identity" {
+		return nil, nil
+	}
+	e, ok := r.encodings[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, header)
+	}
+	return e, nil
+}
+
+// ForAcceptEncoding выбирает алгоритм ответа по заголовку Accept-Encoding: с наибольшим весом q,
+// при равных весах - первый в списке клиента. Если подходящего нет, возвращается nil.
+func (r *Registry) ForAcceptEncoding(header string) Encoding {
+	type candidate struct {
+		encoding Encoding
+		q        float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		e, ok := r.encodings[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{encoding: e, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].encoding
+}
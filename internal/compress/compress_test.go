@@ -0,0 +1,127 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func roundTrip(t *testing.T, e Encoding, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := e.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	// повторный Close не должен возвращать writer в пул второй раз
+	require.NoError(t, zw.Close())
+
+	zr, err := e.NewReader(&buf)
+	require.NoError(t, err)
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	return out
+}
+
+func TestEncodings_RoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"id":"Alloc","type":"gauge","value":42.5}`, 100))
+	for _, name := range []string{Gzip, Deflate, Zstd} {
+		for _, level := range []int{0, 1, 9} {
+			e, err := New(name, level)
+			require.NoError(t, err)
+			assert.Equal(t, name, e.Name())
+
+			// writer из пула переиспользуется между вызовами
+			assert.Equal(t, data, roundTrip(t, e, data))
+			assert.Equal(t, data, roundTrip(t, e, data))
+		}
+	}
+}
+
+func TestNew_InvalidLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level int
+	}{
+		{name: Gzip, level: 10},
+		{name: Deflate, level: -5},
+		{name: Zstd, level: 23},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.name, tt.level)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNew_Unsupported(t *testing.T) {
+	_, err := New("br", 0)
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+func TestRegistry_ForContentEncoding(t *testing.T) {
+	r, err := NewRegistry(0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{header: ""},
+		{header: "identity"},
+		{header: "gzip", want: Gzip},
+		{header: " ZSTD ", want: Zstd},
+		{header: "deflate", want: Deflate},
+		{header: "br", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			e, err := r.ForContentEncoding(tt.header)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.Nil(t, e)
+				return
+			}
+			assert.Equal(t, tt.want, e.Name())
+		})
+	}
+}
+
+func TestRegistry_ForAcceptEncoding(t *testing.T) {
+	r, err := NewRegistry(0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: ""},
+		{header: "br"},
+		{header: "gzip", want: Gzip},
+		{header: "br, deflate, gzip", want: Deflate},
+		{header: "gzip;q=0.5, zstd", want: Zstd},
+		{header: "zstd;q=0, gzip", want: Gzip},
+		{header: "gzip;q=0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			e := r.ForAcceptEncoding(tt.header)
+			if tt.want == "" {
+				assert.Nil(t, e)
+				return
+			}
+			require.NotNil(t, e)
+			assert.Equal(t, tt.want, e.Name())
+		})
+	}
+}
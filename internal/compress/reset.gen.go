@@ -0,0 +1,26 @@
+// Code generated by reset. DO NOT EDIT.
+
+package compress
+
+import "io"
+
+func (c *GzipWriter) Reset() {
+	if c == nil {
+		return
+	}
+	c.s.Reset(io.Discard)
+}
+
+func (c *DeflateWriter) Reset() {
+	if c == nil {
+		return
+	}
+	c.s.Reset(io.Discard)
+}
+
+func (c *ZstdWriter) Reset() {
+	if c == nil {
+		return
+	}
+	c.s.Reset(io.Discard)
+}
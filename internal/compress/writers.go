@@ -0,0 +1,36 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// generate:reset
+type GzipWriter struct {
+	s *gzip.Writer
+}
+
+func (w *GzipWriter) start(dst io.Writer)         { w.s.Reset(dst) }
+func (w *GzipWriter) Write(p []byte) (int, error) { return w.s.Write(p) }
+func (w *GzipWriter) Close() error                { return w.s.Close() }
+
+// generate:reset
+type DeflateWriter struct {
+	s *zlib.Writer
+}
+
+func (w *DeflateWriter) start(dst io.Writer)         { w.s.Reset(dst) }
+func (w *DeflateWriter) Write(p []byte) (int, error) { return w.s.Write(p) }
+func (w *DeflateWriter) Close() error                { return w.s.Close() }
+
+// generate:reset
+type ZstdWriter struct {
+	s *zstd.Encoder
+}
+
+func (w *ZstdWriter) start(dst io.Writer)         { w.s.Reset(dst) }
+func (w *ZstdWriter) Write(p []byte) (int, error) { return w.s.Write(p) }
+func (w *ZstdWriter) Close() error                { return w.s.Close() }
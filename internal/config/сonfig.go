@@ -22,6 +22,12 @@ type AgentArg struct {
 	ReportInterval uint64 `json:"report_interval"`
 	PollInterval   uint64 `json:"poll_interval"`
 	RateLimit      uint64
+	// Codec - формат сериализации отправляемых метрик: json, msgpack или protobuf
+	Codec string `json:"codec"`
+	// Compression - алгоритм сжатия отправляемых метрик: gzip, deflate, zstd или identity
+	Compression string `json:"compression"`
+	// ScrapeAddr - адрес HTTP-сервера pull-режима с эндпоинтом /metrics, пустой адрес отключает его
+	ScrapeAddr string `json:"scrape_address"`
 }
 
 // ServerArg - server config
@@ -35,37 +41,106 @@ type ServerArg struct {
 	AuditURL       string
 	ProfilePort    string
 	AuditQueueSize uint64
+	// DBMaxOpenConns - максимальное число открытых соединений с базой, 0 - без ограничения
+	DBMaxOpenConns uint64 `json:"db_max_open_conns"`
+	// DBMaxIdleConns - максимальное число простаивающих соединений в пуле
+	DBMaxIdleConns uint64 `json:"db_max_idle_conns"`
+	// DBConnMaxLifetime - время жизни соединения в секундах, 0 - без ограничения
+	DBConnMaxLifetime uint64 `json:"db_conn_max_lifetime"`
+	// DBQueryTimeout - таймаут выполнения запроса (statement_timeout) в миллисекундах, 0 - без ограничения
+	DBQueryTimeout uint64 `json:"db_query_timeout"`
+	// DBConnectTimeout - сколько секунд ждать доступности базы при запуске
+	DBConnectTimeout uint64 `json:"db_connect_timeout"`
+	// DBReadDSNs - строки подключения к репликам для чтения через запятую, пустое значение - читать с основной базы
+	DBReadDSNs string `json:"database_read_dsn"`
+	// MetricsCache - хранить в памяти текущие значения метрик из базы; кэш читает только основную базу,
+	// поэтому вместе с DBReadDSNs не используется
+	MetricsCache bool `json:"metrics_cache"`
+	// CacheNotify - согласовывать кэши серверов с общей базой через LISTEN/NOTIFY
+	CacheNotify bool `json:"cache_notify"`
+	// MetricTTL - время жизни метрики без обновлений в секундах, 0 - метрики не устаревают
+	MetricTTL uint64 `json:"metric_ttl"`
+	// MetricTTLRules - время жизни для метрик по шаблону имени через запятую: "host_*=24h,tmp.*=10m"
+	MetricTTLRules string `json:"metric_ttl_rules"`
+	// RetentionInterval - период удаления устаревших метрик в секундах
+	RetentionInterval uint64 `json:"retention_interval"`
+	// GaugeWindows - окна агрегатов gauge через запятую, например "1m,5m,1h", пустое значение - агрегаты не считаются
+	GaugeWindows string `json:"gauge_windows"`
+	// ReplicationFollowers - адреса реплик (host:port) через запятую, на которые пересылаются принятые пакеты.
+	// Запросы между серверами подписываются ключом KEY, без него репликация не включается.
+	ReplicationFollowers string `json:"replication_followers"`
+	// ReplicationQueueDir - каталог очередей пакетов для реплик
+	ReplicationQueueDir string `json:"replication_queue_dir"`
+	// ReplicationPrimary - адрес основного сервера (host:port); если задан, сервер работает репликой. Нужен KEY,
+	// как и для ReplicationFollowers.
+	ReplicationPrimary string `json:"replication_primary"`
+	// StoreRetain - сколько предыдущих снимков файла метрик хранить для восстановления; при STORE_INTERVAL=0
+	// предыдущий снимок сохраняется не чаще раза в минуту
+	StoreRetain uint64 `json:"store_retain"`
+	// WALFile - журнал упреждающей записи для файлового хранилища, пустое значение отключает журнал
+	WALFile string `json:"wal_file"`
+	// WALSync - политика fsync журнала: always, interval или never
+	WALSync string `json:"wal_sync"`
+	// WALSyncInterval - период fsync журнала в миллисекундах для политики interval
+	WALSyncInterval uint64 `json:"wal_sync_interval"`
+	// CryptoKeyPasswordFile - файл с паролем к зашифрованному закрытому ключу
+	CryptoKeyPasswordFile string `json:"crypto_key_password_file"`
+	// CompressionMinSize - ответы короче этого размера в байтах не сжимаются
+	CompressionMinSize uint64 `json:"compression_min_size"`
+	// StatsdAddr - адрес приемника StatsD, пустой адрес отключает приемник
+	StatsdAddr string `json:"statsd_address"`
+	// StatsdNetwork - тип сокета приемника StatsD: udp или unixgram
+	StatsdNetwork string `json:"statsd_network"`
+	// StatsdFlushInterval - период сброса агрегированных метрик StatsD в секундах
+	StatsdFlushInterval uint64 `json:"statsd_flush_interval"`
+	// GraphiteAddr - адрес приемника Graphite plaintext, пустой адрес отключает приемник
+	GraphiteAddr string `json:"graphite_address"`
+	// GraphiteCounterPatterns - шаблоны путей Graphite через запятую, сохраняемых как счетчики
+	GraphiteCounterPatterns string `json:"graphite_counter_patterns"`
+	// GraphiteMaxConns - максимальное число одновременно обслуживаемых соединений Graphite
+	GraphiteMaxConns uint64 `json:"graphite_max_conns"`
+	// GraphiteIdleTimeout - таймаут простоя соединения Graphite в секундах
+	GraphiteIdleTimeout uint64 `json:"graphite_idle_timeout"`
+	// OTLPResourceAttributes - атрибуты ресурса OTLP через запятую, добавляемые к имени метрики
+	OTLPResourceAttributes string `json:"otlp_resource_attributes"`
 }
 
 type CommonArgs struct {
 	Host      string `json:"address"`
 	Key       string `json:"key"`
 	CryptoKey string `json:"crypto_key"`
+	// CompressionLevel - уровень сжатия, 0 - уровень алгоритма по умолчанию
+	CompressionLevel int `json:"compression_level"`
 }
 
 func registerCommonFlags(cfg *CommonArgs) {
 	flag.StringVar(&cfg.Host, "a", "localhost:8080", "address for endpoint")
 	flag.StringVar(&cfg.Key, "k", "", "key")
 	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "")
+	flag.IntVar(&cfg.CompressionLevel, "compression-level", cfg.CompressionLevel, "compression level, 0 - default")
 }
 
 func getCommonEnvVars(cfg *CommonArgs) {
 	cfg.Host = utils.LoadEnvVar("ADDRESS", cfg.Host, func(s string) (string, error) { return s, nil })
 	cfg.Key = utils.LoadEnvVar("KEY", cfg.Key, func(s string) (string, error) { return s, nil })
 	cfg.CryptoKey = utils.LoadEnvVar("CRYPTO_KEY", cfg.CryptoKey, func(s string) (string, error) { return s, nil })
+	cfg.CompressionLevel = utils.LoadEnvVar("COMPRESSION_LEVEL", cfg.CompressionLevel, strconv.Atoi)
 }
 
 func MustParseAgentArgs() *AgentArg {
 	var cfg AgentArg
 	path := getConfigPath()
 	if path != "" {
-		cfg = loadConfigFile[AgentArg](path)
+		loadConfigFile(path, &cfg)
 	}
 
 	registerCommonFlags(&cfg.CommonArgs)
 	flag.Uint64Var(&cfg.ReportInterval, "r", configOrDefault(cfg.ReportInterval, 10), "reportInterval")
 	flag.Uint64Var(&cfg.PollInterval, "p", configOrDefault(cfg.PollInterval, 2), "pollInterval")
 	flag.Uint64Var(&cfg.RateLimit, "l", configOrDefault(cfg.RateLimit, 2), "rateLimit")
+	flag.StringVar(&cfg.Codec, "codec", configOrDefault(cfg.Codec, "json"), "wire format: json, msgpack or protobuf")
+	flag.StringVar(&cfg.Compression, "compression", configOrDefault(cfg.Compression, "gzip"), "gzip, deflate, zstd or identity")
+	flag.StringVar(&cfg.ScrapeAddr, "scrape-address", cfg.ScrapeAddr, "pull mode listen address, empty - disabled")
 
 	flag.Parse()
 
@@ -73,37 +148,100 @@ func MustParseAgentArgs() *AgentArg {
 	cfg.ReportInterval = utils.LoadEnvVar("REPORT_INTERVAL", cfg.ReportInterval, uintParser)
 	cfg.PollInterval = utils.LoadEnvVar("POLL_INTERVAL", cfg.PollInterval, uintParser)
 	cfg.RateLimit = utils.LoadEnvVar("RATE_LIMIT", cfg.RateLimit, uintParser)
+	cfg.Codec = utils.LoadEnvVar("CODEC", cfg.Codec, strParser)
+	cfg.Compression = utils.LoadEnvVar("COMPRESSION", cfg.Compression, strParser)
+	cfg.ScrapeAddr = utils.LoadEnvVar("SCRAPE_ADDRESS", cfg.ScrapeAddr, strParser)
 
 	return &cfg
 }
 
 func MustParseServerArgs() *ServerArg {
-	var cfg ServerArg
+	// 0 - допустимый интервал (синхронная запись), поэтому умолчание задается до чтения файла, а не
+	// через configOrDefault: store_interval, явно равный 0 в файле, его перекрывает
+	cfg := ServerArg{Interval: 300}
 	path := getConfigPath()
 	if path != "" {
-		cfg = loadConfigFile[ServerArg](path)
+		loadConfigFile(path, &cfg)
 	}
 
 	registerCommonFlags(&cfg.CommonArgs)
 	flag.StringVar(&cfg.ConnStr, "d", cfg.ConnStr, "key")
-	flag.Uint64Var(&cfg.Interval, "i", configOrDefault(cfg.Interval, 300), "store interval")
+	flag.Uint64Var(&cfg.Interval, "i", cfg.Interval, "store interval, 0 - write synchronously")
 	flag.Uint64Var(&cfg.AuditQueueSize, "b", 300, "audit queue size")
+	flag.Uint64Var(&cfg.DBMaxOpenConns, "db-max-open-conns", configOrDefault(cfg.DBMaxOpenConns, 20), "max open db connections, 0 - unlimited")
+	flag.Uint64Var(&cfg.DBMaxIdleConns, "db-max-idle-conns", configOrDefault(cfg.DBMaxIdleConns, 5), "max idle db connections")
+	flag.Uint64Var(&cfg.DBConnMaxLifetime, "db-conn-max-lifetime", configOrDefault(cfg.DBConnMaxLifetime, 300), "db connection max lifetime in seconds")
+	flag.Uint64Var(&cfg.DBQueryTimeout, "db-query-timeout", configOrDefault(cfg.DBQueryTimeout, 5000), "db statement timeout in ms")
+	flag.Uint64Var(&cfg.DBConnectTimeout, "db-connect-timeout", configOrDefault(cfg.DBConnectTimeout, 30), "wait for db on startup, seconds")
+	flag.StringVar(&cfg.DBReadDSNs, "database-read-dsn", cfg.DBReadDSNs, "comma separated read replica DSNs")
+	flag.BoolVar(&cfg.MetricsCache, "metrics-cache", cfg.MetricsCache, "cache current metric values from the database in memory")
+	flag.BoolVar(&cfg.CacheNotify, "cache-notify", cfg.CacheNotify, "invalidate caches of servers sharing the database via LISTEN/NOTIFY")
+	flag.Uint64Var(&cfg.MetricTTL, "metric-ttl", cfg.MetricTTL, "metric ttl in seconds, 0 - metrics never expire")
+	flag.StringVar(&cfg.MetricTTLRules, "metric-ttl-rules", cfg.MetricTTLRules, "comma separated pattern=duration ttl rules")
+	flag.Uint64Var(&cfg.RetentionInterval, "retention-interval", configOrDefault(cfg.RetentionInterval, 60), "expired metrics sweep interval in seconds")
+	flag.StringVar(&cfg.GaugeWindows, "gauge-windows", cfg.GaugeWindows, "comma separated gauge aggregation windows, e.g. 1m,5m,1h")
+	flag.StringVar(&cfg.ReplicationFollowers, "replication-followers", cfg.ReplicationFollowers, "comma separated follower addresses")
+	flag.StringVar(&cfg.ReplicationQueueDir, "replication-queue-dir", configOrDefault(cfg.ReplicationQueueDir, "replication"), "directory for follower queues")
+	flag.StringVar(&cfg.ReplicationPrimary, "replication-primary", cfg.ReplicationPrimary, "primary server address, run as follower if set")
 	flag.StringVar(&cfg.File, "f", configOrDefault(cfg.File, "metrics.json"), "file name")
 	flag.StringVar(&cfg.AuditFile, "audit-file", "audit.json", "file name")
 	flag.StringVar(&cfg.AuditURL, "audit-url", "http://localhost:8080", "url")
 	flag.BoolVar(&cfg.Restore, "r", configOrDefault(cfg.Restore, true), "load history")
+	flag.Uint64Var(&cfg.StoreRetain, "store-retain", cfg.StoreRetain, "number of previous snapshots to keep")
+	flag.StringVar(&cfg.WALFile, "wal-file", cfg.WALFile, "write-ahead log file, empty - disabled")
+	flag.StringVar(&cfg.WALSync, "wal-sync", configOrDefault(cfg.WALSync, "interval"), "wal fsync policy: always, interval or never")
+	flag.Uint64Var(&cfg.WALSyncInterval, "wal-sync-interval", configOrDefault(cfg.WALSyncInterval, 100), "wal fsync interval in ms")
+	flag.Uint64Var(&cfg.CompressionMinSize, "compression-min-size", cfg.CompressionMinSize, "min response size to compress")
+	flag.StringVar(&cfg.StatsdAddr, "statsd-address", cfg.StatsdAddr, "statsd listener address, empty - disabled")
+	flag.StringVar(&cfg.StatsdNetwork, "statsd-network", configOrDefault(cfg.StatsdNetwork, "udp"), "statsd listener network: udp or unixgram")
+	flag.Uint64Var(&cfg.StatsdFlushInterval, "statsd-flush-interval", configOrDefault(cfg.StatsdFlushInterval, 10), "statsd flush interval")
+	flag.StringVar(&cfg.GraphiteAddr, "graphite-address", cfg.GraphiteAddr, "graphite listener address, empty - disabled")
+	flag.StringVar(&cfg.GraphiteCounterPatterns, "graphite-counter-patterns", cfg.GraphiteCounterPatterns, "comma separated graphite paths stored as counters")
+	flag.Uint64Var(&cfg.GraphiteMaxConns, "graphite-max-conns", configOrDefault(cfg.GraphiteMaxConns, 100), "graphite max connections")
+	flag.Uint64Var(&cfg.GraphiteIdleTimeout, "graphite-idle-timeout", configOrDefault(cfg.GraphiteIdleTimeout, 60), "graphite connection idle timeout")
+	flag.StringVar(&cfg.OTLPResourceAttributes, "otlp-resource-attributes", configOrDefault(cfg.OTLPResourceAttributes, "service.name"), "comma separated OTLP resource attributes added to metric names")
+	flag.StringVar(&cfg.CryptoKeyPasswordFile, "crypto-key-password-file", cfg.CryptoKeyPasswordFile, "file with crypto key password")
 
 	flag.Parse()
 
 	getCommonEnvVars(&cfg.CommonArgs)
 	cfg.ProfilePort = ":6060"
 	cfg.ConnStr = utils.LoadEnvVar("DATABASE_DSN", cfg.ConnStr, strParser)
+	cfg.DBMaxOpenConns = utils.LoadEnvVar("DB_MAX_OPEN_CONNS", cfg.DBMaxOpenConns, uintParser)
+	cfg.DBMaxIdleConns = utils.LoadEnvVar("DB_MAX_IDLE_CONNS", cfg.DBMaxIdleConns, uintParser)
+	cfg.DBConnMaxLifetime = utils.LoadEnvVar("DB_CONN_MAX_LIFETIME", cfg.DBConnMaxLifetime, uintParser)
+	cfg.DBQueryTimeout = utils.LoadEnvVar("DB_QUERY_TIMEOUT", cfg.DBQueryTimeout, uintParser)
+	cfg.DBConnectTimeout = utils.LoadEnvVar("DB_CONNECT_TIMEOUT", cfg.DBConnectTimeout, uintParser)
+	cfg.DBReadDSNs = utils.LoadEnvVar("DATABASE_READ_DSN", cfg.DBReadDSNs, strParser)
+	cfg.MetricsCache = utils.LoadEnvVar("METRICS_CACHE", cfg.MetricsCache, boolParser)
+	cfg.CacheNotify = utils.LoadEnvVar("CACHE_NOTIFY", cfg.CacheNotify, boolParser)
+	cfg.MetricTTL = utils.LoadEnvVar("METRIC_TTL", cfg.MetricTTL, uintParser)
+	cfg.MetricTTLRules = utils.LoadEnvVar("METRIC_TTL_RULES", cfg.MetricTTLRules, strParser)
+	cfg.RetentionInterval = utils.LoadEnvVar("RETENTION_INTERVAL", cfg.RetentionInterval, uintParser)
+	cfg.GaugeWindows = utils.LoadEnvVar("GAUGE_WINDOWS", cfg.GaugeWindows, strParser)
+	cfg.ReplicationFollowers = utils.LoadEnvVar("REPLICATION_FOLLOWERS", cfg.ReplicationFollowers, strParser)
+	cfg.ReplicationQueueDir = utils.LoadEnvVar("REPLICATION_QUEUE_DIR", cfg.ReplicationQueueDir, strParser)
+	cfg.ReplicationPrimary = utils.LoadEnvVar("REPLICATION_PRIMARY", cfg.ReplicationPrimary, strParser)
 	cfg.File = utils.LoadEnvVar("FILE_STORAGE_PATH", cfg.File, strParser)
 	cfg.AuditFile = utils.LoadEnvVar("AUDIT_FILE", cfg.AuditFile, strParser)
 	cfg.AuditURL = utils.LoadEnvVar("AUDIT_URL", cfg.AuditURL, strParser)
 	cfg.AuditURL = utils.LoadEnvVar("PROFILE_PORT", cfg.ProfilePort, strParser)
 	cfg.Interval = utils.LoadEnvVar("STORE_INTERVAL", cfg.Interval, uintParser)
 	cfg.Restore = utils.LoadEnvVar("RESTORE", cfg.Restore, boolParser)
+	cfg.StoreRetain = utils.LoadEnvVar("STORE_RETAIN", cfg.StoreRetain, uintParser)
+	cfg.WALFile = utils.LoadEnvVar("WAL_FILE", cfg.WALFile, strParser)
+	cfg.WALSync = utils.LoadEnvVar("WAL_SYNC", cfg.WALSync, strParser)
+	cfg.WALSyncInterval = utils.LoadEnvVar("WAL_SYNC_INTERVAL", cfg.WALSyncInterval, uintParser)
+	cfg.CompressionMinSize = utils.LoadEnvVar("COMPRESSION_MIN_SIZE", cfg.CompressionMinSize, uintParser)
+	cfg.StatsdAddr = utils.LoadEnvVar("STATSD_ADDRESS", cfg.StatsdAddr, strParser)
+	cfg.StatsdNetwork = utils.LoadEnvVar("STATSD_NETWORK", cfg.StatsdNetwork, strParser)
+	cfg.StatsdFlushInterval = utils.LoadEnvVar("STATSD_FLUSH_INTERVAL", cfg.StatsdFlushInterval, uintParser)
+	cfg.GraphiteAddr = utils.LoadEnvVar("GRAPHITE_ADDRESS", cfg.GraphiteAddr, strParser)
+	cfg.GraphiteCounterPatterns = utils.LoadEnvVar("GRAPHITE_COUNTER_PATTERNS", cfg.GraphiteCounterPatterns, strParser)
+	cfg.GraphiteMaxConns = utils.LoadEnvVar("GRAPHITE_MAX_CONNS", cfg.GraphiteMaxConns, uintParser)
+	cfg.GraphiteIdleTimeout = utils.LoadEnvVar("GRAPHITE_IDLE_TIMEOUT", cfg.GraphiteIdleTimeout, uintParser)
+	cfg.OTLPResourceAttributes = utils.LoadEnvVar("OTLP_RESOURCE_ATTRIBUTES", cfg.OTLPResourceAttributes, strParser)
+	cfg.CryptoKeyPasswordFile = utils.LoadEnvVar("CRYPTO_KEY_PASSWORD_FILE", cfg.CryptoKeyPasswordFile, strParser)
 
 	return &cfg
 }
@@ -125,7 +263,8 @@ func getConfigPath() string {
 	return utils.LoadEnvVar("CONFIG", path, strParser)
 }
 
-func loadConfigFile[T any](path string) T {
+// loadConfigFile читает JSON-конфигурацию в cfg; поля, которых нет в файле, сохраняют прежние значения
+func loadConfigFile[T any](path string, cfg *T) {
 	f, err := os.Open(path)
 	if err != nil {
 		panic(fmt.Errorf("can't open config file: %w", err))
@@ -139,11 +278,9 @@ func loadConfigFile[T any](path string) T {
 
 	decoder := json.NewDecoder(f)
 
-	var cfg T
-	if err := decoder.Decode(&cfg); err != nil {
+	if err := decoder.Decode(cfg); err != nil {
 		panic(fmt.Errorf("can't parse config file: %w", err))
 	}
-	return cfg
 }
 
 func configOrDefault[T Basic](configVal T, defaultVal T) T {
@@ -29,11 +29,35 @@ func TestLoadConfigFile_Success(t *testing.T) {
 		t.Fatalf("failed to create temp config file: %v", err)
 	}
 
-	cfg := loadConfigFile[TestConfig](configPath)
+	var cfg TestConfig
+	loadConfigFile(configPath, &cfg)
 
 	assert.Equal(t, TestConfig{Host: "localhost", Port: 8080}, cfg)
 }
 
+func TestLoadConfigFile_KeepsDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    uint64
+	}{
+		{name: "store_interval not set", content: `{"store_file": "m.json"}`, want: 300},
+		{name: "store_interval set to 0", content: `{"store_interval": 0}`, want: 0},
+		{name: "store_interval set", content: `{"store_interval": 5}`, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.json")
+			require.NoError(t, os.WriteFile(configPath, []byte(tt.content), 0644))
+
+			cfg := ServerArg{Interval: 300}
+			loadConfigFile(configPath, &cfg)
+
+			assert.Equal(t, tt.want, cfg.Interval)
+		})
+	}
+}
+
 func TestLoadConfigFile_FileNotFound(t *testing.T) {
-	require.Panics(t, func() { loadConfigFile[TestConfig]("/test/path.json") })
+	require.Panics(t, func() { loadConfigFile("/test/path.json", &TestConfig{}) })
 }
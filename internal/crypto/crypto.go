@@ -1,77 +1,120 @@
 package crypto
 
 import (
+	"context"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
-	"encoding/pem"
-	"fmt"
-	"hash"
-	"io"
-	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
 )
 
-type CryptoKey interface {
-	*x509.Certificate | *rsa.PrivateKey | *rsa.PublicKey
+// CryptoService шифрует сообщения открытым ключом или расшифровывает закрытым. Ключи RSA используют
+// RSA-OAEP, ключи EC - ECIES.
+type CryptoService struct {
+	// key - *rsa.PublicKey, *ecdsa.PublicKey, *rsa.PrivateKey или *ecdsa.PrivateKey
+	key       any
+	chain     []*x509.Certificate
+	transform func(message []byte) ([]byte, error)
 }
 
-type CryptoService[T CryptoKey, V CryptoKey] struct {
-	key       T
-	extract   func(T) V
-	transform func(hash hash.Hash, random io.Reader, v V, ciphertext []byte, label []byte) ([]byte, error)
+func (cs *CryptoService) Transform(message []byte) ([]byte, error) {
+	return cs.transform(message)
 }
 
-func (cs *CryptoService[T, V]) Transform(message []byte) ([]byte, error) {
+// NotAfter возвращает ближайшую дату истечения сертификатов, загруженных вместе с ключом.
+// Если сертификатов нет, ok равен false.
+func (cs *CryptoService) NotAfter() (notAfter time.Time, ok bool) {
+	for _, cert := range cs.chain {
+		if !ok || cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+			ok = true
+		}
+	}
+	return notAfter, ok
+}
 
-	value := cs.extract(cs.key)
-	return cs.transform(sha256.New(), rand.Reader, value, message, nil)
+// WarnExpiry пишет предупреждение в лог, если сертификат истекает раньше, чем через warnBefore
+func (cs *CryptoService) WarnExpiry(now time.Time, warnBefore time.Duration) {
+	notAfter, ok := cs.NotAfter()
+	if !ok {
+		return
+	}
+	left := notAfter.Sub(now)
+	switch {
+	case left <= 0:
+		logger.Log.Error("Certificate has expired", zap.Time("notAfter", notAfter))
+	case left <= warnBefore:
+		logger.Log.Warn("Certificate expires soon", zap.Time("notAfter", notAfter), zap.Duration("left", left))
+	}
 }
 
-func NewPublicKeyService(filePath string) (*CryptoService[*x509.Certificate, *rsa.PublicKey], error) {
-	cert, err := loadKey(filePath, x509.ParseCertificate)
-	if err != nil {
-		return nil, err
+// WatchExpiry проверяет срок действия сертификатов сразу и затем каждые interval до завершения ctx
+func (cs *CryptoService) WatchExpiry(ctx context.Context, warnBefore, interval time.Duration) {
+	if _, ok := cs.NotAfter(); !ok {
+		return
 	}
-	service := CryptoService[*x509.Certificate, *rsa.PublicKey]{
-		key: cert,
-		extract: func(cert *x509.Certificate) *rsa.PublicKey {
-			return cert.PublicKey.(*rsa.PublicKey)
-		},
-		transform: rsa.EncryptOAEP,
+	cs.WarnExpiry(time.Now(), warnBefore)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cs.WarnExpiry(now, warnBefore)
+		}
 	}
-	return &service, nil
 }
 
-func NewPrivateKeyService(filePath string) (*CryptoService[*rsa.PrivateKey, *rsa.PrivateKey], error) {
-	cert, err := loadKey(filePath, x509.ParsePKCS1PrivateKey)
+// NewPublicKeyService создает сервис шифрования по открытому ключу. Файл может содержать цепочку
+// сертификатов X.509 либо открытый ключ PKIX или PKCS#1.
+func NewPublicKeyService(filePath string) (*CryptoService, error) {
+	key, chain, err := loadPublicKey(filePath)
 	if err != nil {
 		return nil, err
 	}
-	service := CryptoService[*rsa.PrivateKey, *rsa.PrivateKey]{
-		key: cert,
-		extract: func(cert *rsa.PrivateKey) *rsa.PrivateKey {
-			return cert
-		},
-		transform: rsa.DecryptOAEP,
+	service := CryptoService{key: key, chain: chain}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		service.transform = func(message []byte) ([]byte, error) {
+			return rsa.EncryptOAEP(sha256.New(), rand.Reader, k, message, nil)
+		}
+	case *ecdsa.PublicKey:
+		service.transform = func(message []byte) ([]byte, error) {
+			return eciesEncrypt(k, message)
+		}
 	}
 	return &service, nil
 }
 
-func loadKey[T CryptoKey](filePath string, parse func(der []byte) (T, error)) (T, error) {
-	certBytes, err := os.ReadFile(filePath)
+// NewPrivateKeyService создает сервис расшифровки по закрытому ключу. Если ключ зашифрован,
+// пароль читается из passwordFile.
+func NewPrivateKeyService(filePath, passwordFile string) (*CryptoService, error) {
+	password, err := readPassword(passwordFile)
 	if err != nil {
 		return nil, err
 	}
-
-	pemBlock, _ := pem.Decode(certBytes)
-	if pemBlock == nil {
-		return nil, fmt.Errorf("certificate not found")
-	}
-
-	certificate, err := parse(pemBlock.Bytes)
+	key, chain, err := loadPrivateKey(filePath, password)
 	if err != nil {
 		return nil, err
 	}
-	return certificate, nil
+	service := CryptoService{key: key, chain: chain}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		service.transform = func(message []byte) ([]byte, error) {
+			return rsa.DecryptOAEP(sha256.New(), rand.Reader, k, message, nil)
+		}
+	case *ecdsa.PrivateKey:
+		service.transform = func(message []byte) ([]byte, error) {
+			return eciesDecrypt(k, message)
+		}
+	}
+	return &service, nil
 }
@@ -1,16 +1,21 @@
 package crypto
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/youmark/pkcs8"
 	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func createTestKeys(t *testing.T) (publicPath, privatePath string) {
@@ -29,6 +34,8 @@ func createTestKeys(t *testing.T) (publicPath, privatePath string) {
 
 	template := &x509.Certificate{
 		SerialNumber: randomSerial(),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
 	}
 	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, privateKey)
 	if err != nil {
@@ -62,18 +69,19 @@ func randomSerial() *big.Int {
 func TestLoadCertificate_Valid(t *testing.T) {
 	pubPath, privatePath := createTestKeys(t)
 
-	cert, err := loadKey[*x509.Certificate](pubPath, x509.ParseCertificate)
+	cert, chain, err := loadPublicKey(pubPath)
 	assert.NoError(t, err)
 	assert.NotNil(t, cert)
+	assert.Len(t, chain, 1)
 
-	cert1, err1 := loadKey[*rsa.PrivateKey](privatePath, x509.ParsePKCS1PrivateKey)
+	cert1, _, err1 := loadPrivateKey(privatePath, nil)
 	assert.NoError(t, err1)
 	assert.NotNil(t, cert1)
 
 }
 
 func TestLoadCertificate_InvalidPath(t *testing.T) {
-	cert, err := loadKey[*x509.Certificate]("/test/path.pem", x509.ParseCertificate)
+	cert, _, err := loadPublicKey("/test/path.pem")
 	assert.Error(t, err)
 	assert.Nil(t, cert)
 }
@@ -85,7 +93,7 @@ func TestEncryptDecrypt(t *testing.T) {
 	if err != nil {
 		t.Fatalf("InitCertificate: %v", err)
 	}
-	private, err := NewPrivateKeyService(privatePath)
+	private, err := NewPrivateKeyService(privatePath, "")
 	if err != nil {
 		t.Fatalf("InitPrivateKey: %v", err)
 	}
@@ -99,3 +107,256 @@ func TestEncryptDecrypt(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, original, decrypted)
 }
+
+func writePEM(t *testing.T, name string, blocks ...*pem.Block) string {
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func createCertificate(t *testing.T, template, parent *x509.Certificate, pub *rsa.PublicKey, signer *rsa.PrivateKey) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestLoadPrivateKey_Formats(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pkcs8Der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	encrypted, err := pkcs8.MarshalPrivateKey(key, []byte("secret"), nil)
+	require.NoError(t, err)
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("secret\n"), 0600))
+
+	tests := []struct {
+		name     string
+		block    *pem.Block
+		password string
+		wantErr  string
+	}{
+		{
+			name:  "PKCS#1",
+			block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		},
+		{
+			name:  "PKCS#8",
+			block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Der},
+		},
+		{
+			name:     "encrypted PKCS#8",
+			block:    &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted},
+			password: passwordFile,
+		},
+		{
+			name:    "encrypted PKCS#8 without password",
+			block:   &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted},
+			wantErr: "key password file required",
+		},
+		{
+			name:    "PKCS#8 in PKCS#1 block",
+			block:   &pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs8Der},
+			wantErr: "as PKCS#1 private key",
+		},
+		{
+			name:    "public key instead of private",
+			block:   &pem.Block{Type: "PUBLIC KEY", Bytes: []byte{}},
+			wantErr: "private key not found: expected PEM block RSA PRIVATE KEY (PKCS#1), EC PRIVATE KEY (SEC1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writePEM(t, "key.pem", tt.block)
+			cs, err := NewPrivateKeyService(path, tt.password)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, key.Equal(cs.key))
+		})
+	}
+}
+
+func TestEncryptDecrypt_EC(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sec1, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	pkcs8Der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	public, err := NewPublicKeyService(writePEM(t, "public.pem", &pem.Block{Type: "PUBLIC KEY", Bytes: pkix}))
+	require.NoError(t, err)
+	original := []byte("secret message")
+	encrypted, err := public.Transform(original)
+	require.NoError(t, err)
+
+	for name, block := range map[string]*pem.Block{
+		"SEC1":   {Type: "EC PRIVATE KEY", Bytes: sec1},
+		"PKCS#8": {Type: "PRIVATE KEY", Bytes: pkcs8Der},
+	} {
+		t.Run(name, func(t *testing.T) {
+			private, err := NewPrivateKeyService(writePEM(t, "ec.pem", block), "")
+			require.NoError(t, err)
+			assert.True(t, key.Equal(private.key))
+
+			decrypted, err := private.Transform(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, original, decrypted)
+
+			tampered := append([]byte(nil), encrypted...)
+			tampered[len(tampered)-1] ^= 1
+			_, err = private.Transform(tampered)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadPrivateKey_Unsupported(t *testing.T) {
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+	p224Der, err := x509.MarshalECPrivateKey(p224)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		block   *pem.Block
+		wantErr string
+	}{
+		{
+			name:    "EC curve without ECDH",
+			block:   &pem.Block{Type: "EC PRIVATE KEY", Bytes: p224Der},
+			wantErr: "expected P-256, P-384 or P-521",
+		},
+		{
+			name: "legacy OpenSSL encryption",
+			block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+				Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-256-CBC,00"}},
+			wantErr: "openssl pkcs8 -topk8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := loadPrivateKey(writePEM(t, "key.pem", tt.block), []byte("secret"))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadPublicKey_PKIX(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	path := writePEM(t, "public.pem", &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	cs, err := NewPublicKeyService(path)
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(cs.key))
+
+	_, ok := cs.NotAfter()
+	assert.False(t, ok)
+}
+
+func TestLoadPublicKey_Chain(t *testing.T) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(48 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	ca := createCertificate(t, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+	}
+	leaf := createCertificate(t, leafTemplate, ca, &leafKey.PublicKey, caKey)
+
+	t.Run("valid chain", func(t *testing.T) {
+		path := writePEM(t, "chain.pem",
+			&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw},
+			&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+		cs, err := NewPublicKeyService(path)
+		require.NoError(t, err)
+		assert.True(t, leafKey.PublicKey.Equal(cs.key))
+
+		notAfter, ok := cs.NotAfter()
+		assert.True(t, ok)
+		assert.Equal(t, leaf.NotAfter, notAfter)
+	})
+
+	t.Run("broken chain", func(t *testing.T) {
+		path := writePEM(t, "chain.pem",
+			&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw},
+			&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+		_, err := NewPublicKeyService(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is not signed by certificate 1")
+	})
+
+	t.Run("expired certificate", func(t *testing.T) {
+		expiredTemplate := &x509.Certificate{
+			SerialNumber: randomSerial(),
+			Subject:      pkix.Name{CommonName: "expired"},
+			NotBefore:    now.Add(-48 * time.Hour),
+			NotAfter:     now.Add(-time.Hour),
+		}
+		expired := createCertificate(t, expiredTemplate, ca, &leafKey.PublicKey, caKey)
+		path := writePEM(t, "chain.pem",
+			&pem.Block{Type: "CERTIFICATE", Bytes: expired.Raw},
+			&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+		_, err := NewPublicKeyService(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "certificate 0 (CN=expired) expired at")
+	})
+
+	t.Run("private key with certificate", func(t *testing.T) {
+		path := writePEM(t, "bundle.pem",
+			&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(leafKey)},
+			&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw},
+			&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+		cs, err := NewPrivateKeyService(path, "")
+		require.NoError(t, err)
+		_, ok := cs.NotAfter()
+		assert.True(t, ok)
+	})
+
+	t.Run("private key with foreign certificate", func(t *testing.T) {
+		path := writePEM(t, "bundle.pem",
+			&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(caKey)},
+			&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw},
+			&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+		_, err := NewPrivateKeyService(path, "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not match private key")
+	})
+}
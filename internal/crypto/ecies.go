@@ -0,0 +1,100 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// eciesInfo - контекст HKDF, отделяющий ключи шифрования метрик от других применений того же ключа EC
+const eciesInfo = "go-metrics ECIES AES-256-GCM"
+
+// Ключи EC не умеют шифровать напрямую, поэтому сообщение шифруется по схеме ECIES: общий секрет ECDH
+// одноразового ключа отправителя и ключа получателя превращается HKDF-SHA256 в ключ AES-256-GCM.
+// Шифртекст - открытый одноразовый ключ (несжатая точка), nonce и сообщение, зашифрованное GCM.
+
+// eciesEncrypt шифрует message открытым ключом получателя
+func eciesEncrypt(pub *ecdsa.PublicKey, message []byte) ([]byte, error) {
+	recipient, err := pub.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("EC public key: %w", err)
+	}
+	ephemeral, err := recipient.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPub := ephemeral.PublicKey().Bytes()
+	aead, err := eciesCipher(secret, ephemeralPub)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(ephemeralPub)+aead.NonceSize()+len(message)+aead.Overhead())
+	out = append(out, ephemeralPub...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, message, ephemeralPub), nil
+}
+
+// eciesDecrypt расшифровывает сообщение, зашифрованное eciesEncrypt, закрытым ключом получателя
+func eciesDecrypt(priv *ecdsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	recipient, err := priv.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("EC private key: %w", err)
+	}
+	pubSize := len(recipient.PublicKey().Bytes())
+	if len(ciphertext) < pubSize {
+		return nil, errors.New("ECIES ciphertext is too short")
+	}
+	ephemeralPub := ciphertext[:pubSize]
+	ephemeral, err := recipient.Curve().NewPublicKey(ephemeralPub)
+	if err != nil {
+		return nil, fmt.Errorf("ECIES ephemeral key: %w", err)
+	}
+	secret, err := recipient.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := eciesCipher(secret, ephemeralPub)
+	if err != nil {
+		return nil, err
+	}
+	rest := ciphertext[pubSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("ECIES ciphertext is too short")
+	}
+	return aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], ephemeralPub)
+}
+
+// eciesCipher выводит ключ AES-256-GCM из общего секрета; одноразовый ключ служит солью
+func eciesCipher(secret, ephemeralPub []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, secret, ephemeralPub, eciesInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// checkECDHCurve проверяет, что ключ EC лежит на кривой, поддерживаемой ECDH (P-256, P-384 или P-521)
+func checkECDHCurve(pub *ecdsa.PublicKey) error {
+	if _, err := pub.ECDH(); err != nil {
+		return fmt.Errorf("EC key on curve %s is not supported: expected P-256, P-384 or P-521", pub.Curve.Params().Name)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/youmark/pkcs8"
+)
+
+// Типы PEM-блоков, которые умеет читать загрузчик ключей
+const (
+	pemRSAPrivateKey       = "RSA PRIVATE KEY"
+	pemPrivateKey          = "PRIVATE KEY"
+	pemEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+	pemECPrivateKey        = "EC PRIVATE KEY"
+	pemPublicKey           = "PUBLIC KEY"
+	pemRSAPublicKey        = "RSA PUBLIC KEY"
+	pemCertificate         = "CERTIFICATE"
+)
+
+const (
+	expectedPrivateKey = pemRSAPrivateKey + " (PKCS#1), " + pemECPrivateKey + " (SEC1), " + pemPrivateKey +
+		" (PKCS#8) or " + pemEncryptedPrivateKey + " (encrypted PKCS#8)"
+	expectedPublicKey = pemCertificate + " (X.509 chain), " + pemPublicKey + " (PKIX) or " +
+		pemRSAPublicKey + " (PKCS#1)"
+)
+
+// loadPrivateKey загружает закрытый ключ RSA или EC из PEM-файла: PKCS#1, SEC1 или PKCS#8 (в том числе
+// зашифрованный). Сертификаты, лежащие в том же файле, проверяются и возвращаются как цепочка.
+func loadPrivateKey(filePath string, password []byte) (any, []*x509.Certificate, error) {
+	blocks, err := readPEMBlocks(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var key any
+	var chain []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case pemCertificate:
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: parse %s block as X.509 certificate: %w", filePath, block.Type, err)
+			}
+			chain = append(chain, cert)
+		case pemRSAPrivateKey, pemPrivateKey, pemEncryptedPrivateKey, pemECPrivateKey:
+			if key != nil {
+				return nil, nil, fmt.Errorf("%s: more than one private key found", filePath)
+			}
+			key, err = parsePrivateKey(block, password)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+			}
+		}
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("%s: private key not found: expected PEM block %s, got %s",
+			filePath, expectedPrivateKey, blockTypes(blocks))
+	}
+
+	if len(chain) > 0 {
+		if err := verifyChain(chain, time.Now()); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		if !samePublicKey(publicKeyOf(key), chain[0].PublicKey) {
+			return nil, nil, fmt.Errorf("%s: certificate %s does not match private key", filePath, chain[0].Subject)
+		}
+	}
+	return key, chain, nil
+}
+
+// loadPublicKey загружает открытый ключ RSA или EC из PEM-файла: из цепочки сертификатов (ключ берется
+// из первого, листового сертификата) либо из голого ключа PKIX или PKCS#1.
+func loadPublicKey(filePath string) (any, []*x509.Certificate, error) {
+	blocks, err := readPEMBlocks(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var key any
+	var chain []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case pemCertificate:
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: parse %s block as X.509 certificate: %w", filePath, block.Type, err)
+			}
+			chain = append(chain, cert)
+		case pemPublicKey, pemRSAPublicKey:
+			if key != nil {
+				return nil, nil, fmt.Errorf("%s: more than one public key found", filePath)
+			}
+			key, err = parsePublicKey(block)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+			}
+		}
+	}
+
+	if len(chain) > 0 {
+		if err := verifyChain(chain, time.Now()); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		leaf, err := asPublicKey(chain[0].PublicKey, "X.509 certificate")
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		if key != nil && !samePublicKey(key, leaf) {
+			return nil, nil, fmt.Errorf("%s: public key does not match certificate %s", filePath, chain[0].Subject)
+		}
+		key = leaf
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("%s: public key not found: expected PEM block %s, got %s",
+			filePath, expectedPublicKey, blockTypes(blocks))
+	}
+	return key, chain, nil
+}
+
+// readPassword читает пароль к ключу из файла, отбрасывая завершающий перевод строки
+func readPassword(filePath string) ([]byte, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read key password file: %w", err)
+	}
+	return []byte(strings.TrimRight(string(data), "\r\n")), nil
+}
+
+func readPEMBlocks(filePath string) ([]*pem.Block, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("%s: no PEM blocks found", filePath)
+	}
+	return blocks, nil
+}
+
+func parsePrivateKey(block *pem.Block, password []byte) (any, error) {
+	if block.Type == pemEncryptedPrivateKey {
+		if len(password) == 0 {
+			return nil, fmt.Errorf("%s block is encrypted: key password file required", block.Type)
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, password)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s block as encrypted PKCS#8 private key: %w", block.Type, err)
+		}
+		return asPrivateKey(key, "encrypted PKCS#8")
+	}
+	// Устаревшее шифрование OpenSSL (Proc-Type: 4,ENCRYPTED) небезопасно и не поддерживается
+	if block.Headers["Proc-Type"] == "4,ENCRYPTED" {
+		return nil, fmt.Errorf("%s block uses legacy OpenSSL encryption: convert it to %s with "+
+			"openssl pkcs8 -topk8", block.Type, pemEncryptedPrivateKey)
+	}
+
+	switch block.Type {
+	case pemRSAPrivateKey:
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s block as PKCS#1 private key: %w", block.Type, err)
+		}
+		return key, nil
+	case pemECPrivateKey:
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s block as SEC1 private key: %w", block.Type, err)
+		}
+		return asPrivateKey(key, "SEC1")
+	case pemPrivateKey:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s block as PKCS#8 private key: %w", block.Type, err)
+		}
+		return asPrivateKey(key, "PKCS#8")
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q: expected %s", block.Type, expectedPrivateKey)
+}
+
+func parsePublicKey(block *pem.Block) (any, error) {
+	switch block.Type {
+	case pemPublicKey:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s block as PKIX public key: %w", block.Type, err)
+		}
+		return asPublicKey(key, "PKIX")
+	case pemRSAPublicKey:
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s block as PKCS#1 public key: %w", block.Type, err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q: expected %s", block.Type, expectedPublicKey)
+}
+
+// Ключи RSA шифруют по схеме RSA-OAEP, ключи EC - по ECIES, ключи других алгоритмов (например, Ed25519)
+// читаются, но не принимаются
+func asPrivateKey(key any, format string) (any, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		if err := checkECDHCurve(&k.PublicKey); err != nil {
+			return nil, fmt.Errorf("%s private key: %w", format, err)
+		}
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s private key has type %T: expected RSA or EC key", format, key)
+}
+
+func asPublicKey(key any, format string) (any, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		if err := checkECDHCurve(k); err != nil {
+			return nil, fmt.Errorf("%s public key: %w", format, err)
+		}
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s public key has type %T: expected RSA or EC key", format, key)
+}
+
+// publicKeyOf возвращает открытую часть закрытого ключа, принятого asPrivateKey
+func publicKeyOf(key any) any {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey
+	}
+	return nil
+}
+
+func samePublicKey(a, b any) bool {
+	switch k := a.(type) {
+	case *rsa.PublicKey:
+		return k.Equal(b)
+	case *ecdsa.PublicKey:
+		return k.Equal(b)
+	}
+	return false
+}
+
+// verifyChain проверяет срок действия каждого сертификата и то, что каждый сертификат подписан следующим.
+// Цепочка должна начинаться с листового сертификата.
+func verifyChain(chain []*x509.Certificate, now time.Time) error {
+	for i, cert := range chain {
+		if now.Before(cert.NotBefore) {
+			return fmt.Errorf("certificate %d (%s) is not valid before %s",
+				i, cert.Subject, cert.NotBefore.Format(time.RFC3339))
+		}
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate %d (%s) expired at %s",
+				i, cert.Subject, cert.NotAfter.Format(time.RFC3339))
+		}
+		if i+1 < len(chain) {
+			if err := cert.CheckSignatureFrom(chain[i+1]); err != nil {
+				return fmt.Errorf("certificate %d (%s) is not signed by certificate %d (%s): %w",
+					i, cert.Subject, i+1, chain[i+1].Subject, err)
+			}
+		}
+	}
+	return nil
+}
+
+func blockTypes(blocks []*pem.Block) string {
+	types := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		types = append(types, block.Type)
+	}
+	return strings.Join(types, ", ")
+}
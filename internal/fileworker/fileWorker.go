@@ -13,6 +13,12 @@ type Writer interface {
 	Close() error
 }
 
+// SyncWriter - Writer, который умеет сбрасывать записанные данные на диск
+type SyncWriter interface {
+	Writer
+	Sync() error
+}
+
 // FileWriter  используется для записи данных в файл  в формате JSON
 type FileWriter struct {
 	encoder *json.Encoder
@@ -41,6 +47,11 @@ func (f *FileWriter) Write(v any) error {
 	return nil
 }
 
+// Sync сбрасывает записанные данные на диск (fsync)
+func (f *FileWriter) Sync() error {
+	return f.file.Sync()
+}
+
 // Close закрывает файл
 func (f *FileWriter) Close() error {
 	return f.file.Close()
@@ -93,3 +93,14 @@ func TestFileWriter_Close_Success(t *testing.T) {
 	require.NoError(t, err)
 
 }
+
+func TestFileWriter_Sync(t *testing.T) {
+	tmpFile := t.TempDir() + "/test_sync.json"
+	writer, err := NewFileWriter(tmpFile)
+	require.NoError(t, err)
+
+	require.NoError(t, writer.Write(testData{Name: "sync", Value: 1}))
+	require.NoError(t, writer.Sync())
+	require.NoError(t, writer.Close())
+	assert.Error(t, writer.Sync())
+}
@@ -0,0 +1,258 @@
+package fileworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+)
+
+const snapshotFormat = "snapshot/v1"
+
+// ErrCorrupted - файл снимка обрезан или не совпадает контрольная сумма
+var ErrCorrupted = errors.New("snapshot file is corrupted")
+
+// snapshotEnvelope - содержимое файла снимка. Checksum - CRC32 (IEEE) от Data.
+type snapshotEnvelope struct {
+	Format   string          `json:"format"`
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// SnapshotWriter атомарно заменяет файл снимком данных: запись идет во временный файл, который
+// после fsync переименовывается поверх основного, так что основной файл существует всегда.
+// Предыдущие retain снимков сохраняются как path.1, path.2 и т.д. для восстановления.
+type SnapshotWriter struct {
+	mu     sync.Mutex
+	path   string
+	retain int
+	// rotateEvery - минимальный промежуток между сохранениями предыдущего снимка, 0 - при каждой записи
+	rotateEvery time.Duration
+	rotatedAt   time.Time
+	now         func() time.Time
+}
+
+func NewSnapshotWriter(path string, retain int) (*SnapshotWriter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("fileName is empty")
+	}
+	if retain < 0 {
+		return nil, fmt.Errorf("retain must not be negative, got %d", retain)
+	}
+	return &SnapshotWriter{path: path, retain: retain, now: time.Now}, nil
+}
+
+// WithRotateInterval сохраняет предыдущий снимок не чаще раза в d. Нужен при частой записи (синхронный
+// режим), иначе path.1, path.2 отличались бы от основного файла на миллисекунды.
+func (w *SnapshotWriter) WithRotateInterval(d time.Duration) *SnapshotWriter {
+	w.rotateEvery = d
+	return w
+}
+
+// Write сохраняет v как новый снимок. После возврата без ошибки снимок уже на диске.
+func (w *SnapshotWriter) Write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(snapshotEnvelope{
+		Format:   snapshotFormat,
+		Checksum: checksum(data),
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	dir := filepath.Dir(w.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(w.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if now := w.now(); w.retain > 0 && now.Sub(w.rotatedAt) >= w.rotateEvery {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+		w.rotatedAt = now
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		return err
+	}
+	committed = true
+	return syncDir(dir)
+}
+
+// rotate сдвигает сохраненные снимки: path.N-1 -> path.N, ..., path.1 -> path.2, а path.1 становится
+// жесткой ссылкой на path. Основной файл при этом остается на месте и заменяется только rename.
+func (w *SnapshotWriter) rotate() error {
+	for i := w.retain; i >= 2; i-- {
+		err := os.Rename(snapshotName(w.path, i-1), snapshotName(w.path, i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	prev := snapshotName(w.path, 1)
+	if err := os.Remove(prev); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err := os.Link(w.path, prev)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Sync ничего не делает: Write возвращается только после fsync
+func (w *SnapshotWriter) Sync() error {
+	return nil
+}
+
+// Close ничего не делает: файл открывается только на время записи снимка
+func (w *SnapshotWriter) Close() error {
+	return nil
+}
+
+// SnapshotFiles возвращает существующие файлы снимков, начиная с самого нового: path, path.1, ...
+func SnapshotFiles(path string) []string {
+	var files []string
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	for i := 1; ; i++ {
+		name := snapshotName(path, i)
+		if _, err := os.Stat(name); err != nil {
+			return files
+		}
+		files = append(files, name)
+	}
+}
+
+// ReadSnapshot декодирует данные снимка из файла path в v. Поддерживается и старый формат, в котором
+// снимки дописывались в конец файла: тогда используется последний целиком записанный снимок,
+// а legacy равно true. Для пустого файла v не меняется.
+func ReadSnapshot(path string, v any) (legacy bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	decoder := json.NewDecoder(file)
+	var first json.RawMessage
+	if err := decoder.Decode(&first); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w: %s: %v", ErrCorrupted, path, err)
+	}
+
+	if env, ok := parseEnvelope(first); ok {
+		if env.Checksum != checksum(env.Data) {
+			return false, fmt.Errorf("%w: %s: checksum mismatch", ErrCorrupted, path)
+		}
+		return false, json.Unmarshal(env.Data, v)
+	}
+
+	last := first
+	for {
+		var next json.RawMessage
+		if err := decoder.Decode(&next); err != nil {
+			if !errors.Is(err, io.EOF) {
+				// хвост обрезан при сбое во время дописывания, предыдущий снимок цел
+				logger.Log.Warn("Last snapshot in legacy file is truncated, using previous one",
+					zap.String("file", path), zap.Error(err))
+			}
+			break
+		}
+		last = next
+	}
+	return true, json.Unmarshal(last, v)
+}
+
+// CompactLegacy переписывает файл старого формата (снимки, дописанные друг за другом) в один снимок
+// нового формата. Возвращает true, если файл был преобразован.
+func CompactLegacy(path string, retain int) (bool, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	var last json.RawMessage
+	legacy, err := ReadSnapshot(path, &last)
+	if err != nil || !legacy {
+		return false, err
+	}
+	w, err := NewSnapshotWriter(path, retain)
+	if err != nil {
+		return false, err
+	}
+	return true, w.Write(last)
+}
+
+func parseEnvelope(raw json.RawMessage) (snapshotEnvelope, bool) {
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		return snapshotEnvelope{}, false
+	}
+	var env snapshotEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil || env.Format != snapshotFormat {
+		return snapshotEnvelope{}, false
+	}
+	return env, true
+}
+
+func checksum(data []byte) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(data))
+}
+
+func snapshotName(path string, i int) string {
+	if i == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(i)
+}
+
+// syncDir делает fsync каталога, чтобы переименование файла пережило сбой питания
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,160 @@
+package fileworker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotWriter_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	w, err := NewSnapshotWriter(path, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Write([]testData{{Name: "a", Value: 1}}))
+	require.NoError(t, w.Write([]testData{{Name: "b", Value: 2}}))
+
+	var got []testData
+	legacy, err := ReadSnapshot(path, &got)
+	require.NoError(t, err)
+	assert.False(t, legacy)
+	assert.Equal(t, []testData{{Name: "b", Value: 2}}, got)
+	assert.Equal(t, []string{path}, SnapshotFiles(path))
+
+	// временные файлы не остаются
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSnapshotWriter_Retain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	w, err := NewSnapshotWriter(path, 2)
+	require.NoError(t, err)
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, w.Write(testData{Value: i}))
+	}
+
+	files := SnapshotFiles(path)
+	require.Equal(t, []string{path, path + ".1", path + ".2"}, files)
+	for i, want := range []int{4, 3, 2} {
+		var got testData
+		_, err := ReadSnapshot(files[i], &got)
+		require.NoError(t, err)
+		assert.Equal(t, want, got.Value)
+	}
+}
+
+func TestSnapshotWriter_RotateInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	w, err := NewSnapshotWriter(path, 2)
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	w.WithRotateInterval(time.Minute)
+
+	// записи чаще интервала заменяют основной файл, не сдвигая сохраненные снимки
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, w.Write(testData{Value: i}))
+		now = now.Add(10 * time.Second)
+	}
+	now = now.Add(time.Minute)
+	require.NoError(t, w.Write(testData{Value: 4}))
+
+	files := SnapshotFiles(path)
+	require.Equal(t, []string{path, path + ".1"}, files)
+	for i, want := range []int{4, 3} {
+		var got testData
+		_, err := ReadSnapshot(files[i], &got)
+		require.NoError(t, err)
+		assert.Equal(t, want, got.Value)
+	}
+}
+
+func TestSnapshotWriter_MainFileAlwaysExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	w, err := NewSnapshotWriter(path, 3)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(testData{Value: 0}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 200; i++ {
+			assert.NoError(t, w.Write(testData{Value: i}))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		var got testData
+		_, err := ReadSnapshot(path, &got)
+		require.NoError(t, err)
+	}
+}
+
+func TestReadSnapshot_Corrupted(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "truncated", content: `{"format":"snapshot/v1","checksum":"00000000","data":[{"na`},
+		{name: "checksum mismatch", content: `{"format":"snapshot/v1","checksum":"00000000","data":[]}`},
+		{name: "garbage", content: `not json`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+
+			var got []testData
+			_, err := ReadSnapshot(path, &got)
+			assert.ErrorIs(t, err, ErrCorrupted)
+		})
+	}
+}
+
+func TestReadSnapshot_Legacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	content := `[{"name":"a","value":1}]` + "\n" + `[{"name":"a","value":2}]` + "\n" + `[{"name":"a","va`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	var got []testData
+	legacy, err := ReadSnapshot(path, &got)
+	require.NoError(t, err)
+	assert.True(t, legacy)
+	assert.Equal(t, []testData{{Name: "a", Value: 2}}, got)
+}
+
+func TestCompactLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	content := `[{"name":"a","value":1}]` + "\n" + `[{"name":"a","value":2}]` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	compacted, err := CompactLegacy(path, 1)
+	require.NoError(t, err)
+	assert.True(t, compacted)
+
+	var got []testData
+	legacy, err := ReadSnapshot(path, &got)
+	require.NoError(t, err)
+	assert.False(t, legacy)
+	assert.Equal(t, []testData{{Name: "a", Value: 2}}, got)
+
+	// повторный запуск ничего не меняет
+	compacted, err = CompactLegacy(path, 1)
+	require.NoError(t, err)
+	assert.False(t, compacted)
+
+	compacted, err = CompactLegacy(filepath.Join(t.TempDir(), "missing.json"), 1)
+	require.NoError(t, err)
+	assert.False(t, compacted)
+}
@@ -0,0 +1,357 @@
+package fileworker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+)
+
+// WALSyncPolicy - когда журнал делает fsync после записи
+type WALSyncPolicy int
+
+const (
+	// WALSyncAlways - fsync после каждой записи
+	WALSyncAlways WALSyncPolicy = iota
+	// WALSyncInterval - fsync раз в заданный период, если были записи
+	WALSyncInterval
+	// WALSyncNever - fsync оставлен операционной системе
+	WALSyncNever
+)
+
+const (
+	walHeaderSize = 8
+	// walMaxRecord защищает от выделения памяти под мусорную длину в поврежденном файле
+	walMaxRecord = 64 << 20
+)
+
+// ParseWALSyncPolicy разбирает политику fsync: always, interval или never
+func ParseWALSyncPolicy(s string) (WALSyncPolicy, error) {
+	switch s {
+	case "always":
+		return WALSyncAlways, nil
+	case "interval":
+		return WALSyncInterval, nil
+	case "never":
+		return WALSyncNever, nil
+	}
+	return 0, fmt.Errorf("unknown wal sync policy %q", s)
+}
+
+// WAL - журнал упреждающей записи. Каждая запись хранится как длина (4 байта), CRC32 (IEEE) данных
+// (4 байта) и сами данные. Оборванная или поврежденная запись в конце файла отбрасывается при открытии.
+type WAL struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	size   int64
+	policy WALSyncPolicy
+	dirty  bool
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenWAL открывает или создает журнал. Для WALSyncInterval interval задает период fsync.
+func OpenWAL(path string, policy WALSyncPolicy, interval time.Duration) (*WAL, error) {
+	if path == "" {
+		return nil, fmt.Errorf("fileName is empty")
+	}
+	if policy == WALSyncInterval && interval <= 0 {
+		return nil, fmt.Errorf("wal sync interval must be positive, got %s", interval)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := validRecordsSize(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if err := truncateTail(file, size); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	w := &WAL{path: path, file: file, size: size, policy: policy}
+	if policy == WALSyncInterval {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.syncLoop(interval)
+	}
+	return w, nil
+}
+
+// Append дописывает запись в конец журнала. При WALSyncAlways запись уже на диске после возврата.
+func (w *WAL) Append(payload []byte) error {
+	if len(payload) > walMaxRecord {
+		return fmt.Errorf("wal record is too large: %d bytes", len(payload))
+	}
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[walHeaderSize:], payload)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	if _, err := w.file.WriteAt(record, w.size); err != nil {
+		// частично записанная запись будет перезаписана следующей
+		return err
+	}
+	w.size += int64(len(record))
+	if w.policy == WALSyncAlways {
+		return w.file.Sync()
+	}
+	w.dirty = true
+	return nil
+}
+
+// Size возвращает размер журнала в байтах. Значение можно передать в TruncateFront после снимка.
+func (w *WAL) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Replay по порядку передает fn данные всех записей журнала
+func (w *WAL) Replay(fn func(payload []byte) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r := bufio.NewReader(io.NewSectionReader(w.file, 0, w.size))
+	for {
+		payload, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(payload); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadFront возвращает до n первых записей журнала и их размер в байтах, который после обработки записей
+// передается в TruncateFront. Журнал, в отличие от Replay, блокируется только на время чтения.
+func (w *WAL) ReadFront(n int) ([][]byte, int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, 0, os.ErrClosed
+	}
+	r := bufio.NewReader(io.NewSectionReader(w.file, 0, w.size))
+	var records [][]byte
+	var size int64
+	for len(records) < n {
+		payload, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, payload)
+		size += int64(walHeaderSize + len(payload))
+	}
+	return records, size, nil
+}
+
+// TruncateFront удаляет из журнала первые off байт - записи, уже попавшие в снимок. Записи,
+// добавленные после off, сохраняются.
+func (w *WAL) TruncateFront(off int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	if off <= 0 {
+		return nil
+	}
+	if off >= w.size {
+		if err := w.file.Truncate(0); err != nil {
+			return err
+		}
+		w.size = 0
+		w.dirty = false
+		return w.file.Sync()
+	}
+
+	// хвост переписывается в новый файл, который атомарно заменяет журнал
+	tail := make([]byte, w.size-off)
+	if _, err := w.file.ReadAt(tail, off); err != nil {
+		return err
+	}
+	dir := filepath.Dir(w.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(w.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(tail); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	_ = w.file.Close()
+	w.file = tmp
+	w.size = int64(len(tail))
+	w.dirty = false
+	return syncDir(dir)
+}
+
+// Sync принудительно сбрасывает журнал на диск
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.dirty = false
+	return w.file.Sync()
+}
+
+// Close останавливает периодический fsync и закрывает файл журнала
+func (w *WAL) Close() error {
+	if w.stop != nil {
+		select {
+		case <-w.stop:
+		default:
+			close(w.stop)
+		}
+		<-w.done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.policy != WALSyncNever {
+		if err := w.file.Sync(); err != nil {
+			_ = w.file.Close()
+			return err
+		}
+	}
+	return w.file.Close()
+}
+
+func (w *WAL) syncLoop(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.dirty && !w.closed {
+				if err := w.file.Sync(); err != nil {
+					logger.Log.Error("Error syncing wal", zap.String("file", w.path), zap.Error(err))
+				} else {
+					w.dirty = false
+				}
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// validRecordsSize возвращает длину начала файла, состоящего из целых записей с верной контрольной суммой
+func validRecordsSize(file *os.File) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(file)
+	var size int64
+	for {
+		payload, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		if errors.Is(err, ErrCorrupted) {
+			logger.Log.Warn("Discard damaged wal tail", zap.String("file", file.Name()),
+				zap.Int64("offset", size), zap.Error(err))
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += int64(walHeaderSize + len(payload))
+	}
+}
+
+func truncateTail(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == size {
+		return nil
+	}
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// readRecord читает одну запись. io.EOF означает, что записей больше нет, ErrCorrupted - что запись
+// оборвана или не совпадает контрольная сумма.
+func readRecord(r io.Reader) ([]byte, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: truncated record header", ErrCorrupted)
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > walMaxRecord {
+		return nil, fmt.Errorf("%w: record length %d", ErrCorrupted, length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: truncated record", ErrCorrupted)
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("%w: record checksum mismatch", ErrCorrupted)
+	}
+	return payload, nil
+}
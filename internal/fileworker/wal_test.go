@@ -0,0 +1,150 @@
+package fileworker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replayAll(t *testing.T, w *WAL) []string {
+	t.Helper()
+	var got []string
+	require.NoError(t, w.Replay(func(payload []byte) error {
+		got = append(got, string(payload))
+		return nil
+	}))
+	return got
+}
+
+func TestParseWALSyncPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    WALSyncPolicy
+		wantErr bool
+	}{
+		{in: "always", want: WALSyncAlways},
+		{in: "interval", want: WALSyncInterval},
+		{in: "never", want: WALSyncNever},
+		{in: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseWALSyncPolicy(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWAL_AppendReplay(t *testing.T) {
+	for _, policy := range []WALSyncPolicy{WALSyncAlways, WALSyncInterval, WALSyncNever} {
+		path := filepath.Join(t.TempDir(), "metrics.wal")
+		w, err := OpenWAL(path, policy, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, w.Append([]byte("one")))
+		require.NoError(t, w.Append([]byte("two")))
+		require.NoError(t, w.Close())
+
+		w, err = OpenWAL(path, policy, 10*time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"one", "two"}, replayAll(t, w))
+		require.NoError(t, w.Close())
+	}
+}
+
+func TestWAL_DiscardsDamagedTail(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(data []byte) []byte
+	}{
+		{name: "torn header", damage: func(data []byte) []byte { return data[:walHeaderSize+len("kept")+3] }},
+		{name: "torn payload", damage: func(data []byte) []byte { return data[:len(data)-2] }},
+		{name: "checksum mismatch", damage: func(data []byte) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.wal")
+			w, err := OpenWAL(path, WALSyncAlways, 0)
+			require.NoError(t, err)
+			require.NoError(t, w.Append([]byte("kept")))
+			require.NoError(t, w.Append([]byte("damaged")))
+			require.NoError(t, w.Close())
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, tt.damage(data), 0644))
+
+			w, err = OpenWAL(path, WALSyncAlways, 0)
+			require.NoError(t, err)
+			defer w.Close()
+			assert.Equal(t, []string{"kept"}, replayAll(t, w))
+
+			// новая запись дописывается после целой части, а не после мусора
+			require.NoError(t, w.Append([]byte("next")))
+			assert.Equal(t, []string{"kept", "next"}, replayAll(t, w))
+		})
+	}
+}
+
+func TestWAL_TruncateFront(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	w, err := OpenWAL(path, WALSyncAlways, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Append([]byte("in snapshot")))
+	off := w.Size()
+	require.NoError(t, w.Append([]byte("after snapshot")))
+
+	require.NoError(t, w.TruncateFront(off))
+	assert.Equal(t, []string{"after snapshot"}, replayAll(t, w))
+	require.NoError(t, w.Append([]byte("later")))
+	require.NoError(t, w.Close())
+
+	w, err = OpenWAL(path, WALSyncAlways, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"after snapshot", "later"}, replayAll(t, w))
+
+	require.NoError(t, w.TruncateFront(w.Size()))
+	assert.Empty(t, replayAll(t, w))
+	assert.Equal(t, int64(0), w.Size())
+	require.NoError(t, w.Close())
+}
+
+func TestWAL_ReadFront(t *testing.T) {
+	w, err := OpenWAL(filepath.Join(t.TempDir(), "queue.wal"), WALSyncAlways, 0)
+	require.NoError(t, err)
+	defer w.Close()
+
+	records, size, err := w.ReadFront(10)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	assert.Zero(t, size)
+
+	for _, r := range []string{"one", "two", "three"} {
+		require.NoError(t, w.Append([]byte(r)))
+	}
+	records, size, err = w.ReadFront(2)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("one"), []byte("two")}, records)
+
+	require.NoError(t, w.TruncateFront(size))
+	records, _, err = w.ReadFront(10)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("three")}, records)
+}
+
+func TestOpenWAL_InvalidInterval(t *testing.T) {
+	_, err := OpenWAL(filepath.Join(t.TempDir(), "metrics.wal"), WALSyncInterval, 0)
+	assert.Error(t, err)
+}
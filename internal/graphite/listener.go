@@ -0,0 +1,228 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+const (
+	maxLineSize  = 64 * 1024
+	maxBatchSize = 500
+	writeTimeout = 10 * time.Second
+)
+
+// Storage - хранилище, в которое записываются принятые метрики
+type Storage interface {
+	UpdateMetrics(ctx context.Context, values []models.Metrics) error
+}
+
+// Listener принимает TCP-соединения с метриками Graphite. Число одновременно обслуживаемых
+// соединений ограничено, соединение без данных дольше idleTimeout закрывается.
+type Listener struct {
+	ln          net.Listener
+	strg        Storage
+	rules       *Rules
+	sem         chan struct{}
+	idleTimeout time.Duration
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	malformed atomic.Uint64
+}
+
+// Listen открывает TCP-сокет на адресе addr
+func Listen(addr string, strg Storage, rules *Rules, maxConns int, idleTimeout time.Duration) (*Listener, error) {
+	if maxConns <= 0 {
+		return nil, fmt.Errorf("graphite: max connections must be positive, got %d", maxConns)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{
+		ln:          ln,
+		strg:        strg,
+		rules:       rules,
+		sem:         make(chan struct{}, maxConns),
+		idleTimeout: idleTimeout,
+		conns:       make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Addr - адрес, на котором открыт сокет
+func (l *Listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Close закрывает сокет слушателя, для которого не запускался Serve
+func (l *Listener) Close() error {
+	return l.ln.Close()
+}
+
+// Malformed - число отброшенных некорректных строк
+func (l *Listener) Malformed() uint64 {
+	return l.malformed.Load()
+}
+
+// Serve принимает соединения до отмены ctx. При остановке закрывает сокет и открытые соединения
+// и дожидается завершения их обработчиков.
+func (l *Listener) Serve(ctx context.Context) {
+	var wg sync.WaitGroup
+	go func() {
+		<-ctx.Done()
+		if err := l.ln.Close(); err != nil {
+			logger.Log.Error("Error closing graphite listener", zap.Error(err))
+		}
+		l.mu.Lock()
+		for c := range l.conns {
+			_ = c.Close()
+		}
+		l.conns = nil
+		l.mu.Unlock()
+	}()
+
+	for {
+		// слот берется до Accept: лишние клиенты ждут в очереди ядра, а не в горутинах
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		conn, err := l.ln.Accept()
+		if err != nil {
+			<-l.sem
+			if errors.Is(err, net.ErrClosed) {
+				wg.Wait()
+				return
+			}
+			logger.Log.Error("Error accepting graphite connection", zap.Error(err))
+			continue
+		}
+		if !l.track(conn) {
+			_ = conn.Close()
+			<-l.sem
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-l.sem }()
+			defer l.untrack(conn)
+			l.handle(ctx, conn)
+		}()
+	}
+}
+
+// track регистрирует соединение, если listener еще не остановлен
+func (l *Listener) track(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns == nil {
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	return true
+}
+
+func (l *Listener) untrack(conn net.Conn) {
+	l.mu.Lock()
+	delete(l.conns, conn)
+	l.mu.Unlock()
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Log.Debug("Error closing graphite connection", zap.Error(err))
+	}
+}
+
+func (l *Listener) handle(ctx context.Context, conn net.Conn) {
+	reader := bufio.NewReaderSize(conn, maxLineSize)
+	batch := make([]models.Metrics, 0, maxBatchSize)
+	line := 0
+	for {
+		if l.idleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(l.idleTimeout))
+		}
+		data, err := reader.ReadSlice('\n')
+		if len(data) > 0 && (err == nil || errors.Is(err, io.EOF)) {
+			line++
+			if m, ok := l.parse(conn, line, string(data)); ok {
+				batch = append(batch, m)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			line++
+			l.reject(conn, line, errors.New("line too long"))
+			if err = l.skipLine(reader); err == nil {
+				continue
+			}
+		}
+		// пишем пакет, когда он заполнен или прочитанные данные закончились
+		if len(batch) > 0 && (len(batch) == maxBatchSize || reader.Buffered() == 0 || err != nil) {
+			l.write(ctx, batch)
+			batch = make([]models.Metrics, 0, maxBatchSize)
+		}
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				logger.Log.Debug("Graphite connection idle timeout", zap.String("remote", conn.RemoteAddr().String()))
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Log.Error("Error reading graphite connection", zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+// skipLine дочитывает слишком длинную строку до конца
+func (l *Listener) skipLine(reader *bufio.Reader) error {
+	for {
+		_, err := reader.ReadSlice('\n')
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return err
+		}
+	}
+}
+
+func (l *Listener) parse(conn net.Conn, line int, data string) (models.Metrics, bool) {
+	if strings.TrimSpace(data) == "" {
+		return models.Metrics{}, false
+	}
+	m, err := ParseLine(data, l.rules)
+	if err != nil {
+		l.reject(conn, line, err)
+		return models.Metrics{}, false
+	}
+	return m, true
+}
+
+func (l *Listener) reject(conn net.Conn, line int, err error) {
+	total := l.malformed.Add(1)
+	logger.Log.Warn("Malformed graphite line",
+		zap.String("remote", conn.RemoteAddr().String()),
+		zap.Int("line", line),
+		zap.Uint64("malformed_total", total),
+		zap.Error(err))
+}
+
+func (l *Listener) write(ctx context.Context, batch []models.Metrics) {
+	// остановка не должна терять уже прочитанные метрики
+	timeout, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+	if err := l.strg.UpdateMetrics(timeout, batch); err != nil {
+		logger.Log.Error("Error writing graphite metrics", zap.Int("count", len(batch)), zap.Error(err))
+	}
+}
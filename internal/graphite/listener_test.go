@@ -0,0 +1,115 @@
+package graphite
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+func startListener(t *testing.T, strg Storage, maxConns int, idle time.Duration) (*Listener, func()) {
+	rules, err := NewRules([]string{"*.requests"})
+	require.NoError(t, err)
+	l, err := Listen("127.0.0.1:0", strg, rules, maxConns, idle)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Serve(ctx)
+	}()
+	return l, func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestListener_WritesMetrics(t *testing.T) {
+	strg := storage.NewMemStorage()
+	l, stop := startListener(t, strg, 2, time.Second)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("app.load 0.5 1700000000\nbroken\n\napp.requests 2 1700000000\n" +
+		strings.Repeat("x", maxLineSize+10) + "\napp.requests 3 1700000001\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	require.Eventually(t, func() bool {
+		metrics, _ := strg.GetAllMetrics(context.Background())
+		m, ok := metrics[models.MetricKey{MType: models.Counter, ID: "app.requests"}]
+		return ok && *m.Delta == 5
+	}, time.Second, 10*time.Millisecond)
+	stop()
+
+	metrics, err := strg.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, *metrics[models.MetricKey{MType: models.Gauge, ID: "app.load"}].Value)
+	assert.Equal(t, models.Counter, metrics[models.MetricKey{MType: models.Counter, ID: "app.requests"}].MType)
+	assert.Equal(t, uint64(2), l.Malformed())
+}
+
+type sliceStorage struct {
+	mu      sync.Mutex
+	metrics []models.Metrics
+}
+
+func (s *sliceStorage) UpdateMetrics(_ context.Context, values []models.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, values...)
+	return nil
+}
+
+func (s *sliceStorage) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.metrics)
+}
+
+func TestListener_BoundedConnections(t *testing.T) {
+	strg := &sliceStorage{}
+	l, stop := startListener(t, strg, 1, 200*time.Millisecond)
+	defer stop()
+
+	// первое соединение занимает единственный слот, пока не истечет idle timeout
+	first, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	_, err = first.Write([]byte("a.load 1 1\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return strg.count() == 1 }, time.Second, 10*time.Millisecond)
+
+	second, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	_, err = second.Write([]byte("b.load 1 1\n"))
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, strg.count(), "second connection must wait for a free slot")
+
+	// после idle timeout первое соединение закрывается сервером и второе обслуживается
+	require.Eventually(t, func() bool { return strg.count() == 2 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestListener_Close(t *testing.T) {
+	l, err := Listen("127.0.0.1:0", storage.NewMemStorage(), nil, 1, time.Second)
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	// порт освобожден и может быть открыт снова
+	l, err = Listen(addr, storage.NewMemStorage(), nil, 1, time.Second)
+	require.NoError(t, err)
+	assert.NoError(t, l.Close())
+}
@@ -0,0 +1,93 @@
+// Package graphite принимает метрики в формате Graphite plaintext (path value timestamp) по TCP.
+// По умолчанию метрики сохраняются как gauge, пути, подходящие под правила, - как счетчики.
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// ParseLine разбирает строку "path value [timestamp]". Timestamp проверяется, но не сохраняется.
+func ParseLine(line string, rules *Rules) (models.Metrics, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return models.Metrics{}, fmt.Errorf("expected \"path value timestamp\", got %d fields", len(fields))
+	}
+	name := fields[0]
+
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return models.Metrics{}, fmt.Errorf("invalid value %q", fields[1])
+	}
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return models.Metrics{}, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+	}
+
+	if !rules.IsCounter(name) {
+		return models.Metrics{ID: name, MType: models.Gauge, Value: &v}, nil
+	}
+	if v != math.Trunc(v) || v > math.MaxInt64 || v < math.MinInt64 {
+		return models.Metrics{}, fmt.Errorf("counter %s: value %q is not an integer", name, fields[1])
+	}
+	delta := int64(v)
+	return models.Metrics{ID: name, MType: models.Counter, Delta: &delta}, nil
+}
+
+// Rules - шаблоны путей, значения которых сохраняются как счетчики. Шаблон сопоставляется
+// по сегментам, разделенным точкой; в сегменте допустимы *, ? и [...], как в path.Match.
+type Rules struct {
+	patterns [][]string
+}
+
+// NewRules создает правила из шаблонов вида "servers.*.requests"
+func NewRules(patterns []string) (*Rules, error) {
+	r := &Rules{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		segments := strings.Split(p, ".")
+		for _, s := range segments {
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, fmt.Errorf("invalid counter pattern %q: %w", p, err)
+			}
+		}
+		r.patterns = append(r.patterns, segments)
+	}
+	return r, nil
+}
+
+// IsCounter сообщает, подходит ли путь под одно из правил
+func (r *Rules) IsCounter(name string) bool {
+	if r == nil || len(r.patterns) == 0 {
+		return false
+	}
+	segments := strings.Split(name, ".")
+	for _, p := range r.patterns {
+		if matchSegments(p, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i := range pattern {
+		// ошибки синтаксиса шаблона проверены в NewRules
+		if ok, _ := path.Match(pattern[i], segments[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package graphite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+func TestParseLine(t *testing.T) {
+	rules, err := NewRules([]string{"servers.*.requests", "app.err[os]rs"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		line    string
+		want    models.Metrics
+		wantErr bool
+	}{
+		{line: "servers.a.load 0.5 1700000000\n", want: models.Metrics{ID: "servers.a.load", MType: models.Gauge, Value: toPtr(0.5)}},
+		{line: "servers.a.load 2", want: models.Metrics{ID: "servers.a.load", MType: models.Gauge, Value: toPtr(2.0)}},
+		{line: "servers.a.requests 15 1700000000", want: models.Metrics{ID: "servers.a.requests", MType: models.Counter, Delta: toPtr(int64(15))}},
+		{line: "app.errors 3 -1", want: models.Metrics{ID: "app.errors", MType: models.Counter, Delta: toPtr(int64(3))}},
+		{line: "servers.a.b.requests 1 1", want: models.Metrics{ID: "servers.a.b.requests", MType: models.Gauge, Value: toPtr(1.0)}},
+		{line: "servers.a.requests 1.5 1700000000", wantErr: true},
+		{line: "servers.a.load", wantErr: true},
+		{line: "servers.a.load abc 1700000000", wantErr: true},
+		{line: "servers.a.load 1 now", wantErr: true},
+		{line: "servers.a.load 1 1 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseLine(tt.line, rules)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewRules_Invalid(t *testing.T) {
+	_, err := NewRules([]string{"servers.[.requests"})
+	assert.Error(t, err)
+}
+
+func TestRules_Nil(t *testing.T) {
+	var rules *Rules
+	assert.False(t, rules.IsCounter("a.b"))
+}
@@ -3,9 +3,10 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/ValentinaKh/go-metrics/internal/audit"
+	"github.com/ValentinaKh/go-metrics/internal/codec"
 	"github.com/ValentinaKh/go-metrics/internal/logger"
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
@@ -22,7 +24,7 @@ type Service interface {
 	UpdateMetric(ctx context.Context, metric models.Metrics) error
 	UpdateMetrics(ctx context.Context, metrics []models.Metrics) error
 	GetMetric(ctx context.Context, metric models.Metrics) (*models.Metrics, error)
-	GetAllMetrics(ctx context.Context) (map[string]string, error)
+	GetAllMetrics(ctx context.Context) (map[models.MetricKey]models.MetricSummary, error)
 }
 
 // MetricsHandler - слушатель для записи/обновления метрики в формате /update/counter/PauseTotalNs/721200
@@ -50,16 +52,23 @@ func MetricsHandler(ctx context.Context, service Service) http.HandlerFunc {
 	}
 }
 
-// JSONUpdateMetricHandler слушатель для записи/обновления метрики в формате JSON
+// JSONUpdateMetricHandler слушатель для записи/обновления метрики. Формат тела (JSON, MessagePack, Protobuf)
+// определяется по Content-Type
 func JSONUpdateMetricHandler(ctx context.Context, service Service, p audit.Publisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
+		c, err := codec.ForContentType(r.Header.Get("Content-Type"))
+		if err != nil {
+			logger.Log.Debug("UpdateMetric", zap.Error(err))
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
 		var request models.Metrics
-		dec := json.NewDecoder(r.Body)
-		if err := dec.Decode(&request); err != nil {
-			logger.Log.Debug("cannot decode request JSON body", zap.Error(err))
+		if err := decodeBody(r, c, &request); err != nil {
+			logger.Log.Debug("cannot decode request body", zap.String("codec", c.Name()), zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -108,18 +117,26 @@ func GetMetricHandler(ctx context.Context, service Service) http.HandlerFunc {
 	}
 }
 
-// GetJSONMetricHandler слушатель для получения метрик в формате JSON
+// GetJSONMetricHandler слушатель для получения метрик. Формат запроса определяется по Content-Type,
+// формат ответа - по Accept
 func GetJSONMetricHandler(ctx context.Context, service Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
-		w.Header().Set("Content-Type", "application/json")
+		c, err := codec.ForContentType(r.Header.Get("Content-Type"))
+		if err != nil {
+			logger.Log.Debug("GetMetric", zap.Error(err))
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		// Если клиент не указал Accept, отвечаем в формате запроса
+		rc := codec.ForAccept(r.Header.Get("Accept"), c)
+		w.Header().Set("Content-Type", rc.ContentType())
 
 		var request models.Metrics
-		dec := json.NewDecoder(r.Body)
-		if err := dec.Decode(&request); err != nil {
-			logger.Log.Debug("cannot decode request JSON body", zap.Error(err))
+		if err := decodeBody(r, c, &request); err != nil {
+			logger.Log.Debug("cannot decode request body", zap.String("codec", c.Name()), zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -132,7 +149,7 @@ func GetJSONMetricHandler(ctx context.Context, service Service) http.HandlerFunc
 			return
 		}
 
-		rs, err := json.Marshal(value)
+		rs, err := rc.Marshal(value)
 		if err != nil {
 			logger.Log.Error("GetMetric", zap.Error(err))
 
@@ -169,8 +186,20 @@ func GetAllMetricsHandler(ctx context.Context, service Service) http.HandlerFunc
 		if err != nil {
 			return
 		}
-		for name, m := range values {
-			_, err := fmt.Fprintf(w, `<li><strong>%s</strong> %s</li>`, name, m)
+		keys := make([]models.MetricKey, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Less(keys[j])
+		})
+		for _, k := range keys {
+			m := values[k]
+			stale := ""
+			if m.Stale {
+				stale = ` <em>stale</em>`
+			}
+			_, err := fmt.Fprintf(w, `<li><strong>%s</strong> %s %s%s</li>`, k.ID, k.MType, m.Value, stale)
 			if err != nil {
 				return
 			}
@@ -182,16 +211,22 @@ func GetAllMetricsHandler(ctx context.Context, service Service) http.HandlerFunc
 	}
 }
 
-// JSONUpdateMetricsHandler слушатель для записи/обновления метрик в формате JSON
+// JSONUpdateMetricsHandler слушатель для записи/обновления метрик. Формат тела определяется по Content-Type
 func JSONUpdateMetricsHandler(ctx context.Context, service Service, p audit.Publisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
+		c, err := codec.ForContentType(r.Header.Get("Content-Type"))
+		if err != nil {
+			logger.Log.Error("UpdateMetrics", zap.Error(err))
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
 		var request []models.Metrics
-		dec := json.NewDecoder(r.Body)
-		if err := dec.Decode(&request); err != nil {
-			logger.Log.Error("cannot decode request JSON body", zap.Error(err))
+		if err := decodeBody(r, c, &request); err != nil {
+			logger.Log.Error("cannot decode request body", zap.String("codec", c.Name()), zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -209,6 +244,15 @@ func JSONUpdateMetricsHandler(ctx context.Context, service Service, p audit.Publ
 	}
 }
 
+// decodeBody читает тело запроса и декодирует его в формате c
+func decodeBody(r *http.Request, c codec.Codec, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(body, v)
+}
+
 func parse(metricType, name, value string) (*models.Metrics, error) {
 	var metric models.Metrics
 	switch metricType {
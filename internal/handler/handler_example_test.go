@@ -78,8 +78,8 @@ func ExampleGetMetricHandler() {
 
 func ExampleGetAllMetricsHandler() {
 	handler := GetAllMetricsHandler(context.TODO(), &MockMetricsService{
-		GetAllMetricsFunc: func() map[string]string {
-			return map[string]string{"cpu": "0.54"}
+		GetAllMetricsFunc: func() map[models.MetricKey]models.MetricSummary {
+			return map[models.MetricKey]models.MetricSummary{{MType: models.Gauge, ID: "cpu"}: {Value: "0.54"}}
 		},
 	})
 	r := chi.NewRouter()
@@ -14,13 +14,15 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/ValentinaKh/go-metrics/internal/audit"
+	"github.com/ValentinaKh/go-metrics/internal/codec"
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
 
 type MockMetricsService struct {
 	HandleFunc        func(metric models.Metrics) error
 	GetMetricFunc     func(metric models.Metrics) (*models.Metrics, error)
-	GetAllMetricsFunc func() map[string]string
+	GetAllMetricsFunc func() map[models.MetricKey]models.MetricSummary
+	UpdateMetricsFunc func(metrics []models.Metrics) error
 }
 
 func (m *MockMetricsService) UpdateMetric(_ context.Context, metric models.Metrics) error {
@@ -34,11 +36,14 @@ func (m *MockMetricsService) GetMetric(_ context.Context, metric models.Metrics)
 	return m.GetMetricFunc(metric)
 }
 
-func (m *MockMetricsService) GetAllMetrics(_ context.Context) (map[string]string, error) {
+func (m *MockMetricsService) GetAllMetrics(_ context.Context) (map[models.MetricKey]models.MetricSummary, error) {
 	return m.GetAllMetricsFunc(), nil
 }
 
 func (m *MockMetricsService) UpdateMetrics(_ context.Context, metrics []models.Metrics) error {
+	if m.UpdateMetricsFunc != nil {
+		return m.UpdateMetricsFunc(metrics)
+	}
 	return nil
 }
 
@@ -220,21 +225,41 @@ func Test_GetAllMetricsHandler(t *testing.T) {
 		{
 			name: "positive test",
 			args: args{&MockMetricsService{
-				GetAllMetricsFunc: func() map[string]string {
-					return map[string]string{"cpu": "0.54"}
+				GetAllMetricsFunc: func() map[models.MetricKey]models.MetricSummary {
+					return map[models.MetricKey]models.MetricSummary{{MType: models.Gauge, ID: "cpu"}: {Value: "0.54"}}
 				},
 			},
 			},
 			want: want{
 				code:     200,
-				response: "<!DOCTYPE html>\n<html><head><title>Metrics</title></head><body>\n<h1>Metrics</h1>\n<ul><li><strong>cpu</strong> 0.54</li></ul></body></html>",
+				response: "<!DOCTYPE html>\n<html><head><title>Metrics</title></head><body>\n<h1>Metrics</h1>\n<ul><li><strong>cpu</strong> gauge 0.54</li></ul></body></html>",
+			},
+		},
+		{
+			name: "same name, different types, stale",
+			args: args{&MockMetricsService{
+				GetAllMetricsFunc: func() map[models.MetricKey]models.MetricSummary {
+					return map[models.MetricKey]models.MetricSummary{
+						{MType: models.Gauge, ID: "requests"}:   {Value: "1.5", Stale: true},
+						{MType: models.Counter, ID: "requests"}: {Value: "10"},
+						{MType: models.Gauge, ID: "cpu"}:        {Value: "0.54"},
+					}
+				},
+			},
+			},
+			want: want{
+				code: 200,
+				response: "<!DOCTYPE html>\n<html><head><title>Metrics</title></head><body>\n<h1>Metrics</h1>\n<ul>" +
+					"<li><strong>cpu</strong> gauge 0.54</li>" +
+					"<li><strong>requests</strong> counter 10</li>" +
+					"<li><strong>requests</strong> gauge 1.5 <em>stale</em></li></ul></body></html>",
 			},
 		},
 		{
 			name: "empty map",
 			args: args{&MockMetricsService{
-				GetAllMetricsFunc: func() map[string]string {
-					return map[string]string{}
+				GetAllMetricsFunc: func() map[models.MetricKey]models.MetricSummary {
+					return map[models.MetricKey]models.MetricSummary{}
 				},
 			},
 			},
@@ -457,3 +482,89 @@ func Test_GetJsonMetricHandler(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetJSONMetricHandler_Codecs(t *testing.T) {
+	var delta int64 = 500
+	service := &MockMetricsService{
+		GetMetricFunc: func(metric models.Metrics) (*models.Metrics, error) {
+			return &models.Metrics{ID: metric.ID, MType: metric.MType, Delta: &delta}, nil
+		},
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		accept      string
+		wantCode    int
+		wantCodec   codec.Codec
+	}{
+		{name: "protobuf request", contentType: "application/x-protobuf", wantCode: 200, wantCodec: codec.Protobuf},
+		{name: "msgpack request, json response", contentType: "application/msgpack", accept: "application/json",
+			wantCode: 200, wantCodec: codec.JSON},
+		{name: "json request, protobuf response", contentType: "application/json", accept: "application/x-protobuf",
+			wantCode: 200, wantCodec: codec.Protobuf},
+		{name: "unsupported media type", contentType: "text/xml", wantCode: 415},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqCodec, err := codec.ForContentType(tt.contentType)
+			if err != nil {
+				reqCodec = codec.JSON
+			}
+			body, err := reqCodec.Marshal(models.Metrics{ID: "PollCount", MType: models.Counter})
+			require.NoError(t, err)
+
+			request := httptest.NewRequest(http.MethodPost, "/value/", bytes.NewReader(body))
+			request.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			GetJSONMetricHandler(context.TODO(), service).ServeHTTP(w, request)
+
+			res := w.Result()
+			defer func(r *http.Response) {
+				err := r.Body.Close()
+				if err != nil {
+					panic(err)
+				}
+			}(res)
+			require.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCodec == nil {
+				return
+			}
+			assert.Equal(t, tt.wantCodec.ContentType(), res.Header.Get("Content-Type"))
+
+			data, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			var got models.Metrics
+			require.NoError(t, tt.wantCodec.Unmarshal(data, &got))
+			assert.Equal(t, models.Metrics{ID: "PollCount", MType: models.Counter, Delta: &delta}, got)
+		})
+	}
+}
+
+func TestJSONUpdateMetricsHandler_Codecs(t *testing.T) {
+	value := 1.5
+	batch := []models.Metrics{{ID: "Alloc", MType: models.Gauge, Value: &value}}
+	for _, c := range []codec.Codec{codec.JSON, codec.MsgPack, codec.Protobuf} {
+		t.Run(c.Name(), func(t *testing.T) {
+			var received []models.Metrics
+			service := &MockMetricsService{
+				UpdateMetricsFunc: func(metrics []models.Metrics) error {
+					received = metrics
+					return nil
+				},
+			}
+			body, err := c.Marshal(batch)
+			require.NoError(t, err)
+
+			request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			request.Header.Set("Content-Type", c.ContentType())
+			w := httptest.NewRecorder()
+			JSONUpdateMetricsHandler(context.TODO(), service, audit.NewAuditor(context.Background(), 5)).ServeHTTP(w, request)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, batch, received)
+		})
+	}
+}
@@ -2,31 +2,72 @@ package handler
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"net/http"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
 
 type HealthChecker interface {
-	CheckDB(ctx context.Context) error
+	CheckConnections(ctx context.Context) []models.ConnectionStatus
 }
 
-// HealthHandler возвращает состояние БД
+// HealthHandler возвращает состояние каждого соединения с БД. Ошибка возвращается, только если недоступна
+// основная база: без реплик чтение продолжает работать через нее.
 func HealthHandler(ctx context.Context, h HealthChecker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		timeout, cancel := context.WithTimeout(ctx, 1*time.Second)
 		defer cancel()
 
-		w.Header().Set("Content-Type", "text/html")
-		err := h.CheckDB(timeout)
+		statuses := h.CheckConnections(timeout)
+		status := http.StatusOK
+		for _, s := range statuses {
+			if s.Healthy {
+				continue
+			}
+			logger.Log.Error("ping error", zap.String("name", s.Name), zap.String("role", s.Role), zap.String("error", s.Error))
+			if s.Role == models.RolePrimary {
+				status = http.StatusInternalServerError
+			}
+		}
+
+		rs, err := json.Marshal(statuses)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, err = w.Write(rs)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// DBStatsSource - источник статистики пула соединений, например *sql.DB
+type DBStatsSource interface {
+	Stats() sql.DBStats
+}
+
+// DBStatsHandler возвращает статистику пула соединений с БД в JSON
+func DBStatsHandler(s DBStatsSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rs, err := json.Marshal(s.Stats())
 		if err != nil {
-			logger.Log.Error("ping error", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(rs)
+		if err != nil {
+			return
+		}
 	}
 }
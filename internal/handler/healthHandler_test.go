@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+type staticStats sql.DBStats
+
+func (s staticStats) Stats() sql.DBStats {
+	return sql.DBStats(s)
+}
+
+func TestDBStatsHandler(t *testing.T) {
+	stats := staticStats{MaxOpenConnections: 20, OpenConnections: 3, InUse: 2, Idle: 1, WaitCount: 7, WaitDuration: time.Second}
+
+	w := httptest.NewRecorder()
+	DBStatsHandler(stats).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/db/stats", nil))
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	var got sql.DBStats
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+	assert.Equal(t, sql.DBStats(stats), got)
+}
+
+type staticHealth []models.ConnectionStatus
+
+func (s staticHealth) CheckConnections(context.Context) []models.ConnectionStatus {
+	return s
+}
+
+func TestHealthHandler(t *testing.T) {
+	primary := models.ConnectionStatus{Name: models.RolePrimary, Role: models.RolePrimary, Healthy: true}
+	replica := models.ConnectionStatus{Name: "replica-1", Role: models.RoleReplica, Healthy: true}
+	down := func(s models.ConnectionStatus) models.ConnectionStatus {
+		s.Healthy = false
+		s.Error = "connection refused"
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		statuses   staticHealth
+		wantStatus int
+	}{
+		{name: "primary only", statuses: staticHealth{primary}, wantStatus: http.StatusOK},
+		{name: "all healthy", statuses: staticHealth{primary, replica}, wantStatus: http.StatusOK},
+		{name: "replica down", statuses: staticHealth{primary, down(replica)}, wantStatus: http.StatusOK},
+		{name: "primary down", statuses: staticHealth{down(primary), replica}, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			HealthHandler(context.Background(), tt.statuses).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+			var got []models.ConnectionStatus
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, []models.ConnectionStatus(tt.statuses), got)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/audit"
+	"github.com/ValentinaKh/go-metrics/internal/influx"
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+)
+
+// InfluxWriteHandler слушатель для записи метрик в формате InfluxDB line protocol. Запрос применяется
+// целиком: при ошибке разбора ничего не записывается, а в ответе указывается номер строки.
+func InfluxWriteHandler(ctx context.Context, service Service, p audit.Publisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		metrics, err := influx.Parse(r.Body)
+		if err != nil {
+			logger.Log.Debug("InfluxWrite", zap.Error(err))
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(metrics) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		errU := service.UpdateMetrics(timeout, metrics)
+		if errU != nil {
+			logger.Log.Error("InfluxWrite", zap.Error(errU))
+
+			http.Error(w, errU.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		p.Notify(metrics, r.RemoteAddr)
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/audit"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func TestInfluxWriteHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		updateErr error
+		wantCode  int
+		wantBody  string
+		wantIDs   []string
+	}{
+		{
+			name:     "writes fields",
+			body:     "cpu,host=a usage=0.5,requests=3i 1700000000\nmem free=10",
+			wantCode: http.StatusNoContent,
+			wantIDs:  []string{"cpu.usage", "cpu.requests", "mem.free"},
+		},
+		{
+			name:     "empty body",
+			body:     "",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "parse error reports line",
+			body:     "cpu usage=0.5\ncpu usage=oops",
+			wantCode: http.StatusBadRequest,
+			wantBody: "line 2",
+		},
+		{
+			name:      "storage error",
+			body:      "cpu usage=0.5",
+			updateErr: errors.New("incorrect type"),
+			wantCode:  http.StatusBadRequest,
+			wantBody:  "incorrect type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []models.Metrics
+			service := &MockMetricsService{UpdateMetricsFunc: func(metrics []models.Metrics) error {
+				got = metrics
+				return tt.updateErr
+			}}
+
+			request := httptest.NewRequest(http.MethodPost, "/api/influx/write", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			InfluxWriteHandler(context.TODO(), service, audit.NewAuditor(context.Background(), 5)).ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), tt.wantBody)
+
+			if tt.wantIDs != nil {
+				var ids []string
+				for _, m := range got {
+					ids = append(ids, m.ID)
+				}
+				assert.Equal(t, tt.wantIDs, ids)
+			}
+		})
+	}
+}
@@ -2,66 +2,86 @@
 package middleware
 
 import (
-	"compress/gzip"
-	"github.com/ValentinaKh/go-metrics/internal/pool"
 	"io"
 	"net/http"
-)
-
-// generate:reset
-type GzipWriter struct {
-	s *gzip.Writer
-}
 
-var gzipWriterPool = pool.New(func() *GzipWriter {
-	gw := gzip.NewWriter(io.Discard)
-	return &GzipWriter{s: gw}
-})
+	"github.com/ValentinaKh/go-metrics/internal/compress"
+)
 
+// compressWriter сжимает ответ со статусом 200. Пока тело меньше minSize, оно накапливается в буфере;
+// если ответ так и не достиг порога, он отправляется без сжатия.
 type compressWriter struct {
-	w    http.ResponseWriter
-	zw   *GzipWriter
-	init bool
+	w           http.ResponseWriter
+	enc         compress.Encoding
+	minSize     int
+	status      int
+	wroteHeader bool
+	passthrough bool
+	buf         []byte
+	zw          io.WriteCloser
 }
 
-func newCompressWriter(w http.ResponseWriter) *compressWriter {
-	return &compressWriter{w: w}
-}
-
-func (c *compressWriter) initWriter() {
-	if c.init {
-		return
-	}
-	zw := gzipWriterPool.Get()
-	zw.s.Reset(c.w)
-	c.zw = zw
-	c.init = true
+func newCompressWriter(w http.ResponseWriter, enc compress.Encoding, minSize int) *compressWriter {
+	return &compressWriter{w: w, enc: enc, minSize: minSize}
 }
 
 func (c *compressWriter) Write(p []byte) (int, error) {
-	if !c.init {
-		c.initWriter()
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.passthrough {
+		return c.w.Write(p)
 	}
-	return c.zw.s.Write(p)
+	if c.zw != nil {
+		return c.zw.Write(p)
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.minSize {
+		if err := c.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
 }
 
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if statusCode == http.StatusOK {
-		c.initWriter()
-		c.w.Header().Set("Content-Encoding", "gzip")
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	c.status = statusCode
+	if statusCode != http.StatusOK {
+		c.passthrough = true
+		c.w.WriteHeader(statusCode)
 	}
-	c.w.WriteHeader(statusCode)
+}
+
+// start отправляет заголовки сжатого ответа и сбрасывает накопленный буфер в encoder
+func (c *compressWriter) start() error {
+	c.w.Header().Set("Content-Encoding", c.enc.Name())
+	c.w.Header().Del("Content-Length")
+	c.w.WriteHeader(c.status)
+	c.zw = c.enc.NewWriter(c.w)
+	_, err := c.zw.Write(c.buf)
+	c.buf = nil
+	return err
 }
 
 func (c *compressWriter) Close() error {
-	if !c.init {
+	if !c.wroteHeader || c.passthrough {
 		return nil
 	}
-	err := c.zw.s.Close()
-	gzipWriterPool.Put(c.zw)
-	c.zw = nil
-	c.init = false
-	return err
+	if c.zw == nil {
+		if len(c.buf) < c.minSize {
+			c.w.WriteHeader(c.status)
+			_, err := c.w.Write(c.buf)
+			return err
+		}
+		if err := c.start(); err != nil {
+			return err
+		}
+	}
+	return c.zw.Close()
 }
 
 func (c *compressWriter) Header() http.Header {
@@ -70,11 +90,11 @@ func (c *compressWriter) Header() http.Header {
 
 type compressReader struct {
 	r  io.ReadCloser
-	zr *gzip.Reader
+	zr io.ReadCloser
 }
 
-func newCompressReader(r io.ReadCloser) (*compressReader, error) {
-	zr, err := gzip.NewReader(r)
+func newCompressReader(r io.ReadCloser, enc compress.Encoding) (*compressReader, error) {
+	zr, err := enc.NewReader(r)
 	if err != nil {
 		return nil, err
 	}
@@ -3,13 +3,13 @@ package middleware
 import (
 	"bytes"
 	"crypto/hmac"
-	"crypto/rsa"
 	"encoding/hex"
 	"fmt"
+	"github.com/ValentinaKh/go-metrics/internal/compress"
 	"github.com/ValentinaKh/go-metrics/internal/crypto"
 	"io"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"go.uber.org/zap"
@@ -104,40 +104,65 @@ func LoggingMw(next http.Handler) http.Handler {
 	})
 }
 
+// GzipMW deprecated: используйте CompressMW
 func GzipMW(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return CompressMW(defaultEncodings, 0)(next)
+}
 
-		// Проверяем в каком виде клиент прислал данные
-		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
-			cr, err := newCompressReader(r.Body)
+var defaultEncodings = mustRegistry(compress.NewRegistry(0))
+
+func mustRegistry(r *compress.Registry, err error) *compress.Registry {
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// CompressMW распаковывает тело запроса по Content-Encoding и сжимает ответ алгоритмом, выбранным
+// по Accept-Encoding. Ответы короче minSize байт отправляются без сжатия.
+func CompressMW(encodings *compress.Registry, minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			// Проверяем в каком виде клиент прислал данные
+			enc, err := encodings.ForContentEncoding(r.Header.Get("Content-Encoding"))
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				logger.Log.Error("Unsupported request encoding", zap.Error(err))
+				w.WriteHeader(http.StatusUnsupportedMediaType)
 				return
 			}
-			r.Body = cr
-			defer func(cr *compressReader) {
-				err := cr.Close()
+			if enc != nil {
+				cr, err := newCompressReader(r.Body, enc)
 				if err != nil {
-					logger.Log.Error("Error closing compress reader", zap.Error(err))
+					w.WriteHeader(http.StatusInternalServerError)
+					return
 				}
-			}(cr)
-		}
+				r.Body = cr
+				defer func(cr *compressReader) {
+					err := cr.Close()
+					if err != nil {
+						logger.Log.Error("Error closing compress reader", zap.Error(err))
+					}
+				}(cr)
+			}
 
-		ow := w
-		// Проверяем, что клиент может принять сжатые данные. Если заголовок есть, сжимаем данные
-		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			cw := newCompressWriter(w)
-			ow = cw
-			defer func(cw *compressWriter) {
-				err := cw.Close()
-				if err != nil {
-					logger.Log.Error("Error closing compress writer", zap.Error(err))
-				}
-			}(cw)
-		}
+			ow := w
+			w.Header().Add("Vary", "Accept-Encoding")
+			// Проверяем, что клиент может принять сжатые данные. Если заголовок есть, сжимаем данные
+			if enc := encodings.ForAcceptEncoding(r.Header.Get("Accept-Encoding")); enc != nil {
+				cw := newCompressWriter(w, enc, minSize)
+				ow = cw
+				defer func(cw *compressWriter) {
+					err := cw.Close()
+					if err != nil {
+						logger.Log.Error("Error closing compress writer", zap.Error(err))
+					}
+				}(cw)
+			}
 
-		next.ServeHTTP(ow, r)
-	})
+			next.ServeHTTP(ow, r)
+		})
+	}
 }
 
 func ValidateHashMW(secretKey string) func(http.Handler) http.Handler {
@@ -181,6 +206,45 @@ func ValidateHashMW(secretKey string) func(http.Handler) http.Handler {
 	}
 }
 
+// SignedRequestMW пропускает только запросы между серверами, подписанные ключом secretKey (utils.SignRequest)
+// не раньше maxSkew назад. Запросы без подписи, в отличие от ValidateHashMW, отклоняются.
+func SignedRequestMW(secretKey string, maxSkew time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hash, err := hex.DecodeString(r.Header.Get(hashHeader))
+			if secretKey == "" || err != nil || len(hash) == 0 {
+				http.Error(w, "Request is not signed", http.StatusForbidden)
+				return
+			}
+			timestamp, err := strconv.ParseInt(r.Header.Get(utils.TimestampHeader), 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid request timestamp", http.StatusForbidden)
+				return
+			}
+			if skew := time.Since(time.Unix(timestamp, 0)); skew > maxSkew || skew < -maxSkew {
+				logger.Log.Warn("Signed request is outside of the allowed time window", zap.Duration("skew", skew))
+				http.Error(w, "Request signature expired", http.StatusForbidden)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			_ = r.Body.Close()
+			if !hmac.Equal(hash, utils.RequestHash(secretKey, r.Method, r.URL.Path, timestamp, body)) {
+				logger.Log.Warn("Invalid request signature", zap.String("path", r.URL.Path))
+				http.Error(w, "Invalid request signature", http.StatusForbidden)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func HashResponseMW(secretKey string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -208,9 +272,14 @@ func HashResponseMW(secretKey string) func(http.Handler) http.Handler {
 	}
 }
 
-func DecryptMW(cs *crypto.CryptoService[*rsa.PrivateKey, *rsa.PrivateKey]) func(http.Handler) http.Handler {
+func DecryptMW(cs *crypto.CryptoService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// без ключа тело не читается целиком, чтобы не ломать потоковую загрузку
+			if cs == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
 			body, err := io.ReadAll(r.Body)
 			if err != nil {
 				logger.Log.Error("Failed to read request body", zap.Error(err))
@@ -223,14 +292,11 @@ func DecryptMW(cs *crypto.CryptoService[*rsa.PrivateKey, *rsa.PrivateKey]) func(
 				return
 			}
 
-			var decrypted = body
-			if cs != nil {
-				decrypted, err = cs.Transform(body)
-				if err != nil {
-					logger.Log.Error("Failed to decrypt body", zap.Error(err))
-					http.Error(w, "Failed to decrypt request body", http.StatusBadRequest)
-					return
-				}
+			decrypted, err := cs.Transform(body)
+			if err != nil {
+				logger.Log.Error("Failed to decrypt body", zap.Error(err))
+				http.Error(w, "Failed to decrypt request body", http.StatusBadRequest)
+				return
 			}
 
 			r.Body = io.NopCloser(bytes.NewReader(decrypted))
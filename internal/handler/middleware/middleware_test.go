@@ -7,14 +7,18 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"github.com/ValentinaKh/go-metrics/internal/compress"
 	"github.com/ValentinaKh/go-metrics/internal/crypto"
+	"github.com/ValentinaKh/go-metrics/internal/utils"
 	"io"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -234,6 +238,81 @@ func TestGzipMW(t *testing.T) {
 	})
 }
 
+func TestCompressMW(t *testing.T) {
+	encodings, err := compress.NewRegistry(0)
+	require.NoError(t, err)
+
+	body := strings.Repeat(`{"id":"LastGC","type":"gauge","value":1744184459}`, 4)
+	var received string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = string(b)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+	})
+
+	tests := []struct {
+		name            string
+		minSize         int
+		contentEncoding string
+		acceptEncoding  string
+		wantStatus      int
+		wantEncoding    string
+	}{
+		{name: "zstd", contentEncoding: compress.Zstd, acceptEncoding: "zstd", wantStatus: http.StatusOK, wantEncoding: compress.Zstd},
+		{name: "deflate", contentEncoding: compress.Deflate, acceptEncoding: "deflate", wantStatus: http.StatusOK, wantEncoding: compress.Deflate},
+		{name: "prefers_q", acceptEncoding: "gzip;q=0.5, zstd", wantStatus: http.StatusOK, wantEncoding: compress.Zstd},
+		{name: "below_min_size", minSize: len(body) + 1, acceptEncoding: "gzip", wantStatus: http.StatusOK},
+		{name: "at_min_size", minSize: len(body), acceptEncoding: "gzip", wantStatus: http.StatusOK, wantEncoding: compress.Gzip},
+		{name: "unsupported", contentEncoding: "br", wantStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			reqBody := []byte(body)
+			if tt.contentEncoding != "" {
+				if enc, err := encodings.ForContentEncoding(tt.contentEncoding); err == nil {
+					var buf bytes.Buffer
+					zw := enc.NewWriter(&buf)
+					_, err = zw.Write(reqBody)
+					require.NoError(t, err)
+					require.NoError(t, zw.Close())
+					reqBody = buf.Bytes()
+				}
+			}
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(reqBody))
+			r.Header.Set("Content-Encoding", tt.contentEncoding)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+
+			CompressMW(encodings, tt.minSize)(next).ServeHTTP(w, r)
+
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			assert.Equal(t, body, received)
+			assert.Equal(t, tt.wantEncoding, res.Header.Get("Content-Encoding"))
+
+			var respBody io.Reader = res.Body
+			if tt.wantEncoding != "" {
+				enc, err := encodings.ForContentEncoding(tt.wantEncoding)
+				require.NoError(t, err)
+				zr, err := enc.NewReader(res.Body)
+				require.NoError(t, err)
+				defer zr.Close()
+				respBody = zr
+			}
+			b, err := io.ReadAll(respBody)
+			require.NoError(t, err)
+			assert.Equal(t, body, string(b))
+		})
+	}
+}
+
 func TestDecryptMW_Success(t *testing.T) {
 
 	pubPath, privatePath := createTestKeys(t)
@@ -241,7 +320,7 @@ func TestDecryptMW_Success(t *testing.T) {
 	public, err := crypto.NewPublicKeyService(pubPath)
 	require.NoError(t, err)
 
-	private, err := crypto.NewPrivateKeyService(privatePath)
+	private, err := crypto.NewPrivateKeyService(privatePath, "")
 	require.NoError(t, err)
 
 	originalMsg := []byte(`{
@@ -276,7 +355,7 @@ func TestDecryptMW_DecryptError(t *testing.T) {
 	w := httptest.NewRecorder()
 	_, privatePath := createTestKeys(t)
 
-	private, err := crypto.NewPrivateKeyService(privatePath)
+	private, err := crypto.NewPrivateKeyService(privatePath, "")
 	require.NoError(t, err)
 
 	handler := DecryptMW(private)
@@ -306,6 +385,8 @@ func createTestKeys(t *testing.T) (publicPath, privatePath string) {
 
 	template := &x509.Certificate{
 		SerialNumber: randomSerial(),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
 	}
 	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, privateKey)
 	if err != nil {
@@ -335,3 +416,86 @@ func randomSerial() *big.Int {
 	serial, _ := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(2), big.NewInt(128), nil))
 	return serial
 }
+
+func TestSignedRequestMW(t *testing.T) {
+	const key = "secret"
+	body := []byte(`[{"seq":1}]`)
+	tests := []struct {
+		name           string
+		sign           func(rq *http.Request)
+		expectedStatus int
+	}{
+		{
+			name:           "signed",
+			sign:           func(rq *http.Request) { utils.SignRequest(rq, key, body, time.Now()) },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "not signed",
+			sign:           func(rq *http.Request) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "wrong key",
+			sign:           func(rq *http.Request) { utils.SignRequest(rq, "other", body, time.Now()) },
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "other body",
+			sign:           func(rq *http.Request) { utils.SignRequest(rq, key, []byte("[]"), time.Now()) },
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "expired",
+			sign:           func(rq *http.Request) { utils.SignRequest(rq, key, body, time.Now().Add(-time.Hour)) },
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "no timestamp",
+			sign: func(rq *http.Request) {
+				utils.SignRequest(rq, key, body, time.Now())
+				rq.Header.Del(utils.TimestampHeader)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []byte
+			handler := SignedRequestMW(key, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/replication/updates", bytes.NewReader(body))
+			tt.sign(req)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, body, received)
+			}
+		})
+	}
+}
+
+func TestSignedRequestMW_SignsPath(t *testing.T) {
+	handler := SignedRequestMW("secret", time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	signed := httptest.NewRequest(http.MethodGet, "/replication/snapshot", nil)
+	utils.SignRequest(signed, "secret", nil, time.Now())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signed)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// подпись снимка не подходит к другому адресу
+	other := httptest.NewRequest(http.MethodGet, "/replication/updates", nil)
+	other.Header = signed.Header.Clone()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, other)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -1,12 +0,0 @@
-// Code generated by reset. DO NOT EDIT.
-
-package middleware
-
-import "io"
-
-func (c *GzipWriter) Reset() {
-	if c == nil {
-		return
-	}
-	c.s.Reset(io.Discard)
-}
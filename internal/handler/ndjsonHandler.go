@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/audit"
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+const (
+	// NDJSONContentType - тип тела потоковой загрузки: одна метрика в формате JSON на строку
+	NDJSONContentType = "application/x-ndjson"
+
+	maxNDJSONLineSize = 1 << 20
+	maxReportedErrors = 100
+)
+
+// LineError - ошибка разбора строки потока
+type LineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// StreamResult - итог потоковой загрузки метрик
+type StreamResult struct {
+	Accepted int         `json:"accepted"`
+	Rejected int         `json:"rejected"`
+	Errors   []LineError `json:"errors,omitempty"`
+	// Error - ошибка, прервавшая загрузку. Метрики из уже примененных пакетов остаются в хранилище.
+	Error string `json:"error,omitempty"`
+}
+
+func (s *StreamResult) reject(line int, err error) {
+	s.Rejected++
+	if len(s.Errors) < maxReportedErrors {
+		s.Errors = append(s.Errors, LineError{Line: line, Error: err.Error()})
+	}
+}
+
+// NDJSONUpdateMetricsHandler слушатель для потоковой записи метрик в формате NDJSON. Строки декодируются
+// по одной и применяются к хранилищу пакетами по chunkSize метрик, поэтому тело запроса не загружается
+// в память целиком. Некорректные строки пропускаются, в ответе возвращается число принятых и отклоненных строк.
+func NDJSONUpdateMetricsHandler(ctx context.Context, service Service, p audit.Publisher, chunkSize int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != NDJSONContentType {
+			logger.Log.Debug("UpdateMetricsStream", zap.String("content-type", r.Header.Get("Content-Type")))
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		result, status := applyStream(ctx, r, service, p, chunkSize)
+		if result.Error != "" {
+			logger.Log.Error("UpdateMetricsStream", zap.String("error", result.Error),
+				zap.Int("accepted", result.Accepted), zap.Int("rejected", result.Rejected))
+		}
+
+		rs, err := json.Marshal(result)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, err = w.Write(rs)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func applyStream(ctx context.Context, r *http.Request, service Service, p audit.Publisher, chunkSize int) (*StreamResult, int) {
+	result := &StreamResult{}
+	chunk := make([]models.Metrics, 0, chunkSize)
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		if err := service.UpdateMetrics(timeout, chunk); err != nil {
+			return err
+		}
+		result.Accepted += len(chunk)
+		p.Notify(chunk, r.RemoteAddr)
+		// Notify может обрабатывать пакет асинхронно, поэтому срез не переиспользуется
+		chunk = make([]models.Metrics, 0, chunkSize)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var metric models.Metrics
+		if err := json.Unmarshal(data, &metric); err != nil {
+			result.reject(line, err)
+			continue
+		}
+		if err := validateMetric(&metric); err != nil {
+			result.reject(line, err)
+			continue
+		}
+
+		chunk = append(chunk, metric)
+		if len(chunk) == chunkSize {
+			if err := flush(); err != nil {
+				result.Error = fmt.Sprintf("line %d: %s", line, err)
+				return result, http.StatusInternalServerError
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		status := http.StatusBadRequest
+		if !errors.Is(err, bufio.ErrTooLong) {
+			status = http.StatusInternalServerError
+		}
+		result.Error = fmt.Sprintf("line %d: %s", line+1, err)
+		return result, status
+	}
+	if err := flush(); err != nil {
+		result.Error = err.Error()
+		return result, http.StatusInternalServerError
+	}
+	return result, http.StatusOK
+}
+
+// validateMetric проверяет, что у метрики задано имя, известный тип и значение для этого типа
+func validateMetric(m *models.Metrics) error {
+	if m.ID == "" {
+		return errors.New("пустое имя метрики")
+	}
+	switch m.MType {
+	case models.Counter:
+		if m.Delta == nil {
+			return fmt.Errorf("не задано значение delta для метрики %s", m.ID)
+		}
+	case models.Gauge:
+		if m.Value == nil {
+			return fmt.Errorf("не задано значение value для метрики %s", m.ID)
+		}
+	default:
+		return fmt.Errorf("неизвестный тип метрики %s", m.MType)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/audit"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func TestNDJSONUpdateMetricsHandler(t *testing.T) {
+	body := strings.Join([]string{
+		`{"id":"a","type":"gauge","value":1.5}`,
+		`{"id":"b","type":"counter","delta":2}`,
+		``,
+		`not json`,
+		`{"id":"c","type":"counter"}`,
+		`{"id":"d","type":"gauge","value":3}`,
+		`{"id":"e","type":"histogram","value":3}`,
+		`{"id":"f","type":"counter","delta":7}`,
+	}, "\n")
+
+	var chunks [][]models.Metrics
+	service := &MockMetricsService{UpdateMetricsFunc: func(metrics []models.Metrics) error {
+		chunks = append(chunks, metrics)
+		return nil
+	}}
+
+	request := httptest.NewRequest(http.MethodPost, "/updates/stream", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	NDJSONUpdateMetricsHandler(context.TODO(), service, audit.NewAuditor(context.Background(), 5), 2).ServeHTTP(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var result StreamResult
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(t, 4, result.Accepted)
+	assert.Equal(t, 3, result.Rejected)
+	assert.Empty(t, result.Error)
+
+	var lines []int
+	for _, e := range result.Errors {
+		lines = append(lines, e.Line)
+	}
+	assert.Equal(t, []int{4, 5, 7}, lines)
+
+	require.Len(t, chunks, 2)
+	assert.Equal(t, []string{"a", "b"}, []string{chunks[0][0].ID, chunks[0][1].ID})
+	assert.Equal(t, []string{"d", "f"}, []string{chunks[1][0].ID, chunks[1][1].ID})
+}
+
+func TestNDJSONUpdateMetricsHandler_StorageError(t *testing.T) {
+	body := strings.Repeat(`{"id":"a","type":"gauge","value":1.5}`+"\n", 5)
+
+	calls := 0
+	service := &MockMetricsService{UpdateMetricsFunc: func(metrics []models.Metrics) error {
+		calls++
+		if calls == 2 {
+			return errors.New("storage unavailable")
+		}
+		return nil
+	}}
+
+	request := httptest.NewRequest(http.MethodPost, "/updates/stream", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	NDJSONUpdateMetricsHandler(context.TODO(), service, audit.NewAuditor(context.Background(), 5), 2).ServeHTTP(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+	var result StreamResult
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(t, 2, result.Accepted)
+	assert.Equal(t, "line 4: storage unavailable", result.Error)
+}
+
+func TestNDJSONUpdateMetricsHandler_LineTooLong(t *testing.T) {
+	body := `{"id":"a","type":"gauge","value":1.5}` + "\n" + strings.Repeat("x", maxNDJSONLineSize+1)
+
+	request := httptest.NewRequest(http.MethodPost, "/updates/stream", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	NDJSONUpdateMetricsHandler(context.TODO(), &MockMetricsService{}, audit.NewAuditor(context.Background(), 5), 10).ServeHTTP(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var result StreamResult
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(t, 0, result.Accepted)
+	assert.Contains(t, result.Error, "line 2")
+}
+
+func TestNDJSONUpdateMetricsHandler_UnsupportedMediaType(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/updates/stream", strings.NewReader(`[]`))
+	request.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	NDJSONUpdateMetricsHandler(context.TODO(), &MockMetricsService{}, audit.NewAuditor(context.Background(), 5), 10).ServeHTTP(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/audit"
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/otlp"
+)
+
+// OTLPMetricsHandler слушатель OTLP/HTTP для метрик OpenTelemetry в JSON-кодировке.
+// Поддерживаемые точки записываются через service.UpdateMetrics, об отклоненных сообщается
+// в partialSuccess ответа. При ошибке хранилища возвращается 503, чтобы SDK повторил экспорт.
+func OTLPMetricsHandler(ctx context.Context, service Service, p audit.Publisher, converter *otlp.Converter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			logger.Log.Debug("OTLPMetrics", zap.String("content-type", r.Header.Get("Content-Type")))
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var request otlp.ExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logger.Log.Debug("cannot decode OTLP request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := converter.Apply(timeout, &request, func(ctx context.Context, metrics []models.Metrics) error {
+			return service.UpdateMetrics(ctx, metrics)
+		})
+		if err != nil {
+			logger.Log.Error("OTLPMetrics", zap.Error(err))
+
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var response otlp.ExportResponse
+		if result.Rejected > 0 {
+			response.PartialSuccess = &otlp.PartialSuccess{
+				RejectedDataPoints: int64(result.Rejected),
+				ErrorMessage:       strings.Join(result.Errors, "; "),
+			}
+		}
+		rs, err := json.Marshal(response)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if len(result.Metrics) > 0 {
+			p.Notify(result.Metrics, r.RemoteAddr)
+		}
+		_, err = w.Write(rs)
+		if err != nil {
+			return
+		}
+	}
+}
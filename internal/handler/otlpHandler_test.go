@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/audit"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/otlp"
+)
+
+func TestOTLPMetricsHandler(t *testing.T) {
+	body := `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}}]},
+		"scopeMetrics":[{"metrics":[
+			{"name":"cpu","gauge":{"dataPoints":[{"asDouble":0.5}]}},
+			{"name":"latency","summary":{"dataPoints":[]}}]}]}]}`
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		updateErr   error
+		wantCode    int
+		wantIDs     []string
+		wantReject  int64
+	}{
+		{name: "accepted", contentType: "application/json", body: body, wantCode: http.StatusOK,
+			wantIDs: []string{"cpu;service.name=api"}, wantReject: 1},
+		{name: "protobuf not supported", contentType: "application/x-protobuf", body: body, wantCode: http.StatusUnsupportedMediaType},
+		{name: "invalid json", contentType: "application/json", body: `{"resourceMetrics":`, wantCode: http.StatusBadRequest},
+		{name: "storage error", contentType: "application/json", body: body, updateErr: errors.New("db down"),
+			wantCode: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []models.Metrics
+			service := &MockMetricsService{UpdateMetricsFunc: func(metrics []models.Metrics) error {
+				got = metrics
+				return tt.updateErr
+			}}
+
+			request := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			OTLPMetricsHandler(context.TODO(), service, audit.NewAuditor(context.Background(), 5),
+				otlp.NewConverter([]string{"service.name"})).ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var ids []string
+			for _, m := range got {
+				ids = append(ids, m.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+
+			var response otlp.ExportResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+			require.NotNil(t, response.PartialSuccess)
+			assert.Equal(t, tt.wantReject, response.PartialSuccess.RejectedDataPoints)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/replication"
+)
+
+// ReplicationApplier применяет пакеты основного сервера на реплике
+type ReplicationApplier interface {
+	Apply(ctx context.Context, batches []models.ReplicationBatch) error
+}
+
+// SnapshotSource отдает снимок метрик догоняющей реплике
+type SnapshotSource interface {
+	Snapshot(ctx context.Context) (models.ReplicationSnapshot, error)
+}
+
+// ReplicationUpdatesHandler принимает на реплике пакеты от основного сервера. Пакеты не проходят через
+// сервис и поэтому не пересылаются дальше и не попадают в аудит. Пока реплика догоняет основной сервер,
+// отвечает 503, и основной сервер повторяет отправку позже.
+func ReplicationUpdatesHandler(ctx context.Context, a ReplicationApplier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		var batches []models.ReplicationBatch
+		if err := json.NewDecoder(r.Body).Decode(&batches); err != nil {
+			logger.Log.Debug("cannot decode replication batches", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := a.Apply(timeout, batches); err != nil {
+			if errors.Is(err, replication.ErrNotReady) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			logger.Log.Error("Error applying replication batches", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// ReplicationSnapshotHandler отдает все метрики основного сервера с номером последнего вошедшего в них пакета
+func ReplicationSnapshotHandler(ctx context.Context, s SnapshotSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		snapshot, err := s.Snapshot(timeout)
+		if err != nil {
+			logger.Log.Error("Error taking replication snapshot", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rs, err := json.Marshal(snapshot)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(rs)
+		if err != nil {
+			return
+		}
+	}
+}
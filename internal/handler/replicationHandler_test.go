@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/replication"
+)
+
+type stubApplier struct {
+	err     error
+	batches []models.ReplicationBatch
+}
+
+func (a *stubApplier) Apply(_ context.Context, batches []models.ReplicationBatch) error {
+	a.batches = append(a.batches, batches...)
+	return a.err
+}
+
+func TestReplicationUpdatesHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+		wantSeqs   []uint64
+	}{
+		{
+			name:       "applied",
+			body:       `[{"seq":1,"metrics":[{"id":"c","type":"counter","delta":1}]},{"seq":2,"metrics":[]}]`,
+			wantStatus: http.StatusOK,
+			wantSeqs:   []uint64{1, 2},
+		},
+		{name: "bad body", body: `{"seq":1`, wantStatus: http.StatusBadRequest},
+		{name: "catching up", body: `[]`, err: replication.ErrNotReady, wantStatus: http.StatusServiceUnavailable},
+		{name: "storage error", body: `[]`, err: errors.New("db is down"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &stubApplier{err: tt.err}
+			w := httptest.NewRecorder()
+			ReplicationUpdatesHandler(context.Background(), a).
+				ServeHTTP(w, httptest.NewRequest(http.MethodPost, replication.UpdatesPath, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			var seqs []uint64
+			for _, b := range a.batches {
+				seqs = append(seqs, b.Seq)
+			}
+			assert.Equal(t, tt.wantSeqs, seqs)
+		})
+	}
+}
+
+type stubSnapshots struct {
+	snapshot models.ReplicationSnapshot
+	err      error
+}
+
+func (s stubSnapshots) Snapshot(context.Context) (models.ReplicationSnapshot, error) {
+	return s.snapshot, s.err
+}
+
+func TestReplicationSnapshotHandler(t *testing.T) {
+	delta := int64(5)
+	snapshot := models.ReplicationSnapshot{Seq: 42, Metrics: []models.Metrics{{ID: "c", MType: models.Counter, Delta: &delta}}}
+
+	w := httptest.NewRecorder()
+	ReplicationSnapshotHandler(context.Background(), stubSnapshots{snapshot: snapshot}).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, replication.SnapshotPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var got models.ReplicationSnapshot
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, snapshot, got)
+
+	w = httptest.NewRecorder()
+	ReplicationSnapshotHandler(context.Background(), stubSnapshots{err: errors.New("db is down")}).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, replication.SnapshotPath, nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
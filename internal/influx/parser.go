@@ -0,0 +1,196 @@
+// Package influx разбирает метрики в формате InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Целочисленные поля (с суффиксом i или u) становятся счетчиками, дробные - gauge, имя метрики
+// строится как measurement.field. Теги и timestamp проверяются, но не сохраняются, строковые и
+// логические поля пропускаются - модель метрик их не поддерживает.
+package influx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+const maxLineSize = 1 << 20
+
+// ParseError - ошибка разбора строки с ее номером (нумерация с 1)
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse разбирает все строки из r. Пустые строки и комментарии (#) пропускаются.
+// При первой ошибке возвращается *ParseError.
+func Parse(r io.Reader) ([]models.Metrics, error) {
+	var result []models.Metrics
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var err error
+		result, err = parseLine(result, text)
+		if err != nil {
+			return nil, &ParseError{Line: line, Err: err}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &ParseError{Line: line + 1, Err: err}
+	}
+	return result, nil
+}
+
+func parseLine(dst []models.Metrics, line string) ([]models.Metrics, error) {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 {
+		return nil, errors.New("missing fields")
+	}
+	if len(sections) > 3 {
+		return nil, fmt.Errorf("unexpected data after timestamp: %q", strings.Join(sections[3:], " "))
+	}
+
+	series := split(sections[0], ',', false)
+	measurement := unescape(series[0])
+	if measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+	for _, tag := range series[1:] {
+		k, v, ok := cutUnescaped(tag, '=')
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+
+	if len(sections) == 3 {
+		if _, err := strconv.ParseInt(sections[2], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+	}
+
+	for _, field := range split(sections[1], ',', true) {
+		k, v, ok := cutUnescaped(field, '=')
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		metric, err := parseField(measurement+"."+unescape(k), v)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", unescape(k), err)
+		}
+		if metric != nil {
+			dst = append(dst, *metric)
+		}
+	}
+	return dst, nil
+}
+
+// parseField возвращает nil для строковых и логических полей
+func parseField(name, value string) (*models.Metrics, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return nil, fmt.Errorf("unterminated string %s", value)
+		}
+		return nil, nil
+	case isBool(value):
+		return nil, nil
+	case strings.HasSuffix(value, "i"):
+		delta, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s", value)
+		}
+		return &models.Metrics{ID: name, MType: models.Counter, Delta: &delta}, nil
+	case strings.HasSuffix(value, "u"):
+		u, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+		if err != nil || u > math.MaxInt64 {
+			return nil, fmt.Errorf("invalid unsigned integer %s", value)
+		}
+		delta := int64(u)
+		return &models.Metrics{ID: name, MType: models.Counter, Delta: &delta}, nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, fmt.Errorf("invalid float %s", value)
+	}
+	return &models.Metrics{ID: name, MType: models.Gauge, Value: &v}, nil
+}
+
+func isBool(v string) bool {
+	switch v {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return true
+	}
+	return false
+}
+
+// split делит s по неэкранированному sep. Если quoted, разделители внутри двойных кавычек игнорируются.
+// Несколько подряд идущих пробелов считаются одним разделителем.
+func split(s string, sep byte, quoted bool) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && quoted:
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			if sep != ' ' || i > start {
+				parts = append(parts, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if sep != ' ' || start < len(s) {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// unescape убирает экранирование запятых, пробелов и знаков равенства
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(", =", s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
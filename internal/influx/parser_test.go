@@ -0,0 +1,96 @@
+package influx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []models.Metrics
+	}{
+		{
+			name:  "gauge and counter",
+			input: "cpu,host=a,region=eu usage=0.5,requests=10i 1700000000000000000",
+			want: []models.Metrics{
+				{ID: "cpu.usage", MType: models.Gauge, Value: toPtr(0.5)},
+				{ID: "cpu.requests", MType: models.Counter, Delta: toPtr(int64(10))},
+			},
+		},
+		{
+			name:  "without tags and timestamp",
+			input: "mem free=1e3,used=7u",
+			want: []models.Metrics{
+				{ID: "mem.free", MType: models.Gauge, Value: toPtr(1000.0)},
+				{ID: "mem.used", MType: models.Counter, Delta: toPtr(int64(7))},
+			},
+		},
+		{
+			name:  "strings and booleans are skipped",
+			input: `app,env=prod msg="a, b=c d",up=true,latency=12`,
+			want: []models.Metrics{
+				{ID: "app.latency", MType: models.Gauge, Value: toPtr(12.0)},
+			},
+		},
+		{
+			name:  "escaped characters",
+			input: `disk\ io,path=/var\,log read\ ops=-3i`,
+			want: []models.Metrics{
+				{ID: "disk io.read ops", MType: models.Counter, Delta: toPtr(int64(-3))},
+			},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# comment\n\nload value=1\n",
+			want: []models.Metrics{
+				{ID: "load.value", MType: models.Gauge, Value: toPtr(1.0)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantLine int
+	}{
+		{name: "no fields", input: "cpu", wantLine: 1},
+		{name: "bad tag", input: "ok v=1\ncpu,host v=1", wantLine: 2},
+		{name: "bad integer", input: "ok v=1\n\nok v=2\ncpu v=1.5i", wantLine: 4},
+		{name: "bad float", input: "cpu v=abc", wantLine: 1},
+		{name: "unsigned overflow", input: "cpu v=18446744073709551615u", wantLine: 1},
+		{name: "bad timestamp", input: "cpu v=1 yesterday", wantLine: 1},
+		{name: "extra data", input: "cpu v=1 1 2", wantLine: 1},
+		{name: "empty field value", input: "cpu v=", wantLine: 1},
+		{name: "unterminated string", input: `cpu v="abc`, wantLine: 1},
+		{name: "missing measurement", input: ",host=a v=1", wantLine: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			var pe *ParseError
+			require.True(t, errors.As(err, &pe), "unexpected error %v", err)
+			assert.Equal(t, tt.wantLine, pe.Line)
+		})
+	}
+}
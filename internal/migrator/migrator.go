@@ -0,0 +1,350 @@
+// Package migrator применяет и откатывает версионированные SQL-миграции
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+)
+
+// lockKey - ключ advisory lock, под которым выполняются миграции, чтобы несколько серверов,
+// запущенных одновременно, не применяли их параллельно
+const lockKey int64 = 0x6d6574726963 // "metric"
+
+const schemaTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// legacyVersion и legacyTable описывают схему баз, созданных сервером до появления миграций:
+// таблица метрик в них совпадает с результатом миграции legacyVersion, поэтому она считается примененной
+const (
+	legacyVersion int64 = 1
+	legacyTable         = "metrics"
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration - одна версия схемы
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status - состояние миграции в базе
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Missing - версия применена, но файла миграции нет
+	Missing bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load читает миграции из корня fsys и сортирует их по версии. Файлы, не похожие на миграции, пропускаются.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		parts := fileName.FindStringSubmatch(e.Name())
+		if parts == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up применяет все неприменённые миграции по возрастанию версии, каждую в своей транзакции.
+// Возвращает примененные миграции.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.adoptLegacy(ctx, conn, applied); err != nil {
+			return err
+		}
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, mg.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mg.Version, mg.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			logger.Log.Info("Migration applied", zap.Int64("version", mg.Version), zap.String("name", mg.Name))
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// adoptLegacy отмечает миграцию legacyVersion примененной, если миграций еще не было, а таблица метрик
+// уже создана прежней версией сервера
+func (m *Migrator) adoptLegacy(ctx context.Context, conn *sql.Conn, applied map[int64]appliedMigration) error {
+	if len(applied) > 0 || len(m.migrations) == 0 || m.migrations[0].Version != legacyVersion {
+		return nil
+	}
+	var exists bool
+	if err := conn.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", legacyTable).Scan(&exists); err != nil {
+		return fmt.Errorf("check legacy schema: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+	mg := m.migrations[0]
+	if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mg.Version, mg.Name); err != nil {
+		return fmt.Errorf("adopt legacy schema: %w", err)
+	}
+	logger.Log.Info("Existing schema adopted as migration", zap.Int64("version", mg.Version), zap.String("name", mg.Name))
+	applied[mg.Version] = appliedMigration{name: mg.Name, appliedAt: time.Now()}
+	return nil
+}
+
+// Down откатывает n последних примененных миграций, начиная с самой новой
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("number of migrations to roll back must be positive, got %d", n)
+	}
+	byVersion := make(map[int64]Migration, len(m.migrations))
+	for _, mg := range m.migrations {
+		byVersion[mg.Version] = mg
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		if n > len(versions) {
+			n = len(versions)
+		}
+
+		for _, v := range versions[:n] {
+			mg, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("roll back migration %d: migration file not found", v)
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("roll back migration %d_%s: no down file", mg.Version, mg.Name)
+			}
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, mg.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", mg.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("roll back migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			logger.Log.Info("Migration rolled back", zap.Int64("version", mg.Version), zap.String("name", mg.Name))
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status возвращает состояние всех известных миграций и версий, примененных в базе
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var result []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		result = buildStatus(m.migrations, applied)
+		return nil
+	})
+	return result, err
+}
+
+// appliedMigration - строка schema_migrations
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+}
+
+func buildStatus(migrations []Migration, applied map[int64]appliedMigration) []Status {
+	result := make([]Status, 0, len(migrations))
+	known := make(map[int64]bool, len(migrations))
+	for _, mg := range migrations {
+		known[mg.Version] = true
+		s := Status{Version: mg.Version, Name: mg.Name}
+		if a, ok := applied[mg.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.appliedAt
+		}
+		result = append(result, s)
+	}
+	for v, a := range applied {
+		if !known[v] {
+			result = append(result, Status{Version: v, Name: a.name, Applied: true, AppliedAt: a.appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+// withLock выполняет fn на отдельном соединении под сессионным advisory lock. Ожидание блокировки
+// и сами миграции не ограничены statement_timeout пула: другой сервер может применять миграции дольше,
+// а изменение большой таблицы - идти минутами.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := conn.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, "SET statement_timeout = 0"); err != nil {
+		return fmt.Errorf("disable statement timeout: %w", err)
+	}
+	defer func() {
+		// соединение вернется в пул: таймаут восстанавливается из параметров подключения
+		if _, rerr := conn.ExecContext(context.Background(), "RESET statement_timeout"); rerr != nil {
+			logger.Log.Error("Error restoring statement timeout", zap.Error(rerr))
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// контекст мог быть отменен, а блокировку нужно снять в любом случае
+		_, uerr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+		if uerr != nil {
+			logger.Log.Error("Error releasing migration lock", zap.Error(uerr))
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, schemaTable); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("ошибка при закрытии rows")
+		}
+	}(rows)
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var v int64
+		var a appliedMigration
+		if err := rows.Scan(&v, &a.name, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[v] = a
+	}
+	return applied, rows.Err()
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil && !errors.Is(rerr, sql.ErrTxDone) {
+			logger.Log.Error("не удалось откатить транзакцию", zap.Error(rerr))
+		}
+		return err
+	}
+	return tx.Commit()
+}
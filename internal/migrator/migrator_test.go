@@ -0,0 +1,88 @@
+package migrator
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_add_ttl.up.sql":         {Data: []byte("ALTER TABLE metrics ADD COLUMN ttl INT")},
+		"000010_add_ttl.down.sql":       {Data: []byte("ALTER TABLE metrics DROP COLUMN ttl")},
+		"000002_add_index.up.sql":       {Data: []byte("CREATE INDEX i ON metrics(delta)")},
+		"000001_create_table.up.sql":    {Data: []byte("CREATE TABLE metrics ()")},
+		"000001_create_table.down.sql":  {Data: []byte("DROP TABLE metrics")},
+		"README.md":                     {Data: []byte("docs")},
+		"migrations.go":                 {Data: []byte("package migrations")},
+		"subdir/000003_nested.up.sql":   {Data: []byte("SELECT 1")},
+		"000004_not_a_migration.sql":    {Data: []byte("SELECT 1")},
+		"000005_wrong_suffix.up.sql.bk": {Data: []byte("SELECT 1")},
+	}
+
+	got, err := Load(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "create_table", Up: "CREATE TABLE metrics ()", Down: "DROP TABLE metrics"},
+		{Version: 2, Name: "add_index", Up: "CREATE INDEX i ON metrics(delta)"},
+		{Version: 10, Name: "add_ttl", Up: "ALTER TABLE metrics ADD COLUMN ttl INT", Down: "ALTER TABLE metrics DROP COLUMN ttl"},
+	}, got)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{"000001_create.down.sql": {Data: []byte("DROP TABLE metrics")}},
+		},
+		{
+			name: "same version, different names",
+			fsys: fstest.MapFS{
+				"000001_create.up.sql": {Data: []byte("SELECT 1")},
+				"000001_other.up.sql":  {Data: []byte("SELECT 2")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	got, err := Load(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, got)
+	assert.Equal(t, int64(1), got[0].Version)
+	for _, m := range got {
+		assert.NotEmpty(t, m.Down, "migration %d_%s must be reversible", m.Version, m.Name)
+	}
+}
+
+func TestBuildStatus(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	migrations := []Migration{
+		{Version: 1, Name: "create_table"},
+		{Version: 2, Name: "add_index"},
+	}
+	applied := map[int64]appliedMigration{
+		1: {name: "create_table", appliedAt: at},
+		7: {name: "removed", appliedAt: at},
+	}
+
+	assert.Equal(t, []Status{
+		{Version: 1, Name: "create_table", Applied: true, AppliedAt: at},
+		{Version: 2, Name: "add_index"},
+		{Version: 7, Name: "removed", Applied: true, AppliedAt: at, Missing: true},
+	}, buildStatus(migrations, applied))
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Aggregate - статистика значений gauge за скользящее окно Window
+type Aggregate struct {
+	Window string  `json:"window"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Sum    float64 `json:"sum"`
+	Count  int64   `json:"count"`
+	Avg    float64 `json:"avg"`
+	Last   float64 `json:"last"`
+}
+
+// WindowBucket - значения gauge, полученные в промежутке [Start, Start + ширина корзины)
+type WindowBucket struct {
+	Start time.Time `json:"start"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Sum   float64   `json:"sum"`
+	Count int64     `json:"count"`
+	Last  float64   `json:"last"`
+}
+
+// GaugeWindow - сохраненное между перезапусками окно одной gauge-метрики
+type GaugeWindow struct {
+	ID      string         `json:"id"`
+	Window  time.Duration  `json:"window"`
+	Buckets []WindowBucket `json:"buckets"`
+}
+
+func (w GaugeWindow) Key() WindowKey {
+	return WindowKey{ID: w.ID, Window: w.Window}
+}
+
+// WindowKey - метрика и ширина окна, по которым хранится окно
+type WindowKey struct {
+	ID     string        `json:"id"`
+	Window time.Duration `json:"window"`
+}
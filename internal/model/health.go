@@ -0,0 +1,15 @@
+package models
+
+// Роли соединений с БД
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+// ConnectionStatus - состояние одного соединения с БД
+type ConnectionStatus struct {
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ValentinaKh/go-metrics/internal/utils"
 )
@@ -22,8 +23,48 @@ type Metrics struct {
 	Delta *int64   `json:"delta,omitempty"`
 	Value *float64 `json:"value,omitempty"`
 	Hash  string   `json:"hash,omitempty"`
+	// UpdatedAt - время последнего обновления, проставляется хранилищем
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Aggregates - статистика gauge за скользящие окна, заполняется только при чтении одной метрики
+	Aggregates []Aggregate `json:"aggregates,omitempty"`
 }
 
 func (m *Metrics) String() string {
 	return fmt.Sprintf("name: %s, type: %s, delta: %s, value: %s", m.ID, m.MType, utils.ToString(m.Delta), utils.ToString(m.Value))
 }
+
+// Key - идентификатор метрики в хранилище: метрики разных типов с одним именем не пересекаются
+func (m *Metrics) Key() MetricKey {
+	return MetricKey{MType: m.MType, ID: m.ID}
+}
+
+// MetricKey - тип и имя метрики, по которым метрика однозначно определяется в хранилище
+type MetricKey struct {
+	MType string `json:"type"`
+	ID    string `json:"id"`
+}
+
+func (k MetricKey) String() string {
+	return k.MType + "/" + k.ID
+}
+
+// Less упорядочивает ключи по имени, а метрики с одним именем - по типу
+func (k MetricKey) Less(o MetricKey) bool {
+	if k.ID != o.ID {
+		return k.ID < o.ID
+	}
+	return k.MType < o.MType
+}
+
+// MetricSummary - строка списка метрик
+type MetricSummary struct {
+	Value string
+	// Stale - метрика давно не обновлялась и будет удалена
+	Stale bool
+}
+
+// Expiration - метрика, которую нужно удалить, если она не обновлялась с момента Before
+type Expiration struct {
+	MetricKey
+	Before time.Time
+}
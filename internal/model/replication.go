@@ -0,0 +1,17 @@
+package models
+
+// ReplicationBatch - пакет метрик, принятый основным сервером, или метрики, удаленные им по времени
+// жизни (Deleted). По номеру Seq реплика отбрасывает повторно доставленные пакеты. Пакет с Resync
+// не нумеруется: основной сервер потерял пакет для реплики, и она должна заново запросить снимок.
+type ReplicationBatch struct {
+	Seq     uint64      `json:"seq"`
+	Metrics []Metrics   `json:"metrics"`
+	Deleted []MetricKey `json:"deleted,omitempty"`
+	Resync  bool        `json:"resync,omitempty"`
+}
+
+// ReplicationSnapshot - все метрики основного сервера и номер последнего пакета, вошедшего в снимок
+type ReplicationSnapshot struct {
+	Seq     uint64    `json:"seq"`
+	Metrics []Metrics `json:"metrics"`
+}
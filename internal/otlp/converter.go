@@ -0,0 +1,251 @@
+// Package otlp преобразует метрики OpenTelemetry (OTLP/HTTP JSON) в метрики сервера.
+//
+// Gauge и немонотонные Sum сохраняются как gauge, монотонные Sum - как счетчики. Для Sum с
+// cumulative temporality хранится последнее значение каждого ряда, и в хранилище пишется
+// приращение: первая точка ряда только запоминается, уменьшение значения или смена
+// startTimeUnixNano считаются сбросом счетчика. Дробные значения округляются до записи разности,
+// поэтому ряд, растущий меньше чем на единицу за экспорт, тоже учитывается. Ряды, не обновлявшиеся
+// seriesTTL, забываются. Атрибуты точки и выбранные атрибуты ресурса
+// добавляются к имени метрики в виде суффикса ";key=value" в порядке сортировки ключей.
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// seriesTTL - через сколько без новых точек состояние cumulative-ряда удаляется
+const seriesTTL = time.Hour
+
+// Converter преобразует запросы экспорта и хранит состояние cumulative-рядов
+type Converter struct {
+	resourceAttributes map[string]struct{}
+	now                func() time.Time
+
+	// mu защищает состояние рядов, но не удерживается во время записи: состояние обновляется
+	// после успешной записи приращений
+	mu        sync.Mutex
+	series    map[string]cumulativePoint
+	lastSweep time.Time
+}
+
+type cumulativePoint struct {
+	start int64
+	value float64
+	seen  time.Time
+}
+
+// pendingPoint - новое состояние ряда и состояние, от которого считалось приращение
+type pendingPoint struct {
+	base    cumulativePoint
+	hasBase bool
+	next    cumulativePoint
+}
+
+// Result - итог применения запроса
+type Result struct {
+	Metrics  []models.Metrics
+	Rejected int
+	Errors   []string
+}
+
+// NewConverter создает преобразователь. resourceAttributes - ключи атрибутов ресурса,
+// которые добавляются к имени метрики (например, service.name).
+func NewConverter(resourceAttributes []string) *Converter {
+	attrs := make(map[string]struct{}, len(resourceAttributes))
+	for _, a := range resourceAttributes {
+		if a = strings.TrimSpace(a); a != "" {
+			attrs[a] = struct{}{}
+		}
+	}
+	return &Converter{resourceAttributes: attrs, now: time.Now, series: make(map[string]cumulativePoint)}
+}
+
+// Apply преобразует запрос и передает метрики в write. Состояние cumulative-рядов обновляется,
+// только если write завершился без ошибки, поэтому повтор запроса клиентом не теряет приращения.
+func (c *Converter) Apply(ctx context.Context, req *ExportRequest, write func(ctx context.Context, metrics []models.Metrics) error) (*Result, error) {
+	result := &Result{}
+	pending := make(map[string]pendingPoint)
+	c.mu.Lock()
+	for _, rm := range req.ResourceMetrics {
+		resourceLabels := c.labels(rm.Resource.Attributes, true)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				c.convertMetric(result, pending, m, resourceLabels)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	if len(result.Metrics) > 0 {
+		if err := write(ctx, result.Metrics); err != nil {
+			return nil, err
+		}
+	}
+	c.commit(pending)
+	return result, nil
+}
+
+// commit сохраняет новое состояние рядов. Ряд, который другой запрос уже продвинул дальше базового
+// состояния, не перезаписывается более старой точкой.
+func (c *Converter) commit(pending map[string]pendingPoint) {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, p := range pending {
+		cur, ok := c.series[name]
+		if ok != p.hasBase || ok && (cur.start != p.base.start || cur.value != p.base.value) {
+			continue
+		}
+		p.next.seen = now
+		c.series[name] = p.next
+	}
+	if now.Sub(c.lastSweep) < seriesTTL {
+		return
+	}
+	for name, p := range c.series {
+		if now.Sub(p.seen) >= seriesTTL {
+			delete(c.series, name)
+		}
+	}
+	c.lastSweep = now
+}
+
+func (c *Converter) convertMetric(result *Result, pending map[string]pendingPoint, m Metric, resourceLabels []string) {
+	reject := func(n int, err error) {
+		result.Rejected += n
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", m.Name, err))
+	}
+	if m.Name == "" {
+		reject(countPoints(m), errors.New("empty metric name"))
+		return
+	}
+
+	switch {
+	case m.Gauge != nil:
+		for _, dp := range m.Gauge.DataPoints {
+			v, err := pointValue(dp)
+			if err != nil {
+				reject(1, err)
+				continue
+			}
+			result.Metrics = append(result.Metrics, gauge(c.seriesName(m.Name, resourceLabels, dp), v))
+		}
+	case m.Sum != nil:
+		for _, dp := range m.Sum.DataPoints {
+			v, err := pointValue(dp)
+			if err != nil {
+				reject(1, err)
+				continue
+			}
+			name := c.seriesName(m.Name, resourceLabels, dp)
+			switch {
+			case m.Sum.AggregationTemporality == TemporalityDelta:
+				result.Metrics = append(result.Metrics, counter(name, round(v)))
+			case m.Sum.AggregationTemporality != TemporalityCumulative:
+				reject(1, errors.New("unspecified aggregation temporality"))
+			case !m.Sum.IsMonotonic:
+				// cumulative UpDownCounter - текущий уровень, а не накопленная сумма
+				result.Metrics = append(result.Metrics, gauge(name, v))
+			default:
+				if delta, ok := c.cumulativeDelta(pending, name, int64(dp.StartTimeUnixNano), v); ok {
+					result.Metrics = append(result.Metrics, counter(name, delta))
+				}
+			}
+		}
+	default:
+		reject(countPoints(m), errors.New("unsupported metric type"))
+	}
+}
+
+// cumulativeDelta возвращает приращение ряда относительно предыдущей точки. Для первой точки ряда
+// возвращается false: без базового значения нельзя отличить новый ряд от перезапуска сервера.
+// Округляются накопленные значения, а не разность, чтобы дробные приращения не терялись.
+// Вызывается под mu.
+func (c *Converter) cumulativeDelta(pending map[string]pendingPoint, name string, start int64, v float64) (int64, bool) {
+	p, ok := pending[name]
+	prev := p.next
+	if !ok {
+		p.base, p.hasBase = c.series[name]
+		prev, ok = p.base, p.hasBase
+	}
+	p.next = cumulativePoint{start: start, value: v}
+	pending[name] = p
+	if !ok {
+		return 0, false
+	}
+	if start != prev.start || v < prev.value {
+		// ряд сброшен: все значение накоплено после сброса
+		return round(v), true
+	}
+	return round(v) - round(prev.value), true
+}
+
+func (c *Converter) seriesName(name string, resourceLabels []string, dp NumberDataPoint) string {
+	labels := append(c.labels(dp.Attributes, false), resourceLabels...)
+	if len(labels) == 0 {
+		return name
+	}
+	sort.Strings(labels)
+	return name + ";" + strings.Join(labels, ";")
+}
+
+// labels возвращает атрибуты в виде key=value. Для ресурса берутся только настроенные ключи.
+func (c *Converter) labels(attrs []KeyValue, resource bool) []string {
+	var labels []string
+	for _, kv := range attrs {
+		if resource {
+			if _, ok := c.resourceAttributes[kv.Key]; !ok {
+				continue
+			}
+		}
+		if v, ok := kv.Value.String(); ok {
+			labels = append(labels, kv.Key+"="+v)
+		}
+	}
+	return labels
+}
+
+func pointValue(dp NumberDataPoint) (float64, error) {
+	switch {
+	case dp.AsInt != nil:
+		return float64(*dp.AsInt), nil
+	case dp.AsDouble != nil:
+		if math.IsNaN(*dp.AsDouble) || math.IsInf(*dp.AsDouble, 0) {
+			return 0, errors.New("value is not a finite number")
+		}
+		return *dp.AsDouble, nil
+	}
+	return 0, errors.New("data point has no value")
+}
+
+func countPoints(m Metric) int {
+	switch {
+	case m.Gauge != nil:
+		return len(m.Gauge.DataPoints)
+	case m.Sum != nil:
+		return len(m.Sum.DataPoints)
+	}
+	// точки гистограмм не разбираются, отклоненной считается вся метрика
+	return 1
+}
+
+func gauge(name string, v float64) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &v}
+}
+
+func counter(name string, delta int64) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Counter, Delta: &delta}
+}
+
+func round(v float64) int64 {
+	return int64(math.Round(v))
+}
@@ -0,0 +1,157 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+func decodeRequest(t *testing.T, body string) *ExportRequest {
+	var req ExportRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	return &req
+}
+
+// sumRequest - монотонный cumulative Sum с одной точкой, как его отправляет SDK на каждом экспорте
+func sumRequest(t *testing.T, start, value string) *ExportRequest {
+	return decodeRequest(t, `{"resourceMetrics":[{"resource":{"attributes":[
+		{"key":"service.name","value":{"stringValue":"api"}},
+		{"key":"host.name","value":{"stringValue":"h1"}}]},
+	"scopeMetrics":[{"metrics":[{"name":"http.requests","sum":{
+		"aggregationTemporality":"AGGREGATION_TEMPORALITY_CUMULATIVE","isMonotonic":true,
+		"dataPoints":[{"startTimeUnixNano":"`+start+`","asInt":"`+value+`",
+			"attributes":[{"key":"method","value":{"stringValue":"GET"}}]}]}}]}]}]}`)
+}
+
+func collect(t *testing.T, c *Converter, req *ExportRequest) *Result {
+	result, err := c.Apply(context.Background(), req, func(context.Context, []models.Metrics) error { return nil })
+	require.NoError(t, err)
+	return result
+}
+
+func TestConverter_GaugeAndDeltaSum(t *testing.T) {
+	req := decodeRequest(t, `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[
+		{"name":"temperature","gauge":{"dataPoints":[{"asDouble":21.5,"attributes":[
+			{"key":"room","value":{"stringValue":"b"}},{"key":"floor","value":{"intValue":"2"}}]}]}},
+		{"name":"jobs","sum":{"aggregationTemporality":1,"isMonotonic":true,"dataPoints":[{"asInt":3},{"asDouble":1.6}]}},
+		{"name":"queue","sum":{"aggregationTemporality":2,"isMonotonic":false,"dataPoints":[{"asInt":"7"}]}},
+		{"name":"latency","histogram":{"dataPoints":[{"count":"1"}]}},
+		{"name":"broken","gauge":{"dataPoints":[{}]}}
+	]}]}]}`)
+
+	result := collect(t, NewConverter(nil), req)
+	assert.Equal(t, []models.Metrics{
+		{ID: "temperature;floor=2;room=b", MType: models.Gauge, Value: toPtr(21.5)},
+		{ID: "jobs", MType: models.Counter, Delta: toPtr(int64(3))},
+		{ID: "jobs", MType: models.Counter, Delta: toPtr(int64(2))},
+		{ID: "queue", MType: models.Gauge, Value: toPtr(7.0)},
+	}, result.Metrics)
+	assert.Equal(t, 2, result.Rejected)
+	assert.Len(t, result.Errors, 2)
+}
+
+func TestConverter_CumulativeSum(t *testing.T) {
+	c := NewConverter([]string{"service.name"})
+	name := "http.requests;method=GET;service.name=api"
+
+	// первая точка ряда только запоминается
+	assert.Empty(t, collect(t, c, sumRequest(t, "100", "10")).Metrics)
+
+	assert.Equal(t, []models.Metrics{{ID: name, MType: models.Counter, Delta: toPtr(int64(5))}},
+		collect(t, c, sumRequest(t, "100", "15")).Metrics)
+
+	// уменьшение значения - сброс счетчика
+	assert.Equal(t, []models.Metrics{{ID: name, MType: models.Counter, Delta: toPtr(int64(4))}},
+		collect(t, c, sumRequest(t, "100", "4")).Metrics)
+
+	// новый startTimeUnixNano - процесс перезапущен
+	assert.Equal(t, []models.Metrics{{ID: name, MType: models.Counter, Delta: toPtr(int64(6))}},
+		collect(t, c, sumRequest(t, "200", "6")).Metrics)
+}
+
+func TestConverter_StateNotAdvancedOnWriteError(t *testing.T) {
+	c := NewConverter([]string{"service.name"})
+	collect(t, c, sumRequest(t, "100", "10"))
+
+	_, err := c.Apply(context.Background(), sumRequest(t, "100", "15"), func(context.Context, []models.Metrics) error {
+		return errors.New("storage unavailable")
+	})
+	require.Error(t, err)
+
+	// повтор того же экспорта записывает приращение, которое не удалось записать
+	assert.Equal(t, int64(5), *collect(t, c, sumRequest(t, "100", "15")).Metrics[0].Delta)
+}
+
+// doubleSumRequest - монотонный cumulative Sum с дробным значением
+func doubleSumRequest(t *testing.T, value string) *ExportRequest {
+	return decodeRequest(t, `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"energy","sum":{
+		"aggregationTemporality":2,"isMonotonic":true,
+		"dataPoints":[{"startTimeUnixNano":"100","asDouble":`+value+`}]}}]}]}]}`)
+}
+
+func TestConverter_FractionalCumulativeSum(t *testing.T) {
+	c := NewConverter(nil)
+	var total int64
+	for _, v := range []string{"0", "0.4", "0.8", "1.2", "1.6", "2.0", "2.4"} {
+		for _, m := range collect(t, c, doubleSumRequest(t, v)).Metrics {
+			total += *m.Delta
+		}
+	}
+	assert.Equal(t, int64(2), total)
+}
+
+func TestConverter_WriteWithoutLock(t *testing.T) {
+	c := NewConverter([]string{"service.name"})
+	collect(t, c, sumRequest(t, "100", "10"))
+
+	// пока идет запись, другой запрос может быть преобразован
+	result, err := c.Apply(context.Background(), sumRequest(t, "100", "15"), func(context.Context, []models.Metrics) error {
+		collect(t, c, doubleSumRequest(t, "1"))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *result.Metrics[0].Delta)
+	assert.Equal(t, int64(3), *collect(t, c, sumRequest(t, "100", "18")).Metrics[0].Delta)
+}
+
+func TestConverter_EvictsIdleSeries(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewConverter(nil)
+	c.now = func() time.Time { return now }
+
+	collect(t, c, doubleSumRequest(t, "1"))
+	now = now.Add(seriesTTL / 2)
+	collect(t, c, sumRequest(t, "100", "10"))
+	now = now.Add(seriesTTL)
+	collect(t, c, sumRequest(t, "100", "12"))
+
+	assert.NotContains(t, c.series, "energy")
+	assert.Len(t, c.series, 1)
+}
+
+func TestTemporality_Unmarshal(t *testing.T) {
+	var tt Temporality
+	assert.Error(t, json.Unmarshal([]byte(`"weekly"`), &tt))
+	require.NoError(t, json.Unmarshal([]byte(`"AGGREGATION_TEMPORALITY_DELTA"`), &tt))
+	assert.Equal(t, TemporalityDelta, tt)
+}
+
+func TestInt64_Unmarshal(t *testing.T) {
+	var i Int64
+	require.NoError(t, json.Unmarshal([]byte(`"-5"`), &i))
+	assert.Equal(t, Int64(-5), i)
+	require.NoError(t, json.Unmarshal([]byte(`42`), &i))
+	assert.Equal(t, Int64(42), i)
+	assert.Error(t, json.Unmarshal([]byte(`"x"`), &i))
+}
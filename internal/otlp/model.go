@@ -0,0 +1,136 @@
+package otlp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// Подмножество сообщений ExportMetricsServiceRequest в JSON-кодировке OTLP/HTTP, которое нужно
+// для преобразования в метрики сервера. Неизвестные поля игнорируются.
+
+// ExportRequest - тело запроса POST /v1/metrics
+type ExportRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type ScopeMetrics struct {
+	Metrics []Metric `json:"metrics"`
+}
+
+// Metric - метрика OTLP. Histogram, ExponentialHistogram и Summary не поддерживаются и отклоняются.
+type Metric struct {
+	Name  string `json:"name"`
+	Gauge *Gauge `json:"gauge,omitempty"`
+	Sum   *Sum   `json:"sum,omitempty"`
+}
+
+type Gauge struct {
+	DataPoints []NumberDataPoint `json:"dataPoints"`
+}
+
+type Sum struct {
+	DataPoints             []NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality Temporality       `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes"`
+	StartTimeUnixNano Int64      `json:"startTimeUnixNano"`
+	TimeUnixNano      Int64      `json:"timeUnixNano"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+	AsInt             *Int64     `json:"asInt,omitempty"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *Int64   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// String возвращает значение атрибута в текстовом виде. Массивы, словари и байты не поддерживаются,
+// для них возвращается false.
+func (v AnyValue) String() (string, bool) {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue, true
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue), true
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10), true
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// Int64 - 64-битное целое, которое OTLP JSON кодирует строкой; число без кавычек тоже принимается
+type Int64 int64
+
+func (i *Int64) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	v, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		// поля времени в схеме имеют тип fixed64, поэтому допускаются значения uint64
+		u, uerr := strconv.ParseUint(string(data), 10, 64)
+		if uerr != nil {
+			return fmt.Errorf("invalid int64 %s", data)
+		}
+		v = int64(u)
+	}
+	*i = Int64(v)
+	return nil
+}
+
+// Temporality - AggregationTemporality, принимается как число или имя значения перечисления
+type Temporality int
+
+const (
+	TemporalityUnspecified Temporality = 0
+	TemporalityDelta       Temporality = 1
+	TemporalityCumulative  Temporality = 2
+)
+
+func (t *Temporality) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `"AGGREGATION_TEMPORALITY_UNSPECIFIED"`:
+		*t = TemporalityUnspecified
+	case `"AGGREGATION_TEMPORALITY_DELTA"`:
+		*t = TemporalityDelta
+	case `"AGGREGATION_TEMPORALITY_CUMULATIVE"`:
+		*t = TemporalityCumulative
+	default:
+		v, err := strconv.Atoi(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid aggregation temporality %s", data)
+		}
+		*t = Temporality(v)
+	}
+	return nil
+}
+
+// ExportResponse - ответ на запрос экспорта. PartialSuccess заполняется, если часть точек отклонена.
+type ExportResponse struct {
+	PartialSuccess *PartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+type PartialSuccess struct {
+	RejectedDataPoints int64  `json:"rejectedDataPoints,string"`
+	ErrorMessage       string `json:"errorMessage,omitempty"`
+}
@@ -0,0 +1,163 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/retry"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+	"github.com/ValentinaKh/go-metrics/internal/utils"
+)
+
+// ErrNotReady - реплика еще не получила снимок и не принимает пакеты; основной сервер повторит их позже
+var ErrNotReady = errors.New("follower is catching up")
+
+// deletedBefore - граница удаления метрик, удаленных основным сервером: на реплике они удаляются
+// независимо от времени своего обновления
+var deletedBefore = time.Date(9999, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Follower применяет пакеты основного сервера напрямую к хранилищу, минуя сервис, поэтому дальше
+// они не пересылаются. Пакеты с номером не больше последнего примененного отбрасываются.
+//
+// При запуске реплика запрашивает снимок основного сервера и до его применения отвечает ErrNotReady.
+// Так же реплика догоняет основной сервер, когда он не смог поставить пакет в ее очередь (пакет Resync).
+// Изменения, записанные в реплику в обход репликации, при этом не откатываются.
+type Follower struct {
+	strg    service.Storage
+	url     string
+	key     string
+	client  *http.Client
+	retrier *retry.Retrier
+
+	// resync будит Run, когда нужно заново запросить снимок
+	resync chan struct{}
+
+	mu      sync.Mutex
+	ready   bool
+	applied uint64
+}
+
+// NewFollower - primary - адрес основного сервера host:port, key - общий ключ серверов, которым
+// подписывается запрос снимка
+func NewFollower(strg service.Storage, primary, key string, retrier *retry.Retrier) *Follower {
+	return &Follower{
+		strg:    strg,
+		url:     (&url.URL{Scheme: "http", Host: primary, Path: SnapshotPath}).String(),
+		key:     key,
+		client:  &http.Client{Timeout: time.Minute},
+		retrier: retrier,
+		resync:  make(chan struct{}, 1),
+	}
+}
+
+// Apply применяет пакеты по порядку: записывает метрики пакета и удаляет удаленные основным сервером
+func (f *Follower) Apply(ctx context.Context, batches []models.ReplicationBatch) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.ready {
+		return ErrNotReady
+	}
+	for _, b := range batches {
+		if b.Resync {
+			// пакеты, отправленные после потерянного, уже применены основным сервером и войдут в снимок
+			f.ready = false
+			select {
+			case f.resync <- struct{}{}:
+			default:
+			}
+			logger.Log.Warn("Primary lost a batch for this follower, catching up again")
+			return nil
+		}
+		if b.Seq <= f.applied {
+			continue
+		}
+		if len(b.Metrics) > 0 {
+			if err := f.strg.UpdateMetrics(ctx, b.Metrics); err != nil {
+				return err
+			}
+		}
+		if len(b.Deleted) > 0 {
+			expired := make([]models.Expiration, 0, len(b.Deleted))
+			for _, key := range b.Deleted {
+				expired = append(expired, models.Expiration{MetricKey: key, Before: deletedBefore})
+			}
+			if _, err := f.strg.DeleteExpired(ctx, expired); err != nil {
+				return err
+			}
+		}
+		f.applied = b.Seq
+	}
+	return nil
+}
+
+// Run до отмены ctx запрашивает снимок при запуске и после каждого пакета Resync, пока снимок не будет применен
+func (f *Follower) Run(ctx context.Context) {
+	for {
+		err := f.CatchUp(ctx)
+		if err != nil {
+			logger.Log.Warn("Error catching up with primary, will retry", zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.resync:
+		}
+	}
+}
+
+// CatchUp запрашивает снимок основного сервера и приводит к нему хранилище реплики
+func (f *Follower) CatchUp(ctx context.Context) error {
+	snapshot, err := retry.DoWithRetry(ctx, f.retrier, func() (models.ReplicationSnapshot, error) {
+		return f.fetch(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// значения приводятся к снимку через UpdateMetrics, поэтому снимок применяется к хранилищу любого типа
+	if err := service.ImportMetrics(ctx, f.strg, snapshot.Metrics, service.ImportOverwrite); err != nil {
+		return err
+	}
+	f.applied = snapshot.Seq
+	f.ready = true
+	logger.Log.Info("Follower caught up with primary", zap.Uint64("seq", snapshot.Seq),
+		zap.Int("metrics", len(snapshot.Metrics)))
+	return nil
+}
+
+func (f *Follower) fetch(ctx context.Context) (models.ReplicationSnapshot, error) {
+	var snapshot models.ReplicationSnapshot
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return snapshot, err
+	}
+	utils.SignRequest(rq, f.key, nil, time.Now())
+	rs, err := f.client.Do(rq)
+	if err != nil {
+		return snapshot, err
+	}
+	defer func() { _ = rs.Body.Close() }()
+	if rs.StatusCode != http.StatusOK {
+		return snapshot, fmt.Errorf("unexpected status %d", rs.StatusCode)
+	}
+	err = json.NewDecoder(rs.Body).Decode(&snapshot)
+	return snapshot, err
+}
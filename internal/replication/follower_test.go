@@ -0,0 +1,100 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/handler/middleware"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+func snapshotServer(t *testing.T, snapshot models.ReplicationSnapshot) *httptest.Server {
+	return httptest.NewServer(middleware.SignedRequestMW(testKey, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != SnapshotPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(snapshot))
+	})))
+}
+
+func TestFollower_CatchUpAndApply(t *testing.T) {
+	ctx := context.Background()
+	srv := snapshotServer(t, models.ReplicationSnapshot{Seq: 10, Metrics: []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(10))},
+		{ID: "new", MType: models.Counter, Delta: toPtr(int64(0))},
+		{ID: "g", MType: models.Gauge, Value: toPtr(2.5)},
+	}})
+	defer srv.Close()
+
+	mem := storage.NewMemStorage()
+	require.NoError(t, mem.UpdateMetrics(ctx, []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(4))},
+		{ID: "g", MType: models.Gauge, Value: toPtr(1.0)},
+	}))
+	f := NewFollower(mem, hostOf(t, srv), testKey, testRetrier())
+
+	assert.ErrorIs(t, f.Apply(ctx, []models.ReplicationBatch{{Seq: 11}}), ErrNotReady)
+
+	require.NoError(t, f.CatchUp(ctx))
+	assertValues(t, mem, map[models.MetricKey]float64{
+		{MType: models.Counter, ID: "c"}:   10,
+		{MType: models.Counter, ID: "new"}: 0,
+		{MType: models.Gauge, ID: "g"}:     2.5,
+	})
+
+	// пакеты до 10 уже вошли в снимок, повтор 11 отбрасывается
+	batch := func(seq uint64, delta int64) models.ReplicationBatch {
+		return models.ReplicationBatch{Seq: seq, Metrics: []models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(delta)}}}
+	}
+	require.NoError(t, f.Apply(ctx, []models.ReplicationBatch{batch(9, 100), batch(10, 100), batch(11, 1)}))
+	require.NoError(t, f.Apply(ctx, []models.ReplicationBatch{batch(11, 1), batch(12, 2)}))
+	assertValues(t, mem, map[models.MetricKey]float64{
+		{MType: models.Counter, ID: "c"}:   13,
+		{MType: models.Counter, ID: "new"}: 0,
+		{MType: models.Gauge, ID: "g"}:     2.5,
+	})
+}
+
+func TestFollower_CatchUpWrongKey(t *testing.T) {
+	srv := snapshotServer(t, models.ReplicationSnapshot{Seq: 1})
+	defer srv.Close()
+
+	f := NewFollower(storage.NewMemStorage(), hostOf(t, srv), "other", testRetrier())
+	assert.Error(t, f.CatchUp(context.Background()))
+	assert.ErrorIs(t, f.Apply(context.Background(), nil), ErrNotReady)
+}
+
+func TestFollower_CatchUpError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	f := NewFollower(storage.NewMemStorage(), hostOf(t, srv), testKey, testRetrier())
+	assert.Error(t, f.CatchUp(context.Background()))
+	assert.ErrorIs(t, f.Apply(context.Background(), nil), ErrNotReady)
+}
+
+func assertValues(t *testing.T, mem *storage.MemStorage, want map[models.MetricKey]float64) {
+	t.Helper()
+	all, err := mem.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	got := make(map[models.MetricKey]float64, len(all))
+	for k, m := range all {
+		if m.Delta != nil {
+			got[k] = float64(*m.Delta)
+		} else {
+			got[k] = *m.Value
+		}
+	}
+	assert.Equal(t, want, got)
+}
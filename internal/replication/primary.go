@@ -0,0 +1,357 @@
+// Package replication пересылает пакеты метрик, принятые основным сервером, на реплики
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/retry"
+	"github.com/ValentinaKh/go-metrics/internal/utils"
+)
+
+const (
+	// UpdatesPath - адрес реплики, принимающий пакеты
+	UpdatesPath = "/replication/updates"
+	// SnapshotPath - адрес основного сервера, отдающий снимок для догоняющей реплики
+	SnapshotPath = "/replication/snapshot"
+
+	// sendBatches - сколько пакетов из очереди отправляется одним запросом
+	sendBatches = 100
+	// retryInterval - пауза перед новой попыткой, если реплика не приняла пакеты после всех повторов
+	retryInterval = 5 * time.Second
+	// keyStripes - число блокировок, по которым распределяются метрики пакетов
+	keyStripes = 64
+)
+
+// Snapshotter - хранилище, из которого снимается снимок для реплики
+type Snapshotter interface {
+	GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error)
+}
+
+// Primary нумерует принятые пакеты и кладет их в очередь каждой реплики. Очередь - журнал на диске,
+// поэтому пакеты, не доставленные до остановки сервера, отправляются после перезапуска.
+//
+// Номера пакетов начинаются с текущего времени в наносекундах, чтобы после перезапуска основного
+// сервера продолжать расти, даже если очереди уже пусты.
+type Primary struct {
+	strg    Snapshotter
+	targets []*target
+
+	// applyMu: запись пакета вместе с выдачей номера (RLock) не пересекается со снятием снимка (Lock),
+	// поэтому снимок с номером N содержит ровно пакеты с номерами <= N
+	applyMu sync.RWMutex
+	// stripes упорядочивают записи одних и тех же метрик: номер пакета выдается до того, как метрики
+	// запишет следующий пакет, и реплика применяет их в том же порядке. Записи разных метрик идут параллельно.
+	stripes [keyStripes]sync.Mutex
+	// mu упорядочивает выдачу номеров и запись в очереди
+	mu  sync.Mutex
+	seq uint64
+}
+
+// target - реплика и ее очередь
+type target struct {
+	name    string
+	url     string
+	key     string
+	queue   *fileworker.WAL
+	notify  chan struct{}
+	client  *http.Client
+	retrier *retry.Retrier
+	// resync - пакет не попал в очередь, реплика должна заново запросить снимок
+	resync atomic.Bool
+}
+
+// NewPrimary открывает очереди реплик в каталоге dir. followers - адреса реплик host:port, key - общий
+// ключ серверов, которым подписываются запросы к репликам.
+func NewPrimary(strg Snapshotter, followers []string, dir, key string, retrier *retry.Retrier) (*Primary, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	p := &Primary{strg: strg, seq: uint64(time.Now().UnixNano())}
+	for _, host := range followers {
+		queue, err := fileworker.OpenWAL(filepath.Join(dir, queueName(host)), fileworker.WALSyncAlways, 0)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.targets = append(p.targets, &target{
+			name:    host,
+			url:     (&url.URL{Scheme: "http", Host: host, Path: UpdatesPath}).String(),
+			key:     key,
+			queue:   queue,
+			notify:  make(chan struct{}, 1),
+			client:  &http.Client{Timeout: 30 * time.Second},
+			retrier: retrier,
+		})
+		last, err := lastSeq(queue)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.seq = max(p.seq, last)
+	}
+	return p, nil
+}
+
+// queueName - имя файла очереди реплики: адрес без символов, недопустимых в именах файлов
+func queueName(host string) string {
+	return strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(host) + ".queue"
+}
+
+// lastSeq возвращает номер последнего пакета в очереди
+func lastSeq(queue *fileworker.WAL) (uint64, error) {
+	var last uint64
+	err := queue.Replay(func(payload []byte) error {
+		var b models.ReplicationBatch
+		if err := json.Unmarshal(payload, &b); err != nil {
+			return err
+		}
+		last = max(last, b.Seq)
+		return nil
+	})
+	return last, err
+}
+
+// Replicate применяет пакет через apply и, если он применен, ставит его в очереди реплик. Если пакет
+// не удалось поставить в очередь реплики, она запросит снимок заново (resync).
+func (p *Primary) Replicate(ctx context.Context, metrics []models.Metrics,
+	apply func(ctx context.Context, metrics []models.Metrics) error) error {
+	keys := make([]models.MetricKey, 0, len(metrics))
+	for _, m := range metrics {
+		keys = append(keys, m.Key())
+	}
+	p.applyMu.RLock()
+	defer p.applyMu.RUnlock()
+	defer p.lock(keys)()
+	if err := apply(ctx, metrics); err != nil {
+		return err
+	}
+	p.enqueue(models.ReplicationBatch{Metrics: metrics})
+	return nil
+}
+
+// ReplicateDeleted удаляет устаревшие метрики через del и ставит ключи удаленных в очереди реплик
+func (p *Primary) ReplicateDeleted(ctx context.Context, expired []models.Expiration,
+	del func(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error)) ([]models.Metrics, error) {
+	keys := make([]models.MetricKey, 0, len(expired))
+	for _, e := range expired {
+		keys = append(keys, e.MetricKey)
+	}
+	p.applyMu.RLock()
+	defer p.applyMu.RUnlock()
+	defer p.lock(keys)()
+	deleted, err := del(ctx, expired)
+	if err != nil || len(deleted) == 0 {
+		return deleted, err
+	}
+	keys = keys[:0]
+	for _, m := range deleted {
+		keys = append(keys, m.Key())
+	}
+	p.enqueue(models.ReplicationBatch{Deleted: keys})
+	return deleted, nil
+}
+
+// lock захватывает блокировки метрик пакета в порядке номеров, чтобы пакеты не ждали друг друга по кругу,
+// и возвращает функцию их освобождения
+func (p *Primary) lock(keys []models.MetricKey) func() {
+	var locked [keyStripes]bool
+	for _, key := range keys {
+		locked[stripe(key)] = true
+	}
+	for i := range locked {
+		if locked[i] {
+			p.stripes[i].Lock()
+		}
+	}
+	return func() {
+		for i := range locked {
+			if locked[i] {
+				p.stripes[i].Unlock()
+			}
+		}
+	}
+}
+
+// stripe - FNV-1a от типа и имени метрики по модулю числа блокировок
+func stripe(key models.MetricKey) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key.MType))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key.ID))
+	return int(h.Sum32() % keyStripes)
+}
+
+// enqueue нумерует примененный пакет и ставит его в очереди реплик
+func (p *Primary) enqueue(batch models.ReplicationBatch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	batch.Seq = p.seq
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		logger.Log.Error("Error encoding replication batch", zap.Error(err))
+		p.resyncAll()
+		return
+	}
+	for _, t := range p.targets {
+		if err := t.queue.Append(payload); err != nil {
+			logger.Log.Error("Error queueing replication batch, follower will resync", zap.String("follower", t.name), zap.Error(err))
+			t.resync.Store(true)
+		}
+		t.wake()
+	}
+}
+
+func (p *Primary) resyncAll() {
+	for _, t := range p.targets {
+		t.resync.Store(true)
+		t.wake()
+	}
+}
+
+// Snapshot возвращает все метрики и номер последнего вошедшего в них пакета
+func (p *Primary) Snapshot(ctx context.Context) (models.ReplicationSnapshot, error) {
+	p.applyMu.Lock()
+	defer p.applyMu.Unlock()
+	metrics, err := p.strg.GetAllMetrics(ctx)
+	if err != nil {
+		return models.ReplicationSnapshot{}, err
+	}
+	p.mu.Lock()
+	snapshot := models.ReplicationSnapshot{Seq: p.seq, Metrics: make([]models.Metrics, 0, len(metrics))}
+	p.mu.Unlock()
+	for _, m := range metrics {
+		snapshot.Metrics = append(snapshot.Metrics, *m)
+	}
+	return snapshot, nil
+}
+
+// Run отправляет очереди репликам до отмены ctx
+func (p *Primary) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range p.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.run(ctx)
+		}()
+	}
+	wg.Wait()
+	p.Close()
+}
+
+// Close закрывает очереди реплик
+func (p *Primary) Close() {
+	for _, t := range p.targets {
+		if err := t.queue.Close(); err != nil {
+			logger.Log.Error("Error closing replication queue", zap.String("follower", t.name), zap.Error(err))
+		}
+	}
+}
+
+func (t *target) wake() {
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (t *target) run(ctx context.Context) {
+	for {
+		if t.resync.Load() {
+			if err := t.requestResync(ctx); err != nil {
+				logger.Log.Warn("Follower did not accept resync request, will retry", zap.String("follower", t.name), zap.Error(err))
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(retryInterval):
+				}
+				continue
+			}
+			t.resync.Store(false)
+		}
+
+		records, size, err := t.queue.ReadFront(sendBatches)
+		if err != nil {
+			logger.Log.Error("Error reading replication queue", zap.String("follower", t.name), zap.Error(err))
+			return
+		}
+		if len(records) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.notify:
+			}
+			continue
+		}
+
+		if err := t.send(ctx, records); err != nil {
+			logger.Log.Warn("Follower did not accept batches, will retry", zap.String("follower", t.name),
+				zap.Int("batches", len(records)), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+		if err := t.queue.TruncateFront(size); err != nil {
+			logger.Log.Error("Error truncating replication queue", zap.String("follower", t.name), zap.Error(err))
+			return
+		}
+	}
+}
+
+// requestResync просит реплику заново запросить снимок: пропущенный пакет войдет в него, а пакеты
+// из очереди с номерами не больше номера снимка реплика отбросит
+func (t *target) requestResync(ctx context.Context) error {
+	record, err := json.Marshal(models.ReplicationBatch{Resync: true})
+	if err != nil {
+		return err
+	}
+	return t.send(ctx, [][]byte{record})
+}
+
+// send отправляет пакеты одним запросом в виде JSON-массива, подписанным общим ключом серверов
+func (t *target) send(ctx context.Context, records [][]byte) error {
+	body := make([]byte, 0, len(records)*256)
+	body = append(body, '[')
+	body = append(body, bytes.Join(records, []byte{','})...)
+	body = append(body, ']')
+
+	_, err := retry.DoWithRetry(ctx, t.retrier, func() (struct{}, error) {
+		rq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+		if err != nil {
+			return struct{}{}, err
+		}
+		rq.Header.Set("Content-Type", "application/json")
+		utils.SignRequest(rq, t.key, body, time.Now())
+		rs, err := t.client.Do(rq)
+		if err != nil {
+			return struct{}{}, err
+		}
+		_ = rs.Body.Close()
+		if rs.StatusCode != http.StatusOK {
+			return struct{}{}, fmt.Errorf("unexpected status %d", rs.StatusCode)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
@@ -0,0 +1,345 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/apperror"
+	"github.com/ValentinaKh/go-metrics/internal/handler/middleware"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/retry"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+const testKey = "secret"
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+func testRetrier() *retry.Retrier {
+	return retry.NewRetrier(retry.NewClassifierRetryPolicy(apperror.NewNetworkErrorClassifier(), 1),
+		retry.NewStaticDelayStrategy([]time.Duration{0}), &retry.SleepTimeProvider{})
+}
+
+// receiver - реплика, запоминающая принятые пакеты
+type receiver struct {
+	mu      sync.Mutex
+	batches []models.ReplicationBatch
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var batches []models.ReplicationBatch
+	if r.URL.Path != UpdatesPath || json.NewDecoder(r.Body).Decode(&batches) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rc.mu.Lock()
+	rc.batches = append(rc.batches, batches...)
+	rc.mu.Unlock()
+}
+
+func (rc *receiver) received() []models.ReplicationBatch {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]models.ReplicationBatch(nil), rc.batches...)
+}
+
+func hostOf(t *testing.T, srv *httptest.Server) string {
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	return u.Host
+}
+
+func TestPrimary_ForwardsBatches(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(middleware.SignedRequestMW(testKey, time.Minute)(rc))
+	defer srv.Close()
+
+	mem := storage.NewMemStorage()
+	p, err := NewPrimary(mem, []string{hostOf(t, srv)}, t.TempDir(), testKey, testRetrier())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	first := []models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}}
+	second := []models.Metrics{{ID: "g", MType: models.Gauge, Value: toPtr(2.5)}}
+	require.NoError(t, p.Replicate(ctx, first, mem.UpdateMetrics))
+	require.NoError(t, p.Replicate(ctx, second, mem.UpdateMetrics))
+
+	require.Eventually(t, func() bool { return len(rc.received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	got := rc.received()
+	assert.Equal(t, first, got[0].Metrics)
+	assert.Equal(t, second, got[1].Metrics)
+	assert.Equal(t, got[0].Seq+1, got[1].Seq)
+
+	stored, err := mem.GetMetric(ctx, models.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *stored.Delta)
+}
+
+func TestPrimary_NotAppliedIsNotQueued(t *testing.T) {
+	p, err := NewPrimary(storage.NewMemStorage(), []string{"127.0.0.1:1"}, t.TempDir(), testKey, testRetrier())
+	require.NoError(t, err)
+	defer p.Close()
+
+	err = p.Replicate(context.Background(), []models.Metrics{{ID: "c", MType: models.Counter}},
+		func(context.Context, []models.Metrics) error { return assert.AnError })
+	assert.ErrorIs(t, err, assert.AnError)
+
+	records, _, err := p.targets[0].queue.ReadFront(10)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestPrimary_QueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	follower := "127.0.0.1:1"
+	mem := storage.NewMemStorage()
+
+	p, err := NewPrimary(mem, []string{follower}, dir, testKey, testRetrier())
+	require.NoError(t, err)
+	require.NoError(t, p.Replicate(context.Background(),
+		[]models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}}, mem.UpdateMetrics))
+	lastSeq := p.seq
+	p.Close()
+
+	// номер следующего пакета после перезапуска больше всех, оставшихся в очереди
+	p, err = NewPrimary(mem, []string{follower}, dir, testKey, testRetrier())
+	require.NoError(t, err)
+	defer p.Close()
+	assert.GreaterOrEqual(t, p.seq, lastSeq)
+
+	records, _, err := p.targets[0].queue.ReadFront(10)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	var b models.ReplicationBatch
+	require.NoError(t, json.Unmarshal(records[0], &b))
+	assert.Equal(t, lastSeq, b.Seq)
+}
+
+func TestPrimary_Snapshot(t *testing.T) {
+	mem := storage.NewMemStorage()
+	p, err := NewPrimary(mem, nil, t.TempDir(), testKey, testRetrier())
+	require.NoError(t, err)
+
+	require.NoError(t, p.Replicate(context.Background(),
+		[]models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(3))}}, mem.UpdateMetrics))
+	require.NoError(t, p.Replicate(context.Background(),
+		[]models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(4))}}, mem.UpdateMetrics))
+
+	snapshot, err := p.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, p.seq, snapshot.Seq)
+	require.Len(t, snapshot.Metrics, 1)
+	assert.Equal(t, int64(7), *snapshot.Metrics[0].Delta)
+}
+
+func TestPrimary_ConcurrentGaugesKeepOrder(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemStorage()
+	p, err := NewPrimary(mem, []string{"127.0.0.1:1"}, t.TempDir(), testKey, testRetrier())
+	require.NoError(t, err)
+	defer p.Close()
+
+	// между записью в хранилище и постановкой в очередь другие писатели успевают записать свои значения
+	apply := func(ctx context.Context, metrics []models.Metrics) error {
+		err := mem.UpdateMetrics(ctx, metrics)
+		time.Sleep(time.Millisecond)
+		return err
+	}
+	const writers, writes = 8, 20
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range writes {
+				value := float64(w*writes + i)
+				require.NoError(t, p.Replicate(ctx,
+					[]models.Metrics{{ID: "g", MType: models.Gauge, Value: &value}}, apply))
+			}
+		}()
+	}
+	wg.Wait()
+
+	records, _, err := p.targets[0].queue.ReadFront(writers * writes)
+	require.NoError(t, err)
+	batches := make([]models.ReplicationBatch, 0, len(records))
+	for _, r := range records {
+		var b models.ReplicationBatch
+		require.NoError(t, json.Unmarshal(r, &b))
+		batches = append(batches, b)
+	}
+
+	replica := storage.NewMemStorage()
+	f := NewFollower(replica, "127.0.0.1:1", testKey, testRetrier())
+	f.ready = true
+	require.NoError(t, f.Apply(ctx, batches))
+
+	want, err := mem.GetMetric(ctx, models.Gauge, "g")
+	require.NoError(t, err)
+	got, err := replica.GetMetric(ctx, models.Gauge, "g")
+	require.NoError(t, err)
+	assert.Equal(t, *want.Value, *got.Value)
+}
+
+func TestPrimary_ReplicatesDeletions(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemStorage()
+	p, err := NewPrimary(mem, []string{"127.0.0.1:1"}, t.TempDir(), testKey, testRetrier())
+	require.NoError(t, err)
+	defer p.Close()
+
+	metrics := []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: "g", MType: models.Gauge, Value: toPtr(2.5)},
+	}
+	require.NoError(t, p.Replicate(ctx, metrics, mem.UpdateMetrics))
+	expired := []models.Expiration{{MetricKey: metrics[1].Key(), Before: time.Now().Add(time.Minute)}}
+	deleted, err := p.ReplicateDeleted(ctx, expired, mem.DeleteExpired)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	// повторное удаление ничего не удаляет и не ставится в очередь
+	_, err = p.ReplicateDeleted(ctx, expired, mem.DeleteExpired)
+	require.NoError(t, err)
+
+	records, _, err := p.targets[0].queue.ReadFront(10)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	batches := make([]models.ReplicationBatch, 0, len(records))
+	for _, r := range records {
+		var b models.ReplicationBatch
+		require.NoError(t, json.Unmarshal(r, &b))
+		batches = append(batches, b)
+	}
+	assert.Equal(t, []models.MetricKey{metrics[1].Key()}, batches[1].Deleted)
+
+	replica := storage.NewMemStorage()
+	f := NewFollower(replica, "127.0.0.1:1", testKey, testRetrier())
+	f.ready = true
+	require.NoError(t, f.Apply(ctx, batches))
+	assertValues(t, replica, map[models.MetricKey]float64{{MType: models.Counter, ID: "c"}: 1})
+}
+
+func TestPrimary_DifferentMetricsInParallel(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewPrimary(storage.NewMemStorage(), nil, t.TempDir(), testKey, testRetrier())
+	require.NoError(t, err)
+
+	first := models.Metrics{ID: "a", MType: models.Gauge, Value: toPtr(1.0)}
+	second := models.Metrics{ID: "b", MType: models.Gauge, Value: toPtr(2.0)}
+	for i := 0; stripe(first.Key()) == stripe(second.Key()); i++ {
+		second.ID = fmt.Sprintf("b%d", i)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- p.Replicate(ctx, []models.Metrics{first}, func(context.Context, []models.Metrics) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// запись другой метрики не ждет медленную запись
+	require.NoError(t, p.Replicate(ctx, []models.Metrics{second}, func(context.Context, []models.Metrics) error { return nil }))
+	close(release)
+	require.NoError(t, <-done)
+}
+
+func TestPrimary_QueueErrorRequestsResync(t *testing.T) {
+	p, err := NewPrimary(storage.NewMemStorage(), []string{"127.0.0.1:1"}, t.TempDir(), testKey, testRetrier())
+	require.NoError(t, err)
+	require.NoError(t, p.targets[0].queue.Close())
+
+	require.NoError(t, p.Replicate(context.Background(), []models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}},
+		func(context.Context, []models.Metrics) error { return nil }))
+	assert.True(t, p.targets[0].resync.Load())
+}
+
+func TestPrimary_ResyncFollower(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	mem, replica := storage.NewMemStorage(), storage.NewMemStorage()
+	var p *Primary
+	var f *Follower
+	primarySrv := httptest.NewServer(middleware.SignedRequestMW(testKey, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snapshot, err := p.Snapshot(r.Context())
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(w).Encode(snapshot))
+	})))
+	defer primarySrv.Close()
+	followerSrv := httptest.NewServer(middleware.SignedRequestMW(testKey, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batches []models.ReplicationBatch
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batches))
+		if err := f.Apply(r.Context(), batches); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})))
+	defer followerSrv.Close()
+
+	var err error
+	p, err = NewPrimary(mem, []string{hostOf(t, followerSrv)}, t.TempDir(), testKey, testRetrier())
+	require.NoError(t, err)
+	f = NewFollower(replica, hostOf(t, primarySrv), testKey, testRetrier())
+	require.NoError(t, f.CatchUp(ctx))
+	for _, run := range []func(context.Context){p.Run, f.Run} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx)
+		}()
+	}
+
+	require.NoError(t, p.Replicate(ctx, []models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}}, mem.UpdateMetrics))
+	// пакет применен, но не попал в очередь реплики
+	require.NoError(t, mem.UpdateMetric(ctx, models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(2.5)}))
+	p.targets[0].resync.Store(true)
+	p.targets[0].wake()
+	require.NoError(t, p.Replicate(ctx, []models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(2))}}, mem.UpdateMetrics))
+
+	want := map[models.MetricKey]float64{
+		{MType: models.Counter, ID: "c"}: 3,
+		{MType: models.Gauge, ID: "g"}:   2.5,
+	}
+	require.Eventually(t, func() bool {
+		all, err := replica.GetAllMetrics(ctx)
+		if err != nil || len(all) != len(want) {
+			return false
+		}
+		for k, v := range want {
+			m := all[k]
+			if m == nil || (m.Delta != nil && float64(*m.Delta) != v) || (m.Value != nil && *m.Value != v) {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+}
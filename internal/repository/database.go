@@ -1,23 +1,82 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 
 	"github.com/ValentinaKh/go-metrics/internal/logger"
 )
 
+const (
+	waitInitialDelay = 100 * time.Millisecond
+	waitMaxDelay     = 5 * time.Second
+)
+
+// DBConfig - настройки пула соединений, не зависящие от строки подключения. Нулевые значения
+// оставляют поведение database/sql по умолчанию.
+type DBConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// QueryTimeout - statement_timeout для каждого запроса; миграции выполняются без него
+	QueryTimeout time.Duration
+}
+
 // MustConnectDB connect to db
-func MustConnectDB(connectionString string) *sql.DB {
+func MustConnectDB(connectionString string, cfg DBConfig) *sql.DB {
 	if connectionString == "" {
 		panic("connection string is empty")
 	}
-	db, err := sql.Open("pgx", connectionString)
+	connConfig, err := pgx.ParseConfig(connectionString)
 	if err != nil {
 		logger.Log.Panic("error open db", zap.Error(err))
 		panic(err)
 	}
+	if cfg.QueryTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.QueryTimeout.Milliseconds(), 10)
+	}
+
+	db := stdlib.OpenDB(*connConfig)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 	return db
 }
+
+// WaitForDB ждет доступности базы, повторяя ping с экспоненциальной задержкой, но не дольше timeout
+func WaitForDB(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := waitInitialDelay
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		logger.Log.Warn("Database is not available yet", zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database is not available after %s: %w", timeout, err)
+		case <-time.After(delay):
+		}
+		delay = nextDelay(delay)
+	}
+}
+
+func nextDelay(d time.Duration) time.Duration {
+	d *= 2
+	if d > waitMaxDelay {
+		return waitMaxDelay
+	}
+	return d
+}
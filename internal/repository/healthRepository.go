@@ -3,15 +3,19 @@ package repository
 import (
 	"context"
 	"database/sql"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
 
 type HealthRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	replicas []*Replica
 }
 
-func NewHealthRepository(db *sql.DB) *HealthRepository {
+func NewHealthRepository(db *sql.DB, replicas ...*Replica) *HealthRepository {
 	return &HealthRepository{
-		db: db,
+		db:       db,
+		replicas: replicas,
 	}
 }
 
@@ -19,3 +23,22 @@ func NewHealthRepository(db *sql.DB) *HealthRepository {
 func (h *HealthRepository) Ping(ctx context.Context) error {
 	return h.db.PingContext(ctx)
 }
+
+// PingAll проверяет основную базу и каждую реплику. Первым в ответе идет основная база.
+func (h *HealthRepository) PingAll(ctx context.Context) []models.ConnectionStatus {
+	result := make([]models.ConnectionStatus, 0, len(h.replicas)+1)
+	result = append(result, pingStatus(ctx, models.RolePrimary, models.RolePrimary, h.db))
+	for _, r := range h.replicas {
+		result = append(result, pingStatus(ctx, r.Name, models.RoleReplica, r.DB))
+	}
+	return result
+}
+
+func pingStatus(ctx context.Context, name, role string, db *sql.DB) models.ConnectionStatus {
+	s := models.ConnectionStatus{Name: name, Role: role, Healthy: true}
+	if err := db.PingContext(ctx); err != nil {
+		s.Healthy = false
+		s.Error = err.Error()
+	}
+	return s
+}
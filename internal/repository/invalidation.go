@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// InvalidationChannel - канал LISTEN/NOTIFY, через который серверы с общей базой сообщают об измененных метриках
+const InvalidationChannel = "metrics_invalidation"
+
+const (
+	// maxNotifyPayload - размер сообщения NOTIFY (ограничение PostgreSQL - 8000 байт) с запасом
+	maxNotifyPayload = 7900
+	// listenRetryInterval - пауза перед повторным подключением слушателя после обрыва соединения
+	listenRetryInterval = 5 * time.Second
+)
+
+// invalidation - сообщение NOTIFY. Пустой Keys означает, что изменились все метрики: так отправляется
+// пакет, ключи которого не помещаются в одно сообщение.
+type invalidation struct {
+	Source string             `json:"source"`
+	Keys   []models.MetricKey `json:"keys,omitempty"`
+}
+
+// InvalidationBus рассылает ключи измененных метрик другим серверам с общей базой и принимает их от них.
+// Свои сообщения сервер узнает по source и пропускает.
+type InvalidationBus struct {
+	db     *sql.DB
+	source string
+}
+
+func NewInvalidationBus(db *sql.DB) *InvalidationBus {
+	return &InvalidationBus{db: db, source: rand.Text()}
+}
+
+// Publish отправляет ключи измененных метрик
+func (b *InvalidationBus) Publish(ctx context.Context, keys []models.MetricKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	payload, err := b.payload(keys)
+	if err != nil {
+		return err
+	}
+	if _, err := b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", InvalidationChannel, payload); err != nil {
+		return fmt.Errorf("ошибка при отправке уведомления: %w", err)
+	}
+	return nil
+}
+
+func (b *InvalidationBus) payload(keys []models.MetricKey) (string, error) {
+	data, err := json.Marshal(invalidation{Source: b.source, Keys: keys})
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxNotifyPayload {
+		data, err = json.Marshal(invalidation{Source: b.source})
+	}
+	return string(data), err
+}
+
+// Listen принимает сообщения других серверов до отмены ctx: ключи передаются в invalidate, сообщение
+// обо всех метриках - в reset. После (пере)подключения вызывается reset, т.к. сообщения, отправленные
+// без подписки, потеряны.
+func (b *InvalidationBus) Listen(ctx context.Context, invalidate func(keys ...models.MetricKey), reset func()) {
+	for {
+		err := b.listen(ctx, invalidate, reset)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Log.Warn("Cache invalidation listener disconnected", zap.Duration("retry_in", listenRetryInterval), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+func (b *InvalidationBus) listen(ctx context.Context, invalidate func(keys ...models.MetricKey), reset func()) error {
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		pgConn := c.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+InvalidationChannel); err != nil {
+			return err
+		}
+		reset()
+		logger.Log.Info("Cache invalidation listener connected")
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				// соединение с подпиской не должно вернуться в пул
+				return errors.Join(err, driver.ErrBadConn)
+			}
+			b.handle(n.Payload, invalidate, reset)
+		}
+	})
+}
+
+func (b *InvalidationBus) handle(payload string, invalidate func(keys ...models.MetricKey), reset func()) {
+	var msg invalidation
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		logger.Log.Warn("Invalid cache invalidation message", zap.String("payload", payload), zap.Error(err))
+		reset()
+		return
+	}
+	if msg.Source == b.source {
+		return
+	}
+	if len(msg.Keys) == 0 {
+		reset()
+		return
+	}
+	invalidate(msg.Keys...)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func TestInvalidationBus_Payload(t *testing.T) {
+	b := &InvalidationBus{source: "a"}
+
+	payload, err := b.payload([]models.MetricKey{{MType: models.Gauge, ID: "g"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"source":"a","keys":[{"type":"gauge","id":"g"}]}`, payload)
+
+	// большой пакет не помещается в NOTIFY и отправляется как изменение всех метрик
+	keys := make([]models.MetricKey, 500)
+	for i := range keys {
+		keys[i] = models.MetricKey{MType: models.Gauge, ID: fmt.Sprintf("metric_%d", i)}
+	}
+	payload, err = b.payload(keys)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"source":"a"}`, payload)
+}
+
+func TestInvalidationBus_Handle(t *testing.T) {
+	keys := []models.MetricKey{{MType: models.Counter, ID: "c"}}
+	data, err := json.Marshal(invalidation{Source: "other", Keys: keys})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		payload   string
+		wantKeys  []models.MetricKey
+		wantReset bool
+	}{
+		{name: "keys from other server", payload: string(data), wantKeys: keys},
+		{name: "own message", payload: `{"source":"self","keys":[{"type":"counter","id":"c"}]}`},
+		{name: "all metrics", payload: `{"source":"other"}`, wantReset: true},
+		{name: "invalid message", payload: `not json`, wantReset: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &InvalidationBus{source: "self"}
+			var gotKeys []models.MetricKey
+			var reset bool
+			b.handle(tt.payload, func(keys ...models.MetricKey) { gotKeys = keys }, func() { reset = true })
+			assert.Equal(t, tt.wantKeys, gotKeys)
+			assert.Equal(t, tt.wantReset, reset)
+		})
+	}
+}
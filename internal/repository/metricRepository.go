@@ -3,9 +3,11 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/ValentinaKh/go-metrics/internal/logger"
 	"sort"
+	"time"
 
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 	"github.com/ValentinaKh/go-metrics/internal/retry"
@@ -13,12 +15,15 @@ import (
 
 type MetricsRepository struct {
 	db      *sql.DB
+	reads   *readRouter
 	retrier *retry.Retrier
 }
 
-func NewMetricsRepository(db *sql.DB, retrier *retry.Retrier) *MetricsRepository {
+// NewMetricsRepository - запись всегда идет в db, чтение - на replicas по кругу с откатом на db
+func NewMetricsRepository(db *sql.DB, retrier *retry.Retrier, replicas ...*Replica) *MetricsRepository {
 	return &MetricsRepository{
 		db:      db,
+		reads:   newReadRouter(db, replicas),
 		retrier: retrier,
 	}
 }
@@ -29,18 +34,16 @@ func (r *MetricsRepository) UpdateMetric(ctx context.Context, value models.Metri
 		switch value.MType {
 		case models.Counter:
 			_, err := r.db.ExecContext(ctx, "INSERT INTO metrics (name, type_metrics, delta) VALUES ($1, $2, $3) "+
-				" ON CONFLICT (name) DO UPDATE"+
-				" SET type_metrics = EXCLUDED.type_metrics,"+
-				" delta = metrics.delta+EXCLUDED.delta",
+				" ON CONFLICT (name, type_metrics) DO UPDATE"+
+				" SET delta = metrics.delta+EXCLUDED.delta, updated_at = now()",
 				value.ID, value.MType, value.Delta)
 			if err != nil {
 				return struct{}{}, fmt.Errorf("ошибка при обновлении Counter: %w", err)
 			}
 		case models.Gauge:
 			_, err := r.db.ExecContext(ctx, "INSERT INTO metrics (name, type_metrics, \"value\") VALUES ($1, $2, $3) "+
-				" ON CONFLICT (name) DO UPDATE"+
-				" SET type_metrics = EXCLUDED.type_metrics,"+
-				" value = EXCLUDED.value",
+				" ON CONFLICT (name, type_metrics) DO UPDATE"+
+				" SET value = EXCLUDED.value, updated_at = now()",
 				value.ID, value.MType, value.Value)
 			if err != nil {
 				return struct{}{}, fmt.Errorf("ошибка при обновлении Gauge: %w", err)
@@ -52,126 +55,220 @@ func (r *MetricsRepository) UpdateMetric(ctx context.Context, value models.Metri
 	return err
 }
 
-// GetAllMetrics - получение всех метрик
-func (r *MetricsRepository) GetAllMetrics(ctx context.Context) (map[string]*models.Metrics, error) {
-	response, err := retry.DoWithRetry(ctx, r.retrier, func() (map[string]*models.Metrics, error) {
-		metrics := make(map[string]*models.Metrics)
-
-		rows, err := r.db.QueryContext(ctx, "SELECT  \"name\", type_metrics, delta, \"value\" FROM metrics")
-		if err != nil {
-			return nil, fmt.Errorf("ошибка при получении данных: %w", err)
-		}
-		defer func(rows *sql.Rows) {
-			err := rows.Close()
-			if err != nil {
-				logger.Log.Error("ошибка при закрытии rows")
-			}
-		}(rows)
+// GetAllMetrics - получение всех метрик. Читает с реплики, если они настроены.
+func (r *MetricsRepository) GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error) {
+	return retry.DoWithRetry(ctx, r.retrier, func() (map[models.MetricKey]*models.Metrics, error) {
+		var metrics map[models.MetricKey]*models.Metrics
+		err := r.reads.read(ctx, func(db *sql.DB) error {
+			var err error
+			metrics, err = queryMetrics(ctx, db, "SELECT  \"name\", type_metrics, delta, \"value\", updated_at FROM metrics")
+			return err
+		})
+		return metrics, err
+	})
+}
 
-		for rows.Next() {
+// GetMetric - получение метрики по типу и имени, nil если метрики нет
+func (r *MetricsRepository) GetMetric(ctx context.Context, mType, id string) (*models.Metrics, error) {
+	return retry.DoWithRetry(ctx, r.retrier, func() (*models.Metrics, error) {
+		var found *models.Metrics
+		err := r.reads.read(ctx, func(db *sql.DB) error {
 			var v models.Metrics
-			err = rows.Scan(&v.ID, &v.MType, &v.Delta, &v.Value)
+			err := db.QueryRowContext(ctx, "SELECT \"name\", type_metrics, delta, \"value\", updated_at FROM metrics"+
+				" WHERE \"name\" = $1 AND type_metrics = $2", id, mType).
+				Scan(&v.ID, &v.MType, &v.Delta, &v.Value, &v.UpdatedAt)
+			if errors.Is(err, sql.ErrNoRows) {
+				found = nil
+				return nil
+			}
 			if err != nil {
-				return nil, fmt.Errorf("ошибка при получении данных по строке: %w", err)
+				return fmt.Errorf("ошибка при получении метрики: %w", err)
 			}
-			metrics[v.ID] = &v
-		}
+			found = &v
+			return nil
+		})
+		return found, err
+	})
+}
+
+// GetMetrics - получение метрик по списку ключей одним запросом
+func (r *MetricsRepository) GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	if len(keys) == 0 {
+		return map[models.MetricKey]*models.Metrics{}, nil
+	}
+	names := make([]string, len(keys))
+	types := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.ID
+		types[i] = k.MType
+	}
 
-		err = rows.Err()
+	return retry.DoWithRetry(ctx, r.retrier, func() (map[models.MetricKey]*models.Metrics, error) {
+		var metrics map[models.MetricKey]*models.Metrics
+		err := r.reads.read(ctx, func(db *sql.DB) error {
+			var err error
+			metrics, err = queryMetrics(ctx, db, "SELECT m.\"name\", m.type_metrics, m.delta, m.\"value\", m.updated_at FROM metrics m"+
+				" JOIN unnest($1::text[], $2::text[]) AS k(name, type_metrics)"+
+				" ON m.\"name\" = k.name AND m.type_metrics = k.type_metrics", names, types)
+			return err
+		})
+		return metrics, err
+	})
+}
+
+// DeleteExpired удаляет метрики, не обновлявшиеся с момента Before, и возвращает удаленные
+func (r *MetricsRepository) DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error) {
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	names := make([]string, len(expired))
+	types := make([]string, len(expired))
+	before := make([]time.Time, len(expired))
+	for i, e := range expired {
+		names[i] = e.ID
+		types[i] = e.MType
+		before[i] = e.Before
+	}
+
+	return retry.DoWithRetry(ctx, r.retrier, func() ([]models.Metrics, error) {
+		deleted, err := queryMetrics(ctx, r.db, "DELETE FROM metrics m"+
+			" USING unnest($1::text[], $2::text[], $3::timestamptz[]) AS k(name, type_metrics, before)"+
+			" WHERE m.\"name\" = k.name AND m.type_metrics = k.type_metrics AND m.updated_at < k.before"+
+			" RETURNING m.\"name\", m.type_metrics, m.delta, m.\"value\", m.updated_at", names, types, before)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при получении данных: %w", err)
+			return nil, err
 		}
-		return metrics, nil
+		result := make([]models.Metrics, 0, len(deleted))
+		for _, m := range deleted {
+			result = append(result, *m)
+		}
+		return result, nil
 	})
-	return response, err
 }
 
-// UpdateMetrics - обновление метрик
-func (r *MetricsRepository) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
-	sort.Slice(values, func(i, j int) bool {
-		return values[i].ID < values[j].ID
-	})
-	_, err := retry.DoWithRetry(ctx, r.retrier, func() (struct{}, error) {
-		tx, err := r.db.BeginTx(ctx, nil)
+// queryMetrics выполняет запрос, возвращающий строки metrics, и собирает их по типу и имени
+func queryMetrics(ctx context.Context, db *sql.DB, query string, args ...any) (map[models.MetricKey]*models.Metrics, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении данных: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
 		if err != nil {
-			return struct{}{}, fmt.Errorf("не удалось создать транзакцию: %w", err)
+			logger.Log.Error("ошибка при закрытии rows")
 		}
-		defer func(tx *sql.Tx) {
-			err := tx.Rollback()
-			if err != nil {
-				logger.Log.Error("не удалось откатить транзакцию")
-			}
-		}(tx)
-
-		stmt, err := tx.PrepareContext(ctx, "INSERT INTO metrics (name, type_metrics, delta, value) VALUES ($1, $2, $3, $4) "+
-			" ON CONFLICT (name) DO UPDATE"+
-			" SET type_metrics = COALESCE(EXCLUDED.type_metrics, metrics.type_metrics),"+
-			" delta = CASE "+
-			" WHEN $3 IS NOT NULL THEN metrics.delta + $3"+
-			" ELSE metrics.delta "+
-			" END, "+
-			" value = COALESCE(EXCLUDED.value, metrics.value)")
+	}(rows)
+
+	metrics := make(map[models.MetricKey]*models.Metrics)
+	for rows.Next() {
+		var v models.Metrics
+		err = rows.Scan(&v.ID, &v.MType, &v.Delta, &v.Value, &v.UpdatedAt)
 		if err != nil {
-			return struct{}{}, fmt.Errorf("не удалось создать запрос: %w", err)
+			return nil, fmt.Errorf("ошибка при получении данных по строке: %w", err)
 		}
-		defer func(stmt *sql.Stmt) {
-			err := stmt.Close()
-			if err != nil {
-				logger.Log.Error("не удалось закрыть stmt")
-			}
-		}(stmt)
+		metrics[v.Key()] = &v
+	}
 
-		for _, elem := range values {
-			_, err := stmt.ExecContext(ctx, elem.ID, elem.MType, elem.Delta, elem.Value)
-			if err != nil {
-				return struct{}{}, fmt.Errorf("не удалось вставить или обновить запись: %w", err)
-			}
-		}
-		err = tx.Commit()
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении данных: %w", err)
+	}
+	return metrics, nil
+}
+
+// batchUpsert применяет пакет одним запросом. Семантика совпадает с UpdateMetric, примененным по очереди:
+// delta прибавляется к сохраненной, value заменяет сохраненное, если задано.
+const batchUpsert = "INSERT INTO metrics (name, type_metrics, delta, value)" +
+	" SELECT * FROM unnest($1::text[], $2::text[], $3::bigint[], $4::double precision[])" +
+	" ON CONFLICT (name, type_metrics) DO UPDATE" +
+	" SET delta = CASE" +
+	" WHEN EXCLUDED.delta IS NOT NULL THEN metrics.delta + EXCLUDED.delta" +
+	" ELSE metrics.delta" +
+	" END," +
+	" value = COALESCE(EXCLUDED.value, metrics.value)," +
+	" updated_at = now()"
+
+// UpdateMetrics - обновление метрик одним запросом. Повторы одной метрики в пакете предварительно
+// схлопываются, т.к. INSERT ... ON CONFLICT не может обновить одну строку дважды.
+func (r *MetricsRepository) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	if len(values) == 0 {
+		return nil
+	}
+	b := aggregateBatch(values)
+	_, err := retry.DoWithRetry(ctx, r.retrier, func() (struct{}, error) {
+		_, err := r.db.ExecContext(ctx, batchUpsert, b.names, b.types, b.deltas, b.values)
 		if err != nil {
-			return struct{}{}, fmt.Errorf("не удалось завершить запрос: %w", err)
+			return struct{}{}, fmt.Errorf("не удалось вставить или обновить записи: %w", err)
 		}
 		return struct{}{}, nil
 	})
 	return err
 }
 
-// InitTables - инициализация таблиц
-func InitTables(ctx context.Context, db *sql.DB) {
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		panic(err)
-	}
-	defer func(tx *sql.Tx) {
-		err := tx.Rollback()
-		if err != nil {
-			logger.Log.Error("не удалось откатить транзакцию")
+// batch - столбцы для unnest, по одной строке на метрику
+type batch struct {
+	names  []string
+	types  []string
+	deltas []*int64
+	values []*float64
+}
+
+// aggregateBatch схлопывает повторы метрик с одинаковыми типом и именем: value берется из последнего заданного
+// значения, delta суммируются. Строки сортируются по имени и типу, чтобы параллельные пакеты блокировали
+// строки в одном порядке.
+func aggregateBatch(values []models.Metrics) batch {
+	index := make(map[models.MetricKey]int, len(values))
+	rows := make([]models.Metrics, 0, len(values))
+	for _, v := range values {
+		i, ok := index[v.Key()]
+		if !ok {
+			index[v.Key()] = len(rows)
+			rows = append(rows, models.Metrics{ID: v.ID, MType: v.MType, Delta: copyInt(v.Delta), Value: copyFloat(v.Value)})
+			continue
+		}
+		row := &rows[i]
+		if v.Delta != nil {
+			if row.Delta == nil {
+				row.Delta = copyInt(v.Delta)
+			} else {
+				*row.Delta += *v.Delta
+			}
+		}
+		if v.Value != nil {
+			row.Value = copyFloat(v.Value)
 		}
-	}(tx)
-	query := `
-			CREATE TABLE IF NOT EXISTS metrics (
-            	id SERIAL PRIMARY KEY,
-                name VARCHAR(255) NOT NULL,
-                type_metrics VARCHAR(255) NOT NULL,
-            	delta bigint,
-                value DOUBLE PRECISION
-)
-`
-	_, err = tx.ExecContext(ctx, query)
-	if err != nil {
-		panic(err)
 	}
-	_, err = tx.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_name ON metrics(name)`)
-	if err != nil {
-		panic(err)
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Key().Less(rows[j].Key())
+	})
+
+	b := batch{
+		names:  make([]string, len(rows)),
+		types:  make([]string, len(rows)),
+		deltas: make([]*int64, len(rows)),
+		values: make([]*float64, len(rows)),
+	}
+	for i, row := range rows {
+		b.names[i] = row.ID
+		b.types[i] = row.MType
+		b.deltas[i] = row.Delta
+		b.values[i] = row.Value
 	}
+	return b
+}
 
-	_, err = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_metrics_type ON metrics(type_metrics)`)
-	if err != nil {
-		panic(err)
+func copyInt(p *int64) *int64 {
+	if p == nil {
+		return nil
 	}
-	err = tx.Commit()
-	if err != nil {
-		panic(err)
+	v := *p
+	return &v
+}
+
+func copyFloat(p *float64) *float64 {
+	if p == nil {
+		return nil
 	}
+	v := *p
+	return &v
 }
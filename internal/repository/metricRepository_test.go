@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/apperror"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/retry"
+)
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+func TestAggregateBatch(t *testing.T) {
+	got := aggregateBatch([]models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(2))},
+		{ID: "g", MType: models.Gauge, Value: toPtr(1.0)},
+		{ID: "a", MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(3))},
+		{ID: "g", MType: models.Gauge, Value: toPtr(5.0)},
+		{ID: "g", MType: models.Gauge},
+	})
+
+	assert.Equal(t, batch{
+		names:  []string{"a", "c", "g"},
+		types:  []string{models.Counter, models.Counter, models.Gauge},
+		deltas: []*int64{toPtr(int64(1)), toPtr(int64(5)), nil},
+		values: []*float64{nil, nil, toPtr(5.0)},
+	}, got)
+}
+
+func TestAggregateBatch_SameNameDifferentTypes(t *testing.T) {
+	got := aggregateBatch([]models.Metrics{
+		{ID: "m", MType: models.Gauge, Value: toPtr(1.0)},
+		{ID: "m", MType: models.Counter, Delta: toPtr(int64(2))},
+		{ID: "m", MType: models.Counter, Delta: toPtr(int64(3))},
+	})
+
+	assert.Equal(t, batch{
+		names:  []string{"m", "m"},
+		types:  []string{models.Counter, models.Gauge},
+		deltas: []*int64{toPtr(int64(5)), nil},
+		values: []*float64{nil, toPtr(1.0)},
+	}, got)
+}
+
+func TestAggregateBatch_DoesNotModifyInput(t *testing.T) {
+	values := []models.Metrics{
+		{ID: "b", MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: "a", MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: "b", MType: models.Counter, Delta: toPtr(int64(1))},
+	}
+	aggregateBatch(values)
+	assert.Equal(t, "b", values[0].ID)
+	assert.Equal(t, int64(1), *values[0].Delta)
+}
+
+// row - строка таблицы metrics
+type row struct {
+	delta *int64
+	value *float64
+}
+
+// upsertRow повторяет ON CONFLICT (name, type_metrics) из UpdateMetric/batchUpsert для одной строки
+func upsertRow(table map[models.MetricKey]row, name, mType string, delta *int64, value *float64) {
+	key := models.MetricKey{MType: mType, ID: name}
+	cur, ok := table[key]
+	if !ok {
+		table[key] = row{delta: delta, value: value}
+		return
+	}
+	if delta != nil && cur.delta != nil {
+		sum := *cur.delta + *delta
+		cur.delta = &sum
+	} else if delta != nil {
+		cur.delta = nil
+	}
+	if value != nil {
+		cur.value = value
+	}
+	table[key] = cur
+}
+
+// TestAggregateBatch_MatchesSequentialUpserts проверяет, что один пакетный upsert дает то же состояние
+// таблицы, что и построчное применение метрик по очереди
+func TestAggregateBatch_MatchesSequentialUpserts(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		initial := map[models.MetricKey]row{
+			{MType: models.Counter, ID: "m0"}: {delta: toPtr(int64(10))},
+			{MType: models.Gauge, ID: "m0"}:   {value: toPtr(1.5)},
+		}
+		var values []models.Metrics
+		for j := 0; j < 1+rnd.Intn(20); j++ {
+			n := rnd.Intn(3)
+			if rnd.Intn(2) == 0 {
+				values = append(values, models.Metrics{ID: fmt.Sprintf("m%d", n), MType: models.Counter, Delta: toPtr(rnd.Int63n(100))})
+			} else {
+				values = append(values, models.Metrics{ID: fmt.Sprintf("m%d", n), MType: models.Gauge, Value: toPtr(rnd.Float64())})
+			}
+		}
+
+		sequential := make(map[models.MetricKey]row)
+		batched := make(map[models.MetricKey]row)
+		for k, v := range initial {
+			sequential[k] = v
+			batched[k] = v
+		}
+		for _, v := range values {
+			upsertRow(sequential, v.ID, v.MType, v.Delta, v.Value)
+		}
+		b := aggregateBatch(values)
+		for k := range b.names {
+			upsertRow(batched, b.names[k], b.types[k], b.deltas[k], b.values[k])
+		}
+		require.Equal(t, sequential, batched, "batch %v", values)
+	}
+}
+
+// benchBatch - пакет агента: gauge runtime-метрик и счетчик с повторами
+func benchBatch(n int) []models.Metrics {
+	values := make([]models.Metrics, 0, n)
+	for i := 0; i < n; i++ {
+		if i%10 == 0 {
+			values = append(values, models.Metrics{ID: models.PollCount, MType: models.Counter, Delta: toPtr(int64(1))})
+			continue
+		}
+		values = append(values, models.Metrics{ID: fmt.Sprintf("bench_gauge_%d", i), MType: models.Gauge, Value: toPtr(float64(i))})
+	}
+	return values
+}
+
+func BenchmarkAggregateBatch(b *testing.B) {
+	values := benchBatch(500)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		aggregateBatch(values)
+	}
+}
+
+// updateMetricsPerRow - прежняя реализация UpdateMetrics (INSERT на каждую метрику в транзакции),
+// оставлена для сравнения в бенчмарке
+func updateMetricsPerRow(ctx context.Context, db *sql.DB, values []models.Metrics) error {
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key().Less(values[j].Key())
+	})
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO metrics (name, type_metrics, delta, value) VALUES ($1, $2, $3, $4) "+
+		" ON CONFLICT (name, type_metrics) DO UPDATE"+
+		" SET delta = CASE "+
+		" WHEN $3 IS NOT NULL THEN metrics.delta + $3"+
+		" ELSE metrics.delta "+
+		" END, "+
+		" value = COALESCE(EXCLUDED.value, metrics.value)")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+	for _, elem := range values {
+		if _, err := stmt.ExecContext(ctx, elem.ID, elem.MType, elem.Delta, elem.Value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// BenchmarkUpdateMetrics сравнивает построчную и пакетную запись. Нужна база с примененными
+// миграциями: TEST_DATABASE_DSN=postgres://... go test -bench UpdateMetrics ./internal/repository
+func BenchmarkUpdateMetrics(b *testing.B) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db := MustConnectDB(dsn, DBConfig{})
+	defer db.Close()
+	repo := NewMetricsRepository(db, retry.NewRetrier(retry.NewClassifierRetryPolicy(apperror.NewPostgresErrorClassifier(), 1), retry.NewStaticDelayStrategy([]time.Duration{0}), &retry.SleepTimeProvider{}))
+
+	for _, size := range []int{10, 100, 500} {
+		values := benchBatch(size)
+		b.Run(fmt.Sprintf("per-row/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				batch := append([]models.Metrics(nil), values...)
+				if err := updateMetricsPerRow(context.Background(), db, batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("unnest/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := repo.UpdateMetrics(context.Background(), values); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
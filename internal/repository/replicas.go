@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+)
+
+// replicaCooldown - сколько времени недоступная реплика не получает запросов
+const replicaCooldown = 10 * time.Second
+
+// Replica - соединение с репликой, используемое только для чтения
+type Replica struct {
+	Name string
+	DB   *sql.DB
+	// downUntil - до какого момента (UnixNano) реплика считается недоступной
+	downUntil atomic.Int64
+}
+
+func NewReplica(name string, db *sql.DB) *Replica {
+	return &Replica{Name: name, DB: db}
+}
+
+// MustConnectReplicas открывает соединения с репликами по списку DSN через запятую. Реплики называются
+// replica-1, replica-2, ..., чтобы не выводить строки подключения с паролями в логи и /ping.
+func MustConnectReplicas(dsns string, cfg DBConfig) []*Replica {
+	var replicas []*Replica
+	for _, dsn := range strings.Split(dsns, ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+		name := fmt.Sprintf("replica-%d", len(replicas)+1)
+		replicas = append(replicas, NewReplica(name, MustConnectDB(dsn, cfg)))
+	}
+	return replicas
+}
+
+func (r *Replica) available(now time.Time) bool {
+	return r.downUntil.Load() <= now.UnixNano()
+}
+
+func (r *Replica) markDown(until time.Time) {
+	r.downUntil.Store(until.UnixNano())
+}
+
+// readRouter распределяет чтение по репликам по кругу. Если реплика не ответила, запрос повторяется
+// на основной базе, а недоступная реплика исключается на replicaCooldown.
+type readRouter struct {
+	primary  *sql.DB
+	replicas []*Replica
+	next     atomic.Uint64
+	now      func() time.Time
+}
+
+func newReadRouter(primary *sql.DB, replicas []*Replica) *readRouter {
+	return &readRouter{primary: primary, replicas: replicas, now: time.Now}
+}
+
+// read выполняет fn на реплике или, если доступных реплик нет или реплика вернула ошибку, на основной базе
+func (r *readRouter) read(ctx context.Context, fn func(db *sql.DB) error) error {
+	replica := r.pick()
+	if replica == nil {
+		return fn(r.primary)
+	}
+	err := fn(replica.DB)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	if isUnavailable(err) {
+		replica.markDown(r.now().Add(replicaCooldown))
+		logger.Log.Warn("Replica is unavailable, reading from primary", zap.String("replica", replica.Name), zap.Error(err))
+	} else {
+		logger.Log.Warn("Replica read failed, reading from primary", zap.String("replica", replica.Name), zap.Error(err))
+	}
+	return fn(r.primary)
+}
+
+// pick возвращает следующую доступную реплику или nil
+func (r *readRouter) pick() *Replica {
+	n := uint64(len(r.replicas))
+	if n == 0 {
+		return nil
+	}
+	now := r.now()
+	start := r.next.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		replica := r.replicas[(start+i)%n]
+		if replica.available(now) {
+			return replica
+		}
+	}
+	return nil
+}
+
+// isUnavailable - ошибка говорит о недоступности сервера, а не о проблеме конкретного запроса
+func isUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsConnectionException(pgErr.Code) ||
+			pgErr.Code == pgerrcode.AdminShutdown ||
+			pgErr.Code == pgerrcode.CrashShutdown ||
+			pgErr.Code == pgerrcode.CannotConnectNow
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lazyDB - пул без соединений: sql.Open не подключается к базе, пока пул не используется
+func lazyDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("pgx", "postgres://localhost/unused")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestRouter(t *testing.T, n int) (*readRouter, *fakeClock) {
+	replicas := make([]*Replica, n)
+	for i := range replicas {
+		replicas[i] = NewReplica(fmt.Sprintf("replica-%d", i+1), lazyDB(t))
+	}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r := newReadRouter(lazyDB(t), replicas)
+	r.now = clock.Now
+	return r, clock
+}
+
+// readFrom выполняет чтение и возвращает пулы, к которым обращался роутер
+func readFrom(r *readRouter, fail map[*sql.DB]error) ([]*sql.DB, error) {
+	var used []*sql.DB
+	err := r.read(context.Background(), func(db *sql.DB) error {
+		used = append(used, db)
+		return fail[db]
+	})
+	return used, err
+}
+
+func TestReadRouter_NoReplicas(t *testing.T) {
+	r, _ := newTestRouter(t, 0)
+
+	used, err := readFrom(r, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*sql.DB{r.primary}, used)
+}
+
+func TestReadRouter_RoundRobin(t *testing.T) {
+	r, _ := newTestRouter(t, 3)
+
+	var got []*sql.DB
+	for i := 0; i < 6; i++ {
+		used, err := readFrom(r, nil)
+		require.NoError(t, err)
+		got = append(got, used...)
+	}
+	rs := r.replicas
+	assert.Equal(t, []*sql.DB{rs[0].DB, rs[1].DB, rs[2].DB, rs[0].DB, rs[1].DB, rs[2].DB}, got)
+}
+
+func TestReadRouter_FallbackAndCooldown(t *testing.T) {
+	r, clock := newTestRouter(t, 2)
+	down := r.replicas[0]
+	fail := map[*sql.DB]error{down.DB: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+
+	used, err := readFrom(r, fail)
+	require.NoError(t, err)
+	assert.Equal(t, []*sql.DB{down.DB, r.primary}, used, "failed replica read is repeated on primary")
+
+	for i := 0; i < 4; i++ {
+		used, err := readFrom(r, fail)
+		require.NoError(t, err)
+		assert.Equal(t, []*sql.DB{r.replicas[1].DB}, used, "unavailable replica is skipped during cooldown")
+	}
+
+	clock.now = clock.now.Add(replicaCooldown)
+	delete(fail, down.DB)
+	var got []*sql.DB
+	for i := 0; i < 2; i++ {
+		used, err := readFrom(r, fail)
+		require.NoError(t, err)
+		got = append(got, used...)
+	}
+	assert.ElementsMatch(t, []*sql.DB{down.DB, r.replicas[1].DB}, got, "replica returns after cooldown")
+}
+
+func TestReadRouter_AllReplicasDown(t *testing.T) {
+	r, _ := newTestRouter(t, 2)
+	for _, replica := range r.replicas {
+		replica.markDown(r.now().Add(time.Minute))
+	}
+
+	used, err := readFrom(r, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*sql.DB{r.primary}, used)
+}
+
+func TestReadRouter_QueryErrorKeepsReplica(t *testing.T) {
+	r, _ := newTestRouter(t, 1)
+	queryErr := &pgconn.PgError{Code: pgerrcode.UndefinedTable}
+	fail := map[*sql.DB]error{r.replicas[0].DB: queryErr, r.primary: queryErr}
+
+	used, err := readFrom(r, fail)
+	assert.ErrorIs(t, err, queryErr)
+	assert.Equal(t, []*sql.DB{r.replicas[0].DB, r.primary}, used)
+	assert.True(t, r.replicas[0].available(r.now()), "query error does not mark replica down")
+}
+
+func TestReadRouter_ContextCanceled(t *testing.T) {
+	r, _ := newTestRouter(t, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var used []*sql.DB
+	err := r.read(ctx, func(db *sql.DB) error {
+		used = append(used, db)
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []*sql.DB{r.replicas[0].DB}, used, "canceled read is not repeated on primary")
+}
+
+func TestIsUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "bad conn", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: true},
+		{name: "network", err: &net.OpError{Op: "read", Err: errors.New("connection reset")}, want: true},
+		{name: "connect", err: &pgconn.ConnectError{}, want: true},
+		{name: "connection exception", err: &pgconn.PgError{Code: pgerrcode.ConnectionFailure}, want: true},
+		{name: "admin shutdown", err: &pgconn.PgError{Code: pgerrcode.AdminShutdown}, want: true},
+		{name: "starting up", err: &pgconn.PgError{Code: pgerrcode.CannotConnectNow}, want: true},
+		{name: "query error", err: &pgconn.PgError{Code: pgerrcode.UndefinedColumn}, want: false},
+		{name: "statement timeout", err: &pgconn.PgError{Code: pgerrcode.QueryCanceled}, want: false},
+		{name: "other", err: errors.New("boom"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isUnavailable(tt.err))
+		})
+	}
+}
+
+func TestMustConnectReplicas(t *testing.T) {
+	replicas := MustConnectReplicas(" postgres://r1/db , ,postgres://r2/db", DBConfig{})
+	t.Cleanup(func() {
+		for _, r := range replicas {
+			_ = r.DB.Close()
+		}
+	})
+
+	require.Len(t, replicas, 2)
+	assert.Equal(t, "replica-1", replicas[0].Name)
+	assert.Equal(t, "replica-2", replicas[1].Name)
+	assert.Empty(t, MustConnectReplicas("", DBConfig{}))
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/retry"
+)
+
+// WindowRepository хранит окна агрегатов gauge в таблице gauge_windows
+type WindowRepository struct {
+	db      *sql.DB
+	retrier *retry.Retrier
+}
+
+func NewWindowRepository(db *sql.DB, retrier *retry.Retrier) *WindowRepository {
+	return &WindowRepository{db: db, retrier: retrier}
+}
+
+// SaveWindows в одной транзакции удаляет окна removed и добавляет или заменяет windows. Остальные
+// строки не трогаются: в общей базе их ведут другие серверы.
+func (r *WindowRepository) SaveWindows(ctx context.Context, windows []models.GaugeWindow, removed []models.WindowKey) error {
+	names := make([]string, len(windows))
+	sizes := make([]int64, len(windows))
+	buckets := make([]string, len(windows))
+	for i, w := range windows {
+		data, err := json.Marshal(w.Buckets)
+		if err != nil {
+			return err
+		}
+		names[i] = w.ID
+		sizes[i] = int64(w.Window)
+		buckets[i] = string(data)
+	}
+	removedNames := make([]string, len(removed))
+	removedSizes := make([]int64, len(removed))
+	for i, k := range removed {
+		removedNames[i] = k.ID
+		removedSizes[i] = int64(k.Window)
+	}
+
+	_, err := retry.DoWithRetry(ctx, r.retrier, func() (struct{}, error) {
+		tx, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return struct{}{}, err
+		}
+		defer func() {
+			if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+				logger.Log.Error("не удалось откатить транзакцию", zap.Error(err))
+			}
+		}()
+		if len(removed) > 0 {
+			_, err := tx.ExecContext(ctx, "DELETE FROM gauge_windows w"+
+				" USING unnest($1::text[], $2::bigint[]) AS k(name, window_ns)"+
+				" WHERE w.name = k.name AND w.window_ns = k.window_ns", removedNames, removedSizes)
+			if err != nil {
+				return struct{}{}, fmt.Errorf("ошибка при удалении окон: %w", err)
+			}
+		}
+		if len(windows) > 0 {
+			_, err := tx.ExecContext(ctx, "INSERT INTO gauge_windows (name, window_ns, buckets)"+
+				" SELECT * FROM unnest($1::text[], $2::bigint[], $3::text[]::jsonb[])"+
+				" ON CONFLICT (name, window_ns) DO UPDATE SET buckets = EXCLUDED.buckets", names, sizes, buckets)
+			if err != nil {
+				return struct{}{}, fmt.Errorf("ошибка при сохранении окон: %w", err)
+			}
+		}
+		return struct{}{}, tx.Commit()
+	})
+	return err
+}
+
+// LoadWindows возвращает сохраненные окна
+func (r *WindowRepository) LoadWindows(ctx context.Context) ([]models.GaugeWindow, error) {
+	return retry.DoWithRetry(ctx, r.retrier, func() ([]models.GaugeWindow, error) {
+		rows, err := r.db.QueryContext(ctx, "SELECT name, window_ns, buckets FROM gauge_windows ORDER BY name, window_ns")
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при получении окон: %w", err)
+		}
+		defer func(rows *sql.Rows) {
+			err := rows.Close()
+			if err != nil {
+				logger.Log.Error("ошибка при закрытии rows")
+			}
+		}(rows)
+
+		var windows []models.GaugeWindow
+		for rows.Next() {
+			var w models.GaugeWindow
+			var size int64
+			var data []byte
+			if err := rows.Scan(&w.ID, &size, &data); err != nil {
+				return nil, fmt.Errorf("ошибка при получении окна: %w", err)
+			}
+			if err := json.Unmarshal(data, &w.Buckets); err != nil {
+				return nil, fmt.Errorf("окно %s/%d повреждено: %w", w.ID, size, err)
+			}
+			w.Window = time.Duration(size)
+			windows = append(windows, w)
+		}
+		return windows, rows.Err()
+	})
+}
@@ -0,0 +1,99 @@
+// Package retention удаляет метрики, которые давно не обновлялись
+package retention
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// Rule - время жизни метрик, имя которых подходит под шаблон Pattern (синтаксис path.Match)
+type Rule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// Policy - время жизни метрик: первое подходящее правило, иначе Default. Нулевое время жизни - метрика
+// не устаревает.
+type Policy struct {
+	Default time.Duration
+	Rules   []Rule
+}
+
+// ParseRules разбирает правила вида "host_*=24h,tmp.*=10m". Правило с нулевым временем жизни
+// исключает подходящие метрики из удаления.
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, ttl, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid ttl rule %q: expected pattern=duration", part)
+		}
+		pattern = strings.TrimSpace(pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ttl pattern %q: %w", pattern, err)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(ttl))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl rule %q: %w", part, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("invalid ttl rule %q: negative duration", part)
+		}
+		rules = append(rules, Rule{Pattern: pattern, TTL: d})
+	}
+	return rules, nil
+}
+
+// Enabled - хотя бы одна метрика может устареть
+func (p *Policy) Enabled() bool {
+	if p == nil {
+		return false
+	}
+	if p.Default > 0 {
+		return true
+	}
+	for _, r := range p.Rules {
+		if r.TTL > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TTL возвращает время жизни метрики с именем name
+func (p *Policy) TTL(name string) time.Duration {
+	if p == nil {
+		return 0
+	}
+	for _, r := range p.Rules {
+		// шаблон проверен в ParseRules, ошибки быть не может
+		if ok, _ := path.Match(r.Pattern, name); ok {
+			return r.TTL
+		}
+	}
+	return p.Default
+}
+
+// IsStale сообщает, устарела ли метрика к моменту now
+func (p *Policy) IsStale(m *models.Metrics, now time.Time) bool {
+	_, stale := p.expiration(m, now)
+	return stale
+}
+
+// expiration возвращает момент, до которого метрика должна была обновиться, чтобы не устареть
+func (p *Policy) expiration(m *models.Metrics, now time.Time) (time.Time, bool) {
+	ttl := p.TTL(m.ID)
+	if ttl <= 0 || m.UpdatedAt == nil {
+		return time.Time{}, false
+	}
+	before := now.Add(-ttl)
+	return before, m.UpdatedAt.Before(before)
+}
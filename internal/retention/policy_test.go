@@ -0,0 +1,94 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []Rule
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{
+			name:  "several rules",
+			value: "host_*=24h, tmp.*=10m,,keep=0s",
+			want: []Rule{
+				{Pattern: "host_*", TTL: 24 * time.Hour},
+				{Pattern: "tmp.*", TTL: 10 * time.Minute},
+				{Pattern: "keep", TTL: 0},
+			},
+		},
+		{name: "no duration", value: "host_*", wantErr: true},
+		{name: "bad duration", value: "host_*=day", wantErr: true},
+		{name: "negative duration", value: "host_*=-1h", wantErr: true},
+		{name: "bad pattern", value: "host_[=1h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPolicy_TTL(t *testing.T) {
+	p := &Policy{
+		Default: time.Hour,
+		Rules: []Rule{
+			{Pattern: "keep_*", TTL: 0},
+			{Pattern: "tmp_*", TTL: time.Minute},
+			{Pattern: "*_total", TTL: 24 * time.Hour},
+		},
+	}
+	tests := []struct {
+		name string
+		want time.Duration
+	}{
+		{name: "Alloc", want: time.Hour},
+		{name: "tmp_x", want: time.Minute},
+		{name: "tmp_total", want: time.Minute},
+		{name: "requests_total", want: 24 * time.Hour},
+		{name: "keep_total", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.TTL(tt.name))
+		})
+	}
+}
+
+func TestPolicy_Enabled(t *testing.T) {
+	var disabled *Policy
+	assert.False(t, disabled.Enabled())
+	assert.False(t, (&Policy{Rules: []Rule{{Pattern: "*", TTL: 0}}}).Enabled())
+	assert.True(t, (&Policy{Default: time.Minute}).Enabled())
+	assert.True(t, (&Policy{Rules: []Rule{{Pattern: "tmp_*", TTL: time.Minute}}}).Enabled())
+}
+
+func TestPolicy_IsStale(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	p := &Policy{Default: time.Hour, Rules: []Rule{{Pattern: "keep", TTL: 0}}}
+
+	assert.True(t, p.IsStale(&models.Metrics{ID: "a", UpdatedAt: at(2 * time.Hour)}, now))
+	assert.False(t, p.IsStale(&models.Metrics{ID: "a", UpdatedAt: at(time.Hour)}, now))
+	assert.False(t, p.IsStale(&models.Metrics{ID: "a"}, now))
+	assert.False(t, p.IsStale(&models.Metrics{ID: "keep", UpdatedAt: at(48 * time.Hour)}, now))
+}
@@ -0,0 +1,78 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// Store - хранилище, из которого удаляются устаревшие метрики
+type Store interface {
+	GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error)
+	DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error)
+}
+
+// Notifier получает удаленные метрики, например audit.Publisher
+type Notifier interface {
+	NotifyExpired(metrics []models.Metrics)
+}
+
+// Sweeper периодически удаляет устаревшие по Policy метрики
+type Sweeper struct {
+	store    Store
+	policy   *Policy
+	notifier Notifier
+	now      func() time.Time
+}
+
+func NewSweeper(store Store, policy *Policy, notifier Notifier) *Sweeper {
+	return &Sweeper{store: store, policy: policy, notifier: notifier, now: time.Now}
+}
+
+// Run удаляет устаревшие метрики раз в interval до отмены ctx
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				logger.Log.Error("Error deleting expired metrics", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Sweep удаляет метрики, устаревшие к текущему моменту, и возвращает их число. Метрика, обновленная
+// между чтением и удалением, не удаляется: хранилище сверяет время обновления.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	metrics, err := s.store.GetAllMetrics(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := s.now()
+	var expired []models.Expiration
+	for key, m := range metrics {
+		if before, stale := s.policy.expiration(m, now); stale {
+			expired = append(expired, models.Expiration{MetricKey: key, Before: before})
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	deleted, err := s.store.DeleteExpired(ctx, expired)
+	if len(deleted) > 0 {
+		logger.Log.Info("Expired metrics deleted", zap.Int("count", len(deleted)))
+		if s.notifier != nil {
+			s.notifier.NotifyExpired(deleted)
+		}
+	}
+	return len(deleted), err
+}
@@ -0,0 +1,76 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+type recordingNotifier struct {
+	expired [][]models.Metrics
+}
+
+func (n *recordingNotifier) NotifyExpired(metrics []models.Metrics) {
+	n.expired = append(n.expired, metrics)
+}
+
+type failingStore struct {
+	Store
+}
+
+func (failingStore) GetAllMetrics(context.Context) (map[models.MetricKey]*models.Metrics, error) {
+	return nil, errors.New("db is down")
+}
+
+func TestSweeper_Sweep(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	old := now.Add(-2 * time.Hour)
+	fresh := now.Add(-time.Minute)
+	value := 1.5
+	delta := int64(3)
+
+	strg := storage.NewMemStorage()
+	require.NoError(t, strg.Restore(context.Background(), []models.Metrics{
+		{ID: "old", MType: models.Gauge, Value: &value, UpdatedAt: &old},
+		{ID: "old", MType: models.Counter, Delta: &delta, UpdatedAt: &fresh},
+		{ID: "keep", MType: models.Gauge, Value: &value, UpdatedAt: &old},
+		{ID: "fresh", MType: models.Gauge, Value: &value, UpdatedAt: &fresh},
+	}))
+	notifier := &recordingNotifier{}
+	s := NewSweeper(strg, &Policy{Default: time.Hour, Rules: []Rule{{Pattern: "keep", TTL: 0}}}, notifier)
+	s.now = func() time.Time { return now }
+
+	n, err := s.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	left, err := strg.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, left, 3)
+	assert.NotContains(t, left, models.MetricKey{MType: models.Gauge, ID: "old"})
+	assert.Contains(t, left, models.MetricKey{MType: models.Counter, ID: "old"})
+
+	require.Len(t, notifier.expired, 1)
+	require.Len(t, notifier.expired[0], 1)
+	assert.Equal(t, models.MetricKey{MType: models.Gauge, ID: "old"}, notifier.expired[0][0].Key())
+
+	n, err = s.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Len(t, notifier.expired, 1)
+}
+
+func TestSweeper_SweepError(t *testing.T) {
+	notifier := &recordingNotifier{}
+	s := NewSweeper(failingStore{}, &Policy{Default: time.Hour}, notifier)
+	_, err := s.Sweep(context.Background())
+	assert.Error(t, err)
+	assert.Empty(t, notifier.expired)
+}
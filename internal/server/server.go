@@ -2,77 +2,147 @@ package server
 
 import (
 	"context"
-	"crypto/rsa"
 	"database/sql"
 	"errors"
 	"github.com/ValentinaKh/go-metrics/internal/audit/file"
 	"github.com/ValentinaKh/go-metrics/internal/audit/rest"
+	"github.com/ValentinaKh/go-metrics/internal/compress"
 	"github.com/ValentinaKh/go-metrics/internal/crypto"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/ValentinaKh/go-metrics/internal/aggregate"
 	"github.com/ValentinaKh/go-metrics/internal/apperror"
 	"github.com/ValentinaKh/go-metrics/internal/audit"
 	"github.com/ValentinaKh/go-metrics/internal/config"
 	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	"github.com/ValentinaKh/go-metrics/internal/graphite"
 	"github.com/ValentinaKh/go-metrics/internal/handler"
 	"github.com/ValentinaKh/go-metrics/internal/handler/middleware"
 	"github.com/ValentinaKh/go-metrics/internal/logger"
+	"github.com/ValentinaKh/go-metrics/internal/migrator"
+	"github.com/ValentinaKh/go-metrics/internal/otlp"
+	"github.com/ValentinaKh/go-metrics/internal/replication"
 	"github.com/ValentinaKh/go-metrics/internal/repository"
+	"github.com/ValentinaKh/go-metrics/internal/retention"
 	"github.com/ValentinaKh/go-metrics/internal/retry"
 	"github.com/ValentinaKh/go-metrics/internal/service"
+	"github.com/ValentinaKh/go-metrics/internal/statsd"
 	"github.com/ValentinaKh/go-metrics/internal/storage"
 	"github.com/ValentinaKh/go-metrics/internal/storage/decorator"
+	"github.com/ValentinaKh/go-metrics/migrations"
+)
+
+const (
+	certExpiryWarning       = 30 * 24 * time.Hour
+	certExpiryCheckInterval = 24 * time.Hour
+	ndjsonChunkSize         = 1000
+	// windowsSaveInterval - период сохранения окон агрегатов gauge
+	windowsSaveInterval = 10 * time.Second
+	// syncRotateInterval - как часто синхронное файловое хранилище сохраняет предыдущий снимок
+	syncRotateInterval = time.Minute
+	// replicationSignatureSkew - насколько время подписи запроса между серверами может отличаться от текущего
+	replicationSignatureSkew = 5 * time.Minute
 )
 
 // ConfigureServer configure server
-func ConfigureServer(shutdownCtx context.Context, cfg *config.ServerArg, db *sql.DB) (*sync.WaitGroup, error) {
+func ConfigureServer(shutdownCtx context.Context, cfg *config.ServerArg, db *sql.DB, replicas []*repository.Replica) (*sync.WaitGroup, error) {
 	var strg service.Storage
 	var healthService handler.HealthChecker
+	var dbStats handler.DBStatsSource
+	var windowStore aggregate.Store
+	var invalidations func(ctx context.Context)
 
 	if cfg.ConnStr != "" {
-		repository.InitTables(shutdownCtx, db)
+		// кэш заполняется только с основной базы: отстающая реплика оставила бы в нем старые значения
+		if cfg.MetricsCache && len(replicas) > 0 {
+			return nil, errors.New("metrics cache can't be used with DATABASE_READ_DSN read replicas")
+		}
+		m, err := migrator.New(db, migrations.FS)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := m.Up(shutdownCtx); err != nil {
+			panic(err)
+		}
 
-		healthService = service.NewHealthService(repository.NewHealthRepository(db))
+		healthService = service.NewHealthService(repository.NewHealthRepository(db, replicas...))
+		dbStats = db
 
 		retryConfig := config.RetryConfig{
 			MaxAttempts: 3,
 			Delays:      []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second},
 		}
-		err := retryConfig.Validate()
+		err = retryConfig.Validate()
 		if err != nil {
 			panic(err)
 		}
 
-		strg = repository.NewMetricsRepository(db,
-			retry.NewRetrier(
-				retry.NewClassifierRetryPolicy(apperror.NewPostgresErrorClassifier(), retryConfig.MaxAttempts),
-				retry.NewStaticDelayStrategy(retryConfig.Delays),
-				&retry.SleepTimeProvider{}))
+		retrier := retry.NewRetrier(
+			retry.NewClassifierRetryPolicy(apperror.NewPostgresErrorClassifier(), retryConfig.MaxAttempts),
+			retry.NewStaticDelayStrategy(retryConfig.Delays),
+			&retry.SleepTimeProvider{})
+		if cfg.MetricsCache {
+			strg, invalidations = metricsCache(shutdownCtx, cfg, db, repository.NewMetricsRepository(db, retrier))
+		} else {
+			strg = repository.NewMetricsRepository(db, retrier, replicas...)
+		}
+		windowStore = repository.NewWindowRepository(db, retrier)
 
-		logger.Log.Info("Use database storage")
+		logger.Log.Info("Use database storage", zap.Int("replicas", len(replicas)), zap.Bool("cache", cfg.MetricsCache))
 	} else if cfg.File != "" {
-		writer, err := fileworker.NewFileWriter(cfg.File)
+		// история загружается в память до подключения файла, чтобы восстановление не дописывало его
+		compacted, err := fileworker.CompactLegacy(cfg.File, int(cfg.StoreRetain))
 		if err != nil {
 			panic(err)
 		}
+		if compacted {
+			logger.Log.Info("Legacy metrics file compacted", zap.String("file", cfg.File))
+		}
+
+		mem := storage.NewMemStorage()
+		if cfg.Restore {
+			err := service.LoadMetrics(cfg.File, mem)
+			if err != nil {
+				panic(err)
+			}
+		}
 
-		strg, err = decorator.NewStoreWithAsyncFile(shutdownCtx, storage.NewMemStorage(), time.Duration(cfg.Interval)*time.Second, writer)
+		writer, err := fileworker.NewSnapshotWriter(cfg.File, int(cfg.StoreRetain))
+		if err != nil {
+			panic(err)
+		}
+		windowStore, err = aggregate.NewFileStore(cfg.File + ".windows")
 		if err != nil {
 			panic(err)
 		}
 
-		if cfg.Restore {
-			err := service.LoadMetrics(cfg.File, strg)
+		if cfg.Interval == 0 {
+			if cfg.WALFile != "" {
+				logger.Log.Warn("WAL is ignored: file storage is synchronous")
+			}
+			// снимок пишется при каждом изменении: без интервала сохраненные копии отличались бы на миллисекунды
+			strg = decorator.NewStoreWithSyncFile(shutdownCtx, mem, writer.WithRotateInterval(syncRotateInterval))
+		} else {
+			var base service.Storage = mem
+			if cfg.WALFile != "" {
+				base, err = openWAL(shutdownCtx, cfg, mem)
+				if err != nil {
+					panic(err)
+				}
+			}
+			strg, err = decorator.NewStoreWithAsyncFile(shutdownCtx, base, time.Duration(cfg.Interval)*time.Second, writer)
 			if err != nil {
 				panic(err)
 			}
 		}
-		logger.Log.Info("Use file storage")
+		logger.Log.Info("Use file storage", zap.Bool("sync", cfg.Interval == 0), zap.String("wal", cfg.WALFile))
 	} else {
 		strg = storage.NewMemStorage()
 
@@ -89,17 +159,235 @@ func ConfigureServer(shutdownCtx context.Context, cfg *config.ServerArg, db *sql
 	if cfg.AuditURL != "" {
 		auditor.Register(rest.NewAuditHandler(cfg.AuditURL))
 	}
-	var cs *crypto.CryptoService[*rsa.PrivateKey, *rsa.PrivateKey]
+	var cs *crypto.CryptoService
 	var err error
 	if cfg.CryptoKey != "" {
-		cs, err = crypto.NewPrivateKeyService(cfg.CryptoKey)
+		cs, err = crypto.NewPrivateKeyService(cfg.CryptoKey, cfg.CryptoKeyPasswordFile)
 		if err != nil {
 			return nil, err
 		}
+		go cs.WatchExpiry(shutdownCtx, certExpiryWarning, certExpiryCheckInterval)
+	}
+	encodings, err := compress.NewRegistry(cfg.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	strg, saveWindows, err := gaugeWindows(shutdownCtx, cfg, strg, windowStore)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := retentionPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	followers := splitList(cfg.ReplicationFollowers)
+	if (len(followers) > 0 || cfg.ReplicationPrimary != "") && cfg.Key == "" {
+		return nil, errors.New("replication requires a key to sign requests between servers")
+	}
+	var listeners []func(ctx context.Context)
+	var applier handler.ReplicationApplier
+	if cfg.ReplicationPrimary != "" {
+		// пакеты основного сервера пишутся в хранилище мимо репликации и дальше не пересылаются
+		follower := replication.NewFollower(strg, cfg.ReplicationPrimary, cfg.Key, networkRetrier())
+		applier = follower
+		listeners = append(listeners, follower.Run)
+		logger.Log.Info("Running as follower", zap.String("primary", cfg.ReplicationPrimary))
+	}
+	var snapshots handler.SnapshotSource
+	var primary *replication.Primary
+	if len(followers) > 0 {
+		primary, err = replication.NewPrimary(strg, followers, cfg.ReplicationQueueDir, cfg.Key, networkRetrier())
+		if err != nil {
+			return nil, err
+		}
+		// через хранилище идут и пакеты сервиса, и приемники StatsD и Graphite, и удаление устаревших метрик
+		strg = decorator.NewStoreWithReplication(strg, primary)
+		snapshots = primary
+		listeners = append(listeners, primary.Run)
+		logger.Log.Info("Replication to followers enabled", zap.Strings("followers", followers))
+	}
+	served, err := startListeners(cfg, strg)
+	if err != nil {
+		if primary != nil {
+			primary.Close()
+		}
+		return nil, err
+	}
+	listeners = append(listeners, served...)
+	if saveWindows != nil {
+		listeners = append(listeners, saveWindows)
+	}
+	if invalidations != nil {
+		listeners = append(listeners, invalidations)
+	}
+	metricsService := service.NewMetricsService(strg)
+	if policy.Enabled() {
+		metricsService.WithStalePolicy(policy)
+		sweeper := retention.NewSweeper(strg, policy, auditor)
+		listeners = append(listeners, func(ctx context.Context) {
+			sweeper.Run(ctx, time.Duration(cfg.RetentionInterval)*time.Second)
+		})
+		logger.Log.Info("Metric retention enabled", zap.Duration("ttl", policy.Default), zap.Int("rules", len(policy.Rules)))
+	}
+	wg := createServer(shutdownCtx, metricsService,
+		healthService, cfg.Host, cfg.Key, cfg.ProfilePort, auditor, cs,
+		middleware.CompressMW(encodings, int(cfg.CompressionMinSize)),
+		otlp.NewConverter(strings.Split(cfg.OTLPResourceAttributes, ",")), dbStats, snapshots, applier)
+	for _, serve := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(shutdownCtx)
+		}()
+	}
+	return wg, nil
+
+}
+
+// openWAL подключает журнал упреждающей записи к mem. При восстановлении истории журнал воспроизводится
+// поверх загруженного снимка, иначе очищается.
+func openWAL(ctx context.Context, cfg *config.ServerArg, mem *storage.MemStorage) (*decorator.StoreWithWAL, error) {
+	policy, err := fileworker.ParseWALSyncPolicy(cfg.WALSync)
+	if err != nil {
+		return nil, err
+	}
+	wal, err := fileworker.OpenWAL(cfg.WALFile, policy, time.Duration(cfg.WALSyncInterval)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	s := decorator.NewStoreWithWAL(mem, wal)
+	if !cfg.Restore {
+		return s, wal.TruncateFront(wal.Size())
+	}
+	records, err := s.Replay(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Info("WAL replayed", zap.String("file", cfg.WALFile), zap.Int("records", records))
+	return s, nil
+}
+
+// metricsCache ставит перед базой кэш текущих значений метрик и загружает в него все метрики. Возвращаемая
+// функция принимает сообщения других серверов с общей базой об измененных метриках; если согласование
+// кэшей выключено, она равна nil.
+func metricsCache(ctx context.Context, cfg *config.ServerArg, db *sql.DB, repo service.Storage) (service.Storage, func(ctx context.Context)) {
+	cache := decorator.NewStoreWithCache(repo)
+	if err := cache.Warm(ctx); err != nil {
+		// кэш заполнится при первых чтениях
+		logger.Log.Warn("Metrics cache is not warmed", zap.Error(err))
+	}
+	if !cfg.CacheNotify {
+		return cache, nil
+	}
+	bus := repository.NewInvalidationBus(db)
+	cache.WithInvalidator(bus)
+	logger.Log.Info("Metrics cache invalidation enabled", zap.String("channel", repository.InvalidationChannel))
+	return cache, func(ctx context.Context) {
+		bus.Listen(ctx, cache.Invalidate, cache.Reset)
+	}
+}
+
+// gaugeWindows подключает окна агрегатов gauge, если они заданы в настройках. Сохраненные окна загружаются
+// из store вместе с метриками (из базы - всегда, из файла - при cfg.Restore), а возвращаемая функция
+// периодически сохраняет их. Без store (хранение только в памяти) окна не сохраняются и функция равна nil.
+func gaugeWindows(ctx context.Context, cfg *config.ServerArg, strg service.Storage,
+	store aggregate.Store) (service.Storage, func(ctx context.Context), error) {
+	windows, err := aggregate.ParseWindows(cfg.GaugeWindows)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(windows) == 0 {
+		return strg, nil, nil
+	}
+	tracker := aggregate.NewTracker(windows)
+	logger.Log.Info("Gauge aggregation enabled", zap.String("windows", cfg.GaugeWindows))
+	if store == nil {
+		return decorator.NewStoreWithAggregates(strg, tracker), nil, nil
+	}
+	if cfg.ConnStr != "" || cfg.Restore {
+		saved, err := store.LoadWindows(ctx)
+		if err != nil {
+			// агрегаты не критичны: начинаем с пустых окон, а не отказываемся запускаться
+			logger.Log.Warn("Gauge windows are not restored", zap.Error(err))
+		}
+		tracker.Restore(saved)
+	}
+	return decorator.NewStoreWithAggregates(strg, tracker), func(ctx context.Context) {
+		tracker.Run(ctx, store, windowsSaveInterval)
+	}, nil
+}
+
+// networkRetrier повторяет запросы к другим серверам при сетевых ошибках
+func networkRetrier() *retry.Retrier {
+	return retry.NewRetrier(
+		retry.NewClassifierRetryPolicy(apperror.NewNetworkErrorClassifier(), 3),
+		retry.NewStaticDelayStrategy([]time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}),
+		&retry.SleepTimeProvider{})
+}
+
+// splitList разбирает список через запятую, пропуская пустые элементы
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// retentionPolicy собирает время жизни метрик из настроек. Период удаления проверяется, только если
+// время жизни задано: при выключенном удалении он не используется.
+func retentionPolicy(cfg *config.ServerArg) (*retention.Policy, error) {
+	rules, err := retention.ParseRules(cfg.MetricTTLRules)
+	if err != nil {
+		return nil, err
 	}
-	return createServer(shutdownCtx, service.NewMetricsService(strg),
-		healthService, cfg.Host, cfg.Key, cfg.ProfilePort, auditor, cs), nil
+	policy := &retention.Policy{Default: time.Duration(cfg.MetricTTL) * time.Second, Rules: rules}
+	if policy.Enabled() && cfg.RetentionInterval == 0 {
+		return nil, errors.New("retention interval must be positive")
+	}
+	return policy, nil
+}
 
+// startListeners открывает сокеты приемников StatsD и Graphite, если они заданы в настройках,
+// и возвращает функции их обслуживания. При ошибке уже открытые сокеты закрываются.
+func startListeners(cfg *config.ServerArg, strg service.Storage) (listeners []func(ctx context.Context), err error) {
+	var opened []io.Closer
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, c := range opened {
+			if cerr := c.Close(); cerr != nil {
+				logger.Log.Error("Error closing listener", zap.Error(cerr))
+			}
+		}
+	}()
+
+	if cfg.StatsdAddr != "" {
+		l, err := statsd.Listen(cfg.StatsdNetwork, cfg.StatsdAddr, strg, time.Duration(cfg.StatsdFlushInterval)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, l)
+		logger.Log.Info("StatsD listener started", zap.String("address", l.Addr().String()))
+		listeners = append(listeners, l.Serve)
+	}
+	if cfg.GraphiteAddr != "" {
+		rules, err := graphite.NewRules(strings.Split(cfg.GraphiteCounterPatterns, ","))
+		if err != nil {
+			return nil, err
+		}
+		l, err := graphite.Listen(cfg.GraphiteAddr, strg, rules, int(cfg.GraphiteMaxConns), time.Duration(cfg.GraphiteIdleTimeout)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, l)
+		logger.Log.Info("Graphite listener started", zap.String("address", l.Addr().String()))
+		listeners = append(listeners, l.Serve)
+	}
+	return listeners, nil
 }
 
 func createServer(ctx context.Context,
@@ -107,18 +395,39 @@ func createServer(ctx context.Context,
 	healthService handler.HealthChecker,
 	host, key, profileHost string,
 	publisher audit.Publisher,
-	cs *crypto.CryptoService[*rsa.PrivateKey, *rsa.PrivateKey]) *sync.WaitGroup {
+	cs *crypto.CryptoService,
+	compressMW func(http.Handler) http.Handler,
+	converter *otlp.Converter,
+	dbStats handler.DBStatsSource,
+	snapshots handler.SnapshotSource,
+	applier handler.ReplicationApplier) *sync.WaitGroup {
 	r := chi.NewRouter()
-	r.With(middleware.LoggingMw, middleware.DecryptMW(cs), middleware.ValidateHashMW(key), middleware.GzipMW, middleware.HashResponseMW(key)).Route("/", func(r chi.Router) {
+	r.With(middleware.LoggingMw, middleware.DecryptMW(cs), middleware.ValidateHashMW(key), compressMW, middleware.HashResponseMW(key)).Route("/", func(r chi.Router) {
 		r.Get("/", handler.GetAllMetricsHandler(ctx, metricsService))
 		r.With(middleware.ValidationURLRqMw).Post("/update/{type}/{name}/{value}", handler.MetricsHandler(ctx, metricsService))
 		r.Post("/update/", handler.JSONUpdateMetricHandler(ctx, metricsService, publisher))
 		r.Post("/updates/", handler.JSONUpdateMetricsHandler(ctx, metricsService, publisher))
+		r.Post("/updates/stream", handler.NDJSONUpdateMetricsHandler(ctx, metricsService, publisher, ndjsonChunkSize))
+		r.Post("/api/influx/write", handler.InfluxWriteHandler(ctx, metricsService, publisher))
+		r.Post("/v1/metrics", handler.OTLPMetricsHandler(ctx, metricsService, publisher, converter))
 		r.Get("/value/{type}/{name}", handler.GetMetricHandler(ctx, metricsService))
 		r.Post("/value/", handler.GetJSONMetricHandler(ctx, metricsService))
 		if healthService != nil {
 			r.Get("/ping", handler.HealthHandler(ctx, healthService))
 		}
+		if dbStats != nil {
+			r.Get("/db/stats", handler.DBStatsHandler(dbStats))
+		}
+	})
+	// серверы обмениваются открытыми данными, подписанными общим ключом: ключ шифрования есть только у получателя
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.LoggingMw, middleware.SignedRequestMW(key, replicationSignatureSkew), compressMW, middleware.HashResponseMW(key))
+		if snapshots != nil {
+			r.Get(replication.SnapshotPath, handler.ReplicationSnapshotHandler(ctx, snapshots))
+		}
+		if applier != nil {
+			r.Post(replication.UpdatesPath, handler.ReplicationUpdatesHandler(ctx, applier))
+		}
 	})
 	var wg sync.WaitGroup
 
@@ -1,9 +1,14 @@
 package service
 
-import "context"
+import (
+	"context"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
 
 type HealthRepository interface {
 	Ping(ctx context.Context) error
+	PingAll(ctx context.Context) []models.ConnectionStatus
 }
 
 type HealthService struct {
@@ -17,3 +22,8 @@ func NewHealthService(rep HealthRepository) *HealthService {
 func (s *HealthService) CheckDB(ctx context.Context) error {
 	return s.rep.Ping(ctx)
 }
+
+// CheckConnections возвращает состояние основной базы и всех реплик
+func (s *HealthService) CheckConnections(ctx context.Context) []models.ConnectionStatus {
+	return s.rep.PingAll(ctx)
+}
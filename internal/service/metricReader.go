@@ -2,43 +2,57 @@ package service
 
 import (
 	"context"
-	"encoding/json"
-	"github.com/ValentinaKh/go-metrics/internal/logger"
-	"io"
-	"os"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
 
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	"github.com/ValentinaKh/go-metrics/internal/logger"
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
 
-// LoadMetrics загружает метрики из файла
+type restorer interface {
+	Restore(ctx context.Context, values []models.Metrics) error
+}
+
+// LoadMetrics загружает метрики из последнего целого снимка (см. ReadMetricsFile)
 func LoadMetrics(fileName string, st Storage) error {
-	file, err := os.OpenFile(fileName, os.O_RDONLY|os.O_CREATE, 0666)
+	metrics, err := ReadMetricsFile(fileName)
 	if err != nil {
 		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			logger.Log.Error(err.Error())
-		}
-	}(file)
-
-	decoder := json.NewDecoder(file)
-
-	var lastResult []models.Metrics
-	for {
-		if err := decoder.Decode(&lastResult); err != nil {
-			if err == io.EOF { // Достигнут конец файла
-				break
-			}
+	// хранилище, умеющее восстанавливать метрики как есть, сохраняет время их обновления
+	if r, ok := st.(restorer); ok {
+		return r.Restore(context.TODO(), metrics)
+	}
+	for i := range metrics {
+		if err := st.UpdateMetric(context.TODO(), metrics[i]); err != nil {
 			return err
 		}
 	}
-	for i := range lastResult {
-		err := st.UpdateMetric(context.TODO(), lastResult[i])
+	return nil
+}
+
+// ReadMetricsFile читает метрики из последнего целого снимка: если основной файл поврежден,
+// используются сохраненные предыдущие снимки fileName.1, fileName.2 и т.д. Поддерживается и JSON-массив
+// метрик без обертки снимка. Если файлов нет, метрик нет.
+func ReadMetricsFile(fileName string) ([]models.Metrics, error) {
+	files := fileworker.SnapshotFiles(fileName)
+	for _, file := range files {
+		var metrics []models.Metrics
+		_, err := fileworker.ReadSnapshot(file, &metrics)
+		if errors.Is(err, fileworker.ErrCorrupted) {
+			logger.Log.Error("Skip corrupted snapshot", zap.String("file", file), zap.Error(err))
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
+		return metrics, nil
 	}
-	return nil
+	if len(files) > 0 {
+		return nil, fmt.Errorf("no valid snapshot found for %s", fileName)
+	}
+	return nil, nil
 }
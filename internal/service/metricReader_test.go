@@ -0,0 +1,43 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func TestLoadMetrics_FallbackToPreviousSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	w, err := fileworker.NewSnapshotWriter(path, 1)
+	require.NoError(t, err)
+	value := 1.5
+	require.NoError(t, w.Write([]models.Metrics{{ID: "g", MType: models.Gauge, Value: &value}}))
+	require.NoError(t, w.Write([]models.Metrics{}))
+	// основной файл обрезан при сбое
+	require.NoError(t, os.WriteFile(path, []byte(`{"format":"snapshot/v1","chec`), 0o644))
+
+	st := &SMockStorage{storage: map[models.MetricKey]*models.Metrics{}}
+	require.NoError(t, LoadMetrics(path, st))
+	require.Contains(t, st.storage, models.MetricKey{MType: models.Gauge, ID: "g"})
+	assert.Equal(t, 1.5, *st.storage[models.MetricKey{MType: models.Gauge, ID: "g"}].Value)
+}
+
+func TestLoadMetrics_NoValidSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(path, []byte(`garbage`), 0o644))
+
+	st := &SMockStorage{storage: map[models.MetricKey]*models.Metrics{}}
+	assert.Error(t, LoadMetrics(path, st))
+}
+
+func TestLoadMetrics_MissingFile(t *testing.T) {
+	st := &SMockStorage{storage: map[models.MetricKey]*models.Metrics{}}
+	require.NoError(t, LoadMetrics(filepath.Join(t.TempDir(), "missing.json"), st))
+	assert.Empty(t, st.storage)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
@@ -13,17 +14,36 @@ type Storage interface {
 	// UpdateMetric обновляем метрику в хранилище
 	UpdateMetric(ctx context.Context, value models.Metrics) error
 	UpdateMetrics(ctx context.Context, values []models.Metrics) error
-	GetAllMetrics(ctx context.Context) (map[string]*models.Metrics, error)
+	// GetAllMetrics возвращает все метрики, ключ результата - тип и имя метрики
+	GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error)
+	// GetMetric возвращает метрику по типу и имени или nil, если такой метрики нет
+	GetMetric(ctx context.Context, mType, id string) (*models.Metrics, error)
+	// GetMetrics возвращает найденные метрики по ключам, отсутствующие пропускаются
+	GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error)
+	// DeleteExpired удаляет метрики, не обновлявшиеся с момента Before, и возвращает удаленные
+	DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error)
+}
+
+// StalePolicy определяет, устарела ли метрика
+type StalePolicy interface {
+	IsStale(m *models.Metrics, now time.Time) bool
 }
 
 type MetricsService struct {
-	strg Storage
+	strg  Storage
+	stale StalePolicy
 }
 
 func NewMetricsService(storage Storage) *MetricsService {
 	return &MetricsService{strg: storage}
 }
 
+// WithStalePolicy включает отметку устаревших метрик в GetAllMetrics
+func (s *MetricsService) WithStalePolicy(p StalePolicy) *MetricsService {
+	s.stale = p
+	return s
+}
+
 // UpdateMetric обновляем метрику
 func (s MetricsService) UpdateMetric(ctx context.Context, metric models.Metrics) error {
 	return s.strg.UpdateMetric(ctx, metric)
@@ -31,29 +51,26 @@ func (s MetricsService) UpdateMetric(ctx context.Context, metric models.Metrics)
 
 // GetMetric получаем метрику
 func (s MetricsService) GetMetric(ctx context.Context, m models.Metrics) (*models.Metrics, error) {
-	metrics, err := s.strg.GetAllMetrics(ctx)
+	metric, err := s.strg.GetMetric(ctx, m.MType, m.ID)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка получения метрик %w", err)
+		return nil, fmt.Errorf("ошибка получения метрики %w", err)
 	}
-	metric, ok := metrics[m.ID]
-	if !ok {
+	if metric == nil {
 		return nil, fmt.Errorf("метрика не найдена")
 	}
-	if metric.MType != m.MType {
-		return nil, fmt.Errorf("метрика с таким типом не найдена")
-	}
 	return metric, nil
 }
 
-// GetAllMetrics получаем все метрики
-func (s MetricsService) GetAllMetrics(ctx context.Context) (map[string]string, error) {
-	result := make(map[string]string)
+// GetAllMetrics получаем значения всех метрик по типу и имени
+func (s MetricsService) GetAllMetrics(ctx context.Context) (map[models.MetricKey]models.MetricSummary, error) {
+	result := make(map[models.MetricKey]models.MetricSummary)
 	metrics, err := s.strg.GetAllMetrics(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения метрик %w", err)
 	}
+	now := time.Now()
 
-	for name, metric := range metrics {
+	for key, metric := range metrics {
 		var value string
 		switch metric.MType {
 		case models.Counter:
@@ -61,7 +78,7 @@ func (s MetricsService) GetAllMetrics(ctx context.Context) (map[string]string, e
 		case models.Gauge:
 			value = strconv.FormatFloat(*metric.Value, 'f', -1, 64)
 		}
-		result[name] = value
+		result[key] = models.MetricSummary{Value: value, Stale: s.stale != nil && s.stale.IsStale(metric, now)}
 	}
 	return result, nil
 }
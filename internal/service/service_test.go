@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -12,24 +13,49 @@ import (
 )
 
 type SMockStorage struct {
-	storage map[string]*models.Metrics
+	storage map[models.MetricKey]*models.Metrics
 	err     error
 }
 
 func (ms *SMockStorage) UpdateMetric(ctx context.Context, m models.Metrics) error {
-	ms.storage[m.ID] = &m
+	ms.storage[m.Key()] = &m
 	return ms.err
 }
-func (ms *SMockStorage) GetAndClear() map[string]*models.Metrics {
+func (ms *SMockStorage) GetAndClear() map[models.MetricKey]*models.Metrics {
 	return ms.storage
 }
-func (ms *SMockStorage) GetAllMetrics(ctx context.Context) (map[string]*models.Metrics, error) {
+func (ms *SMockStorage) GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error) {
 	return ms.storage, nil
 }
 
+func (ms *SMockStorage) GetMetric(ctx context.Context, mType, id string) (*models.Metrics, error) {
+	return ms.storage[models.MetricKey{MType: mType, ID: id}], ms.err
+}
+
+func (ms *SMockStorage) GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	res := make(map[models.MetricKey]*models.Metrics)
+	for _, k := range keys {
+		if m, _ := ms.GetMetric(ctx, k.MType, k.ID); m != nil {
+			res[k] = m
+		}
+	}
+	return res, ms.err
+}
+
+func (ms *SMockStorage) DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error) {
+	var deleted []models.Metrics
+	for _, e := range expired {
+		if m, ok := ms.storage[e.MetricKey]; ok && m.UpdatedAt != nil && m.UpdatedAt.Before(e.Before) {
+			delete(ms.storage, e.MetricKey)
+			deleted = append(deleted, *m)
+		}
+	}
+	return deleted, ms.err
+}
+
 func (ms *SMockStorage) UpdateMetrics(ctx context.Context, m []models.Metrics) error {
 	for _, metric := range m {
-		ms.storage[metric.ID] = &metric
+		ms.storage[metric.Key()] = &metric
 	}
 	return ms.err
 }
@@ -43,17 +69,17 @@ func TestMetricsService_UpdateMetric(t *testing.T) {
 		parts   []string
 		fields  fields
 		wantErr bool
-		want    map[string]*models.Metrics
+		want    map[models.MetricKey]*models.Metrics
 	}{
 		{
 			name:  "valid counter",
 			parts: []string{"counter", "requests", "100"},
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{},
+				storage: map[models.MetricKey]*models.Metrics{},
 				err:     nil},
 			},
 			wantErr: false,
-			want: map[string]*models.Metrics{"requests": {
+			want: map[models.MetricKey]*models.Metrics{{MType: models.Counter, ID: "requests"}: {
 				ID:    "requests",
 				MType: models.Counter,
 				Delta: toPtr(int64(100)),
@@ -63,11 +89,11 @@ func TestMetricsService_UpdateMetric(t *testing.T) {
 			name:  "valid gauge",
 			parts: []string{"gauge", "cpu", "0.85"},
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{},
+				storage: map[models.MetricKey]*models.Metrics{},
 				err:     nil},
 			},
 			wantErr: false,
-			want: map[string]*models.Metrics{"cpu": {
+			want: map[models.MetricKey]*models.Metrics{{MType: models.Gauge, ID: "cpu"}: {
 				ID:    "cpu",
 				MType: models.Gauge,
 				Value: toPtr(0.85),
@@ -77,11 +103,11 @@ func TestMetricsService_UpdateMetric(t *testing.T) {
 			name:  "counter with negative value",
 			parts: []string{"counter", "errors", "-50"},
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{},
+				storage: map[models.MetricKey]*models.Metrics{},
 				err:     nil},
 			},
 			wantErr: false,
-			want: map[string]*models.Metrics{"errors": {
+			want: map[models.MetricKey]*models.Metrics{{MType: models.Counter, ID: "errors"}: {
 				ID:    "errors",
 				MType: models.Counter,
 				Delta: toPtr(int64(-50)),
@@ -91,11 +117,11 @@ func TestMetricsService_UpdateMetric(t *testing.T) {
 			name:  "storage returns error",
 			parts: []string{"counter", "requests", "100"},
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{},
+				storage: map[models.MetricKey]*models.Metrics{},
 				err:     fmt.Errorf("test error")},
 			},
 			wantErr: true,
-			want:    map[string]*models.Metrics{},
+			want:    map[models.MetricKey]*models.Metrics{},
 		},
 	}
 
@@ -137,7 +163,7 @@ func TestMetricsService_GetMetric(t *testing.T) {
 		{
 			name: "counter metric exists",
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{"requests": {
+				storage: map[models.MetricKey]*models.Metrics{{MType: models.Counter, ID: "requests"}: {
 					ID:    "requests",
 					MType: models.Counter,
 					Delta: toPtr(int64(100)),
@@ -156,7 +182,7 @@ func TestMetricsService_GetMetric(t *testing.T) {
 		{
 			name: "gauge metric exists",
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{"cpu": {
+				storage: map[models.MetricKey]*models.Metrics{{MType: models.Gauge, ID: "cpu"}: {
 					ID:    "cpu",
 					MType: models.Gauge,
 					Value: toPtr(0.85),
@@ -175,7 +201,7 @@ func TestMetricsService_GetMetric(t *testing.T) {
 		{
 			name: "unknown type",
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{"cpu": {
+				storage: map[models.MetricKey]*models.Metrics{{MType: "counter", ID: "cpu"}: {
 					ID:    "cpu",
 					MType: "counter",
 					Value: toPtr(0.85),
@@ -190,7 +216,7 @@ func TestMetricsService_GetMetric(t *testing.T) {
 		{
 			name: "unknown metric",
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{"cpu": {
+				storage: map[models.MetricKey]*models.Metrics{{MType: models.Gauge, ID: "cpu"}: {
 					MType: models.Gauge,
 					Value: toPtr(0.85),
 				}},
@@ -221,6 +247,12 @@ func TestMetricsService_GetMetric(t *testing.T) {
 	}
 }
 
+func TestMetricsService_GetMetric_StorageError(t *testing.T) {
+	service := NewMetricsService(&SMockStorage{storage: map[models.MetricKey]*models.Metrics{}, err: fmt.Errorf("db down")})
+	_, err := service.GetMetric(context.TODO(), models.Metrics{ID: "cpu", MType: models.Gauge})
+	assert.ErrorContains(t, err, "db down")
+}
+
 func TestMetricsService_GetAllMetrics(t *testing.T) {
 	type fields struct {
 		s Storage
@@ -228,41 +260,57 @@ func TestMetricsService_GetAllMetrics(t *testing.T) {
 	tests := []struct {
 		name   string
 		fields fields
-		want   map[string]string
+		stale  StalePolicy
+		want   map[models.MetricKey]models.MetricSummary
 	}{
 		{
 			name: "get all values",
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{"requests": {
+				storage: map[models.MetricKey]*models.Metrics{{MType: models.Counter, ID: "requests"}: {
 					MType: models.Counter,
 					Delta: toPtr(int64(100)),
 				},
-					"cpu": {
+					{MType: models.Gauge, ID: "cpu"}: {
 						MType: models.Gauge,
 						Value: toPtr(0.85),
 					}},
 				err: nil},
 			},
 
-			want: map[string]string{"requests": "100", "cpu": "0.85"},
+			want: map[models.MetricKey]models.MetricSummary{
+				{MType: models.Counter, ID: "requests"}: {Value: "100"},
+				{MType: models.Gauge, ID: "cpu"}:        {Value: "0.85"},
+			},
+		},
+		{
+			name: "stale metrics are flagged",
+			fields: fields{s: &SMockStorage{
+				storage: map[models.MetricKey]*models.Metrics{
+					{MType: models.Counter, ID: "requests"}: {ID: "requests", MType: models.Counter, Delta: toPtr(int64(100))},
+					{MType: models.Gauge, ID: "requests"}:   {ID: "requests", MType: models.Gauge, Value: toPtr(0.85)},
+				}},
+			},
+			stale: staleTypes{models.Gauge: true},
+			want: map[models.MetricKey]models.MetricSummary{
+				{MType: models.Counter, ID: "requests"}: {Value: "100"},
+				{MType: models.Gauge, ID: "requests"}:   {Value: "0.85", Stale: true},
+			},
 		},
 		{
 			name: "empty map",
 			fields: fields{s: &SMockStorage{
-				storage: map[string]*models.Metrics{},
+				storage: map[models.MetricKey]*models.Metrics{},
 				err:     nil},
 			},
 
-			want: map[string]string{},
+			want: map[models.MetricKey]models.MetricSummary{},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			service := &MetricsService{
-				strg: tt.fields.s,
-			}
+			service := NewMetricsService(tt.fields.s).WithStalePolicy(tt.stale)
 
 			metrics, err := service.GetAllMetrics(context.TODO())
 			assert.Nil(t, err)
@@ -271,6 +319,13 @@ func TestMetricsService_GetAllMetrics(t *testing.T) {
 	}
 }
 
+// staleTypes считает устаревшими все метрики заданных типов
+type staleTypes map[string]bool
+
+func (s staleTypes) IsStale(m *models.Metrics, _ time.Time) bool {
+	return s[m.MType]
+}
+
 func toPtr[T int64 | float64](value T) *T {
 	return &value
 }
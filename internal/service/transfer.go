@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// Format - формат файла выгрузки метрик
+type Format string
+
+const (
+	// FormatJSON - JSON-массив метрик, как в файле хранилища и в /updates/
+	FormatJSON Format = "json"
+	// FormatNDJSON - одна метрика в формате JSON на строку, как в /updates/stream
+	FormatNDJSON Format = "ndjson"
+)
+
+// ParseFormat разбирает название формата выгрузки
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatJSON, FormatNDJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q: expected json or ndjson", s)
+}
+
+// ImportMode - как импортируемые метрики сочетаются с уже сохраненными
+type ImportMode string
+
+const (
+	// ImportMerge - значения счетчиков прибавляются к сохраненным, gauge заменяются
+	ImportMerge ImportMode = "merge"
+	// ImportOverwrite - сохраненные значения заменяются импортируемыми, повторный импорт ничего не меняет
+	ImportOverwrite ImportMode = "overwrite"
+)
+
+// ParseImportMode разбирает режим импорта
+func ParseImportMode(s string) (ImportMode, error) {
+	switch m := ImportMode(s); m {
+	case ImportMerge, ImportOverwrite:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown import mode %q: expected merge or overwrite", s)
+}
+
+// ExportMetrics возвращает все метрики хранилища, упорядоченные по имени и типу
+func ExportMetrics(ctx context.Context, st Storage) ([]models.Metrics, error) {
+	all, err := st.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]models.Metrics, 0, len(all))
+	for _, m := range all {
+		metrics = append(metrics, *m)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Key().Less(metrics[j].Key())
+	})
+	return metrics, nil
+}
+
+// ImportMetrics записывает метрики в хранилище одним пакетом. В режиме ImportOverwrite счетчики получают
+// разницу с сохраненным значением, поэтому режим работает с хранилищем любого типа; из повторов одной
+// метрики берется последний.
+func ImportMetrics(ctx context.Context, st Storage, metrics []models.Metrics, mode ImportMode) error {
+	for i := range metrics {
+		if err := validateImported(&metrics[i]); err != nil {
+			return fmt.Errorf("metric %d: %w", i+1, err)
+		}
+	}
+	if mode == ImportOverwrite {
+		current, err := st.GetAllMetrics(ctx)
+		if err != nil {
+			return err
+		}
+		metrics = overwriteUpdates(current, metrics)
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	return st.UpdateMetrics(ctx, metrics)
+}
+
+func validateImported(m *models.Metrics) error {
+	if m.ID == "" {
+		return errors.New("metric name is empty")
+	}
+	switch m.MType {
+	case models.Counter:
+		if m.Delta == nil {
+			return fmt.Errorf("counter %s has no delta", m.ID)
+		}
+	case models.Gauge:
+		if m.Value == nil {
+			return fmt.Errorf("gauge %s has no value", m.ID)
+		}
+	default:
+		return fmt.Errorf("metric %s has unknown type %q", m.ID, m.MType)
+	}
+	return nil
+}
+
+// overwriteUpdates строит пакет, после применения которого значения метрик совпадут с metrics
+func overwriteUpdates(current map[models.MetricKey]*models.Metrics, metrics []models.Metrics) []models.Metrics {
+	last := make(map[models.MetricKey]models.Metrics, len(metrics))
+	var order []models.MetricKey
+	for _, m := range metrics {
+		if _, ok := last[m.Key()]; !ok {
+			order = append(order, m.Key())
+		}
+		last[m.Key()] = m
+	}
+
+	var updates []models.Metrics
+	for _, key := range order {
+		m := last[key]
+		cur := current[key]
+		switch m.MType {
+		case models.Counter:
+			delta := *m.Delta
+			if cur != nil && cur.Delta != nil {
+				delta -= *cur.Delta
+			}
+			if cur == nil || delta != 0 {
+				updates = append(updates, models.Metrics{ID: m.ID, MType: m.MType, Delta: &delta})
+			}
+		case models.Gauge:
+			if cur == nil || cur.Value == nil || *cur.Value != *m.Value {
+				updates = append(updates, models.Metrics{ID: m.ID, MType: m.MType, Value: m.Value})
+			}
+		}
+	}
+	return updates
+}
+
+// WriteMetrics записывает метрики в w в формате f
+func WriteMetrics(w io.Writer, metrics []models.Metrics, f Format) error {
+	if f == FormatJSON {
+		if metrics == nil {
+			metrics = []models.Metrics{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(metrics)
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for i := range metrics {
+		if err := enc.Encode(&metrics[i]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadNDJSON читает метрики, записанные по одной на строку
+func ReadNDJSON(r io.Reader) ([]models.Metrics, error) {
+	dec := json.NewDecoder(r)
+	var metrics []models.Metrics
+	for {
+		var m models.Metrics
+		err := dec.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			return metrics, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("metric %d: %w", len(metrics)+1, err)
+		}
+		metrics = append(metrics, m)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+func TestImportMetrics(t *testing.T) {
+	imported := []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(10))},
+		{ID: "g", MType: models.Gauge, Value: toPtr(2.5)},
+		{ID: "new", MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))},
+	}
+	tests := []struct {
+		name string
+		mode ImportMode
+		want map[models.MetricKey]float64
+	}{
+		{
+			name: "merge adds counters",
+			mode: ImportMerge,
+			want: map[models.MetricKey]float64{
+				{MType: models.Counter, ID: "c"}:   18,
+				{MType: models.Counter, ID: "new"}: 1,
+				{MType: models.Counter, ID: "old"}: 7,
+				{MType: models.Gauge, ID: "g"}:     2.5,
+			},
+		},
+		{
+			name: "overwrite takes last value",
+			mode: ImportOverwrite,
+			want: map[models.MetricKey]float64{
+				{MType: models.Counter, ID: "c"}:   5,
+				{MType: models.Counter, ID: "new"}: 1,
+				{MType: models.Counter, ID: "old"}: 7,
+				{MType: models.Gauge, ID: "g"}:     2.5,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := storage.NewMemStorage()
+			require.NoError(t, mem.UpdateMetrics(ctx, []models.Metrics{
+				{ID: "c", MType: models.Counter, Delta: toPtr(int64(3))},
+				{ID: "old", MType: models.Counter, Delta: toPtr(int64(7))},
+				{ID: "g", MType: models.Gauge, Value: toPtr(1.0)},
+			}))
+
+			require.NoError(t, ImportMetrics(ctx, mem, imported, tt.mode))
+			assert.Equal(t, tt.want, values(t, mem))
+
+			// повторный импорт с перезаписью ничего не меняет
+			if tt.mode == ImportOverwrite {
+				require.NoError(t, ImportMetrics(ctx, mem, imported, tt.mode))
+				assert.Equal(t, tt.want, values(t, mem))
+			}
+		})
+	}
+}
+
+func TestImportMetrics_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric models.Metrics
+	}{
+		{name: "no name", metric: models.Metrics{MType: models.Gauge, Value: toPtr(1.0)}},
+		{name: "counter without delta", metric: models.Metrics{ID: "c", MType: models.Counter}},
+		{name: "gauge without value", metric: models.Metrics{ID: "g", MType: models.Gauge}},
+		{name: "unknown type", metric: models.Metrics{ID: "h", MType: "histogram", Value: toPtr(1.0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := storage.NewMemStorage()
+			assert.Error(t, ImportMetrics(context.Background(), mem, []models.Metrics{tt.metric}, ImportMerge))
+			assert.Empty(t, values(t, mem))
+		})
+	}
+}
+
+func TestWriteMetrics_ReadBack(t *testing.T) {
+	metrics := []models.Metrics{
+		{ID: "Alloc", MType: models.Gauge, Value: toPtr(1.5)},
+		{ID: "PollCount", MType: models.Counter, Delta: toPtr(int64(5))},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteMetrics(&buf, metrics, FormatNDJSON))
+	assert.Equal(t, "{\"id\":\"Alloc\",\"type\":\"gauge\",\"value\":1.5}\n{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":5}\n", buf.String())
+	got, err := ReadNDJSON(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, metrics, got)
+
+	// JSON-выгрузка читается так же, как файл хранилища сервера
+	path := filepath.Join(t.TempDir(), "export.json")
+	buf.Reset()
+	require.NoError(t, WriteMetrics(&buf, metrics, FormatJSON))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	got, err = ReadMetricsFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, metrics, got)
+}
+
+func TestReadNDJSON_Invalid(t *testing.T) {
+	_, err := ReadNDJSON(bytes.NewBufferString("{\"id\":\"a\",\"type\":\"gauge\",\"value\":1}\n{\"id\":"))
+	assert.Error(t, err)
+}
+
+func TestParseImportMode(t *testing.T) {
+	m, err := ParseImportMode("merge")
+	require.NoError(t, err)
+	assert.Equal(t, ImportMerge, m)
+	_, err = ParseImportMode("replace")
+	assert.Error(t, err)
+
+	f, err := ParseFormat("ndjson")
+	require.NoError(t, err)
+	assert.Equal(t, FormatNDJSON, f)
+	_, err = ParseFormat("csv")
+	assert.Error(t, err)
+}
+
+func values(t *testing.T, st Storage) map[models.MetricKey]float64 {
+	t.Helper()
+	all, err := st.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	got := make(map[models.MetricKey]float64, len(all))
+	for k, m := range all {
+		if m.Delta != nil {
+			got[k] = float64(*m.Delta)
+		} else {
+			got[k] = *m.Value
+		}
+	}
+	return got
+}
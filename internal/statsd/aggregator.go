@@ -0,0 +1,166 @@
+package statsd
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+// Storage - хранилище, в которое сбрасываются агрегированные метрики
+type Storage interface {
+	UpdateMetrics(ctx context.Context, values []models.Metrics) error
+	GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error)
+}
+
+type gaugeValue struct {
+	value float64
+	// relative - значение является приращением к gauge, текущее значение которого еще не известно
+	relative bool
+}
+
+type timerStats struct {
+	// samples - число принятых семплов, count - оценка числа событий с учетом частоты семплирования
+	samples    int
+	count, sum float64
+	min, max   float64
+}
+
+// Aggregator накапливает метрики в окне сброса: счетчики суммируются с учетом частоты семплирования,
+// для gauge остается последнее значение, по таймерам считаются count, mean, min и max.
+type Aggregator struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]gaugeValue
+	timers   map[string]*timerStats
+	// known - последние записанные значения gauge, от которых отсчитываются приращения +/-
+	known map[string]float64
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]gaugeValue),
+		timers:   make(map[string]*timerStats),
+		known:    make(map[string]float64),
+	}
+}
+
+// Add добавляет семпл в текущее окно
+func (a *Aggregator) Add(s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch s.Type {
+	case Counter:
+		a.counters[s.Name] += s.Value / s.Rate
+	case Gauge:
+		if !s.Relative {
+			a.gauges[s.Name] = gaugeValue{value: s.Value}
+			return
+		}
+		if g, ok := a.gauges[s.Name]; ok {
+			g.value += s.Value
+			a.gauges[s.Name] = g
+		} else if base, ok := a.known[s.Name]; ok {
+			a.gauges[s.Name] = gaugeValue{value: base + s.Value}
+		} else {
+			a.gauges[s.Name] = gaugeValue{value: s.Value, relative: true}
+		}
+	case Timer, Histogram:
+		t, ok := a.timers[s.Name]
+		if !ok {
+			t = &timerStats{min: s.Value, max: s.Value}
+			a.timers[s.Name] = t
+		}
+		t.samples++
+		t.count += 1 / s.Rate
+		t.sum += s.Value
+		t.min = math.Min(t.min, s.Value)
+		t.max = math.Max(t.max, s.Value)
+	}
+}
+
+// Flush записывает накопленное окно в хранилище и начинает новое
+func (a *Aggregator) Flush(ctx context.Context, strg Storage) error {
+	a.mu.Lock()
+	counters, gauges, timers := a.counters, a.gauges, a.timers
+	a.counters = make(map[string]float64)
+	a.gauges = make(map[string]gaugeValue)
+	a.timers = make(map[string]*timerStats)
+	a.mu.Unlock()
+
+	if err := a.resolveRelative(ctx, strg, gauges); err != nil {
+		return err
+	}
+
+	metrics := make([]models.Metrics, 0, len(counters)+len(gauges)+4*len(timers))
+	for name, v := range counters {
+		metrics = append(metrics, counterMetric(name, v))
+	}
+	for name, g := range gauges {
+		metrics = append(metrics, gaugeMetric(name, g.value))
+	}
+	for name, t := range timers {
+		metrics = append(metrics,
+			counterMetric(name+".count", t.count),
+			gaugeMetric(name+".mean", t.sum/float64(t.samples)),
+			gaugeMetric(name+".min", t.min),
+			gaugeMetric(name+".max", t.max),
+		)
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].ID < metrics[j].ID
+	})
+
+	if err := strg.UpdateMetrics(ctx, metrics); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	for name, g := range gauges {
+		a.known[name] = g.value
+	}
+	a.mu.Unlock()
+	return nil
+}
+
+// resolveRelative отсчитывает приращения неизвестных gauge от значений, уже сохраненных в хранилище
+func (a *Aggregator) resolveRelative(ctx context.Context, strg Storage, gauges map[string]gaugeValue) error {
+	var keys []models.MetricKey
+	for name, g := range gauges {
+		if g.relative {
+			keys = append(keys, models.MetricKey{MType: models.Gauge, ID: name})
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	stored, err := strg.GetMetrics(ctx, keys)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		g := gauges[key.ID]
+		if m, ok := stored[key]; ok && m.Value != nil {
+			g.value += *m.Value
+		}
+		g.relative = false
+		gauges[key.ID] = g
+	}
+	return nil
+}
+
+func counterMetric(name string, v float64) models.Metrics {
+	delta := int64(math.Round(v))
+	return models.Metrics{ID: name, MType: models.Counter, Delta: &delta}
+}
+
+func gaugeMetric(name string, v float64) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &v}
+}
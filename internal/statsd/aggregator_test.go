@@ -0,0 +1,90 @@
+package statsd
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+type recordingStorage struct {
+	*storage.MemStorage
+	mu      sync.Mutex
+	batches [][]models.Metrics
+}
+
+func newRecordingStorage() *recordingStorage {
+	return &recordingStorage{MemStorage: storage.NewMemStorage()}
+}
+
+func (s *recordingStorage) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	s.mu.Lock()
+	s.batches = append(s.batches, values)
+	s.mu.Unlock()
+	return s.MemStorage.UpdateMetrics(ctx, values)
+}
+
+func (s *recordingStorage) Batches() [][]models.Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	strg := newRecordingStorage()
+	agg := NewAggregator()
+
+	for _, line := range []string{
+		"requests:1|c", "requests:2|c|@0.5",
+		"temp:10|g", "temp:+2|g",
+		"latency:100|ms", "latency:300|ms|@0.5",
+	} {
+		s, err := ParseLine(line)
+		require.NoError(t, err)
+		agg.Add(s)
+	}
+	require.NoError(t, agg.Flush(context.Background(), strg))
+
+	require.Len(t, strg.Batches(), 1)
+	assert.Equal(t, []models.Metrics{
+		{ID: "latency.count", MType: models.Counter, Delta: toPtr(int64(3))},
+		{ID: "latency.max", MType: models.Gauge, Value: toPtr(300.0)},
+		{ID: "latency.mean", MType: models.Gauge, Value: toPtr(200.0)},
+		{ID: "latency.min", MType: models.Gauge, Value: toPtr(100.0)},
+		{ID: "requests", MType: models.Counter, Delta: toPtr(int64(5))},
+		{ID: "temp", MType: models.Gauge, Value: toPtr(12.0)},
+	}, strg.Batches()[0])
+
+	// пустое окно в хранилище не пишется
+	require.NoError(t, agg.Flush(context.Background(), strg))
+	assert.Len(t, strg.Batches(), 1)
+}
+
+func TestAggregator_RelativeGauge(t *testing.T) {
+	strg := newRecordingStorage()
+	require.NoError(t, strg.UpdateMetric(context.Background(),
+		models.Metrics{ID: "stored", MType: models.Gauge, Value: toPtr(40.0)}))
+
+	agg := NewAggregator()
+	agg.Add(Sample{Name: "stored", Type: Gauge, Value: 2, Rate: 1, Relative: true})
+	agg.Add(Sample{Name: "fresh", Type: Gauge, Value: -3, Rate: 1, Relative: true})
+	require.NoError(t, agg.Flush(context.Background(), strg))
+
+	// следующее приращение отсчитывается от последнего записанного значения
+	agg.Add(Sample{Name: "fresh", Type: Gauge, Value: 1, Rate: 1, Relative: true})
+	require.NoError(t, agg.Flush(context.Background(), strg))
+
+	metrics, err := strg.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 42.0, *metrics[models.MetricKey{MType: models.Gauge, ID: "stored"}].Value)
+	assert.Equal(t, -2.0, *metrics[models.MetricKey{MType: models.Gauge, ID: "fresh"}].Value)
+}
@@ -0,0 +1,124 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+)
+
+const maxPacketSize = 64 * 1024
+
+// Listener принимает датаграммы StatsD и периодически сбрасывает агрегированные метрики в хранилище
+type Listener struct {
+	conn     net.PacketConn
+	network  string
+	addr     string
+	strg     Storage
+	agg      *Aggregator
+	interval time.Duration
+}
+
+// Listen открывает сокет network ("udp" или "unixgram") на адресе addr. Метрики сбрасываются в strg
+// раз в interval.
+func Listen(network, addr string, strg Storage, interval time.Duration) (*Listener, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("statsd: flush interval must be positive, got %s", interval)
+	}
+	if network == "unixgram" {
+		removeStaleSocket(addr)
+	}
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{conn: conn, network: network, addr: addr, strg: strg, agg: NewAggregator(), interval: interval}, nil
+}
+
+// Addr - адрес, на котором открыт сокет
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Close закрывает сокет слушателя, для которого не запускался Serve
+func (l *Listener) Close() error {
+	err := l.conn.Close()
+	if l.network == "unixgram" {
+		_ = os.Remove(l.addr)
+	}
+	return err
+}
+
+// Serve читает датаграммы до отмены ctx, после чего закрывает сокет и сбрасывает последнее окно
+func (l *Listener) Serve(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.read()
+	}()
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.flush(ctx)
+		case <-ctx.Done():
+			if err := l.conn.Close(); err != nil {
+				logger.Log.Error("Error closing statsd listener", zap.Error(err))
+			}
+			wg.Wait()
+			if l.network == "unixgram" {
+				_ = os.Remove(l.addr)
+			}
+
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			l.flush(flushCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+func (l *Listener) read() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Log.Error("Error reading statsd packet", zap.Error(err))
+			continue
+		}
+		samples, err := ParsePacket(buf[:n])
+		if err != nil {
+			logger.Log.Debug("Malformed statsd lines", zap.Error(err))
+		}
+		for _, s := range samples {
+			l.agg.Add(s)
+		}
+	}
+}
+
+func (l *Listener) flush(ctx context.Context) {
+	if err := l.agg.Flush(ctx, l.strg); err != nil {
+		logger.Log.Error("Error flushing statsd metrics", zap.Error(err))
+	}
+}
+
+// removeStaleSocket удаляет сокет, оставшийся от предыдущего запуска. Обычные файлы не трогаются.
+func removeStaleSocket(path string) {
+	fi, err := os.Stat(path)
+	if err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+}
@@ -0,0 +1,75 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+)
+
+func TestListener(t *testing.T) {
+	tests := []struct {
+		network string
+		addr    func(t *testing.T) string
+	}{
+		{network: "udp", addr: func(t *testing.T) string { return "127.0.0.1:0" }},
+		{network: "unixgram", addr: func(t *testing.T) string { return filepath.Join(t.TempDir(), "statsd.sock") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			strg := newRecordingStorage()
+			l, err := Listen(tt.network, tt.addr(t), strg, time.Hour)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				l.Serve(ctx)
+			}()
+
+			conn, err := net.Dial(tt.network, l.Addr().String())
+			require.NoError(t, err)
+			_, err = conn.Write([]byte("hits:1|c\nhits:1|c\ngarbage\n"))
+			require.NoError(t, err)
+			_, err = conn.Write([]byte("load:0.7|g"))
+			require.NoError(t, err)
+			require.NoError(t, conn.Close())
+
+			// датаграммы должны быть прочитаны до остановки, иначе они потеряются вместе с сокетом
+			require.Eventually(t, func() bool {
+				l.agg.mu.Lock()
+				defer l.agg.mu.Unlock()
+				return len(l.agg.gauges) == 1
+			}, time.Second, 10*time.Millisecond)
+
+			cancel()
+			<-done
+
+			metrics, err := strg.GetAllMetrics(context.Background())
+			require.NoError(t, err)
+			require.Contains(t, metrics, models.MetricKey{MType: models.Counter, ID: "hits"})
+			require.Contains(t, metrics, models.MetricKey{MType: models.Gauge, ID: "load"})
+			assert.Equal(t, int64(2), *metrics[models.MetricKey{MType: models.Counter, ID: "hits"}].Delta)
+			assert.Equal(t, 0.7, *metrics[models.MetricKey{MType: models.Gauge, ID: "load"}].Value)
+		})
+	}
+}
+
+func TestListener_Close(t *testing.T) {
+	l, err := Listen("udp", "127.0.0.1:0", newRecordingStorage(), time.Hour)
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	// порт освобожден и может быть открыт снова
+	l, err = Listen("udp", addr, newRecordingStorage(), time.Hour)
+	require.NoError(t, err)
+	assert.NoError(t, l.Close())
+}
@@ -0,0 +1,93 @@
+// Package statsd принимает метрики в формате StatsD по UDP или unix datagram сокету,
+// агрегирует их в окне сброса и записывает в хранилище сервера.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Типы метрик StatsD
+const (
+	Counter   = "c"
+	Gauge     = "g"
+	Timer     = "ms"
+	Histogram = "h"
+)
+
+// Sample - одна строка StatsD вида name:value|type[|@rate][|#tags]
+type Sample struct {
+	Name  string
+	Type  string
+	Value float64
+	// Rate - частота семплирования из @rate, по умолчанию 1
+	Rate float64
+	// Relative - значение gauge со знаком +/- является приращением, а не новым значением
+	Relative bool
+}
+
+// ParseLine разбирает строку StatsD. Теги (#...) игнорируются, sets (|s) не поддерживаются.
+func ParseLine(line string) (Sample, error) {
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return Sample{}, fmt.Errorf("invalid line %q: missing type", line)
+	}
+
+	i := strings.LastIndexByte(parts[0], ':')
+	if i <= 0 {
+		return Sample{}, fmt.Errorf("invalid line %q: missing name or value", line)
+	}
+	s := Sample{Name: parts[0][:i], Type: parts[1], Rate: 1}
+	raw := parts[0][i+1:]
+
+	switch s.Type {
+	case Counter, Gauge, Timer, Histogram:
+	default:
+		return Sample{}, fmt.Errorf("invalid line %q: unsupported type %q", line, s.Type)
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Sample{}, fmt.Errorf("invalid line %q: invalid value %q", line, raw)
+	}
+	s.Value = v
+	s.Relative = s.Type == Gauge && (raw[0] == '+' || raw[0] == '-')
+
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("invalid line %q: invalid sample rate %q", line, p)
+			}
+			s.Rate = rate
+		case strings.HasPrefix(p, "#"):
+		default:
+			return Sample{}, fmt.Errorf("invalid line %q: unexpected section %q", line, p)
+		}
+	}
+	return s, nil
+}
+
+// ParsePacket разбирает датаграмму из нескольких строк, разделенных переводом строки.
+// Некорректные строки не прерывают разбор, ошибки по ним возвращаются вместе.
+func ParsePacket(packet []byte) ([]Sample, error) {
+	var samples []Sample
+	var errs []error
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		s, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		samples = append(samples, s)
+	}
+	return samples, errors.Join(errs...)
+}
@@ -0,0 +1,51 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{line: "requests:1|c", want: Sample{Name: "requests", Type: Counter, Value: 1, Rate: 1}},
+		{line: "requests:2|c|@0.5", want: Sample{Name: "requests", Type: Counter, Value: 2, Rate: 0.5}},
+		{line: "temp:3.2|g", want: Sample{Name: "temp", Type: Gauge, Value: 3.2, Rate: 1}},
+		{line: "temp:+1|g", want: Sample{Name: "temp", Type: Gauge, Value: 1, Rate: 1, Relative: true}},
+		{line: "temp:-2.5|g", want: Sample{Name: "temp", Type: Gauge, Value: -2.5, Rate: 1, Relative: true}},
+		{line: "latency:320|ms|@0.1|#env:prod", want: Sample{Name: "latency", Type: Timer, Value: 320, Rate: 0.1}},
+		{line: "size:12|h", want: Sample{Name: "size", Type: Histogram, Value: 12, Rate: 1}},
+		{line: "a:b:1|c", want: Sample{Name: "a:b", Type: Counter, Value: 1, Rate: 1}},
+		{line: "requests:1", wantErr: true},
+		{line: ":1|c", wantErr: true},
+		{line: "users:42|s", wantErr: true},
+		{line: "requests:x|c", wantErr: true},
+		{line: "requests:1|c|@0", wantErr: true},
+		{line: "requests:1|c|@2", wantErr: true},
+		{line: "requests:1|c|extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	samples, err := ParsePacket([]byte("a:1|c\nbroken\n\nb:2|g\n"))
+	assert.Error(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, "a", samples[0].Name)
+	assert.Equal(t, "b", samples[1].Name)
+}
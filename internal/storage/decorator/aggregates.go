@@ -0,0 +1,86 @@
+package decorator
+
+import (
+	"context"
+
+	"github.com/ValentinaKh/go-metrics/internal/aggregate"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+)
+
+// StoreWithAggregates ведет окна агрегатов для gauge-метрик, записанных в хранилище, и добавляет
+// их к метрикам, возвращаемым GetMetric и GetMetrics. Списки (GetAllMetrics) агрегатов не содержат.
+type StoreWithAggregates struct {
+	service.Storage
+	tracker *aggregate.Tracker
+}
+
+func NewStoreWithAggregates(storage service.Storage, tracker *aggregate.Tracker) *StoreWithAggregates {
+	return &StoreWithAggregates{Storage: storage, tracker: tracker}
+}
+
+func (s *StoreWithAggregates) UpdateMetric(ctx context.Context, value models.Metrics) error {
+	if err := s.Storage.UpdateMetric(ctx, value); err != nil {
+		return err
+	}
+	s.observe(&value)
+	return nil
+}
+
+func (s *StoreWithAggregates) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	if err := s.Storage.UpdateMetrics(ctx, values); err != nil {
+		return err
+	}
+	for i := range values {
+		s.observe(&values[i])
+	}
+	return nil
+}
+
+func (s *StoreWithAggregates) GetMetric(ctx context.Context, mType, id string) (*models.Metrics, error) {
+	m, err := s.Storage.GetMetric(ctx, mType, id)
+	if err != nil || m == nil {
+		return m, err
+	}
+	return s.withAggregates(m), nil
+}
+
+func (s *StoreWithAggregates) GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	metrics, err := s.Storage.GetMetrics(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for key, m := range metrics {
+		metrics[key] = s.withAggregates(m)
+	}
+	return metrics, nil
+}
+
+// DeleteExpired удаляет устаревшие метрики вместе с их окнами
+func (s *StoreWithAggregates) DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error) {
+	deleted, err := s.Storage.DeleteExpired(ctx, expired)
+	var gauges []string
+	for _, m := range deleted {
+		if m.MType == models.Gauge {
+			gauges = append(gauges, m.ID)
+		}
+	}
+	s.tracker.Remove(gauges...)
+	return deleted, err
+}
+
+func (s *StoreWithAggregates) observe(m *models.Metrics) {
+	if m.MType == models.Gauge && m.Value != nil {
+		s.tracker.Observe(m.ID, *m.Value)
+	}
+}
+
+// withAggregates возвращает копию метрики с агрегатами: хранилище может отдавать общие неизменяемые снимки
+func (s *StoreWithAggregates) withAggregates(m *models.Metrics) *models.Metrics {
+	if m.MType != models.Gauge {
+		return m
+	}
+	c := *m
+	c.Aggregates = s.tracker.Aggregates(m.ID)
+	return &c
+}
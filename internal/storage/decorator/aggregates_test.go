@@ -0,0 +1,89 @@
+package decorator
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/aggregate"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+func TestStoreWithAggregates(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemStorage()
+	s := NewStoreWithAggregates(mem, aggregate.NewTracker([]time.Duration{time.Minute}))
+
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "cpu", MType: models.Gauge, Value: toPtr(10.0)}))
+	require.NoError(t, s.UpdateMetrics(ctx, []models.Metrics{
+		{ID: "cpu", MType: models.Gauge, Value: toPtr(30.0)},
+		{ID: "cpu", MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: "cpu", MType: models.Gauge, Value: toPtr(20.0)},
+	}))
+
+	gauge, err := s.GetMetric(ctx, models.Gauge, "cpu")
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, *gauge.Value)
+	assert.Equal(t, []models.Aggregate{
+		{Window: "1m", Min: 10, Max: 30, Sum: 60, Count: 3, Avg: 20, Last: 20},
+	}, gauge.Aggregates)
+
+	counter, err := s.GetMetric(ctx, models.Counter, "cpu")
+	require.NoError(t, err)
+	assert.Nil(t, counter.Aggregates)
+
+	metrics, err := s.GetMetrics(ctx, []models.MetricKey{{MType: models.Gauge, ID: "cpu"}})
+	require.NoError(t, err)
+	assert.Len(t, metrics[models.MetricKey{MType: models.Gauge, ID: "cpu"}].Aggregates, 1)
+
+	// хранилище отдает общие снимки, агрегаты не должны в них попасть
+	stored, err := mem.GetMetric(ctx, models.Gauge, "cpu")
+	require.NoError(t, err)
+	assert.Nil(t, stored.Aggregates)
+	all, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	for _, m := range all {
+		assert.Nil(t, m.Aggregates)
+	}
+}
+
+func TestStoreWithAggregates_JSON(t *testing.T) {
+	ctx := context.Background()
+	s := NewStoreWithAggregates(storage.NewMemStorage(), aggregate.NewTracker([]time.Duration{time.Minute}))
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.5)}))
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(2))}))
+
+	gauge, err := s.GetMetric(ctx, models.Gauge, "g")
+	require.NoError(t, err)
+	gauge.UpdatedAt = nil
+	data, err := json.Marshal(gauge)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"g","type":"gauge","value":1.5,`+
+		`"aggregates":[{"window":"1m","min":1.5,"max":1.5,"sum":1.5,"count":1,"avg":1.5,"last":1.5}]}`, string(data))
+
+	counter, err := s.GetMetric(ctx, models.Counter, "c")
+	require.NoError(t, err)
+	counter.UpdatedAt = nil
+	data, err = json.Marshal(counter)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"c","type":"counter","delta":2}`, string(data))
+}
+
+func TestStoreWithAggregates_DeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	tracker := aggregate.NewTracker([]time.Duration{time.Minute})
+	s := NewStoreWithAggregates(storage.NewMemStorage(), tracker)
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.5)}))
+
+	deleted, err := s.DeleteExpired(ctx, []models.Expiration{
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "g"}, Before: time.Now().Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Empty(t, tracker.Aggregates("g"))
+}
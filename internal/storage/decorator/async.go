@@ -2,6 +2,8 @@ package decorator
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"time"
 
 	"go.uber.org/zap"
@@ -9,25 +11,33 @@ import (
 	"github.com/ValentinaKh/go-metrics/internal/fileworker"
 	"github.com/ValentinaKh/go-metrics/internal/logger"
 	models "github.com/ValentinaKh/go-metrics/internal/model"
-	"github.com/ValentinaKh/go-metrics/internal/storage"
+	"github.com/ValentinaKh/go-metrics/internal/service"
 )
 
 // StoreWithAsyncFile is a decorator for storage.MemStorage that writes metrics to a file asynchronously.
 type StoreWithAsyncFile struct {
-	*storage.MemStorage
+	service.Storage
 	writer   fileworker.Writer
 	interval time.Duration
 }
 
+// checkpointer - хранилище, которому нужно знать об успешной записи снимка (например, StoreWithWAL)
+type checkpointer interface {
+	Checkpoint(ctx context.Context, write func(snapshot []models.Metrics) error) error
+}
+
 const errorMsg = "Error when writing data on a file"
 
-func NewStoreWithAsyncFile(notifyCtx context.Context, storage *storage.MemStorage,
+func NewStoreWithAsyncFile(notifyCtx context.Context, storage service.Storage,
 	interval time.Duration, writer fileworker.Writer) (*StoreWithAsyncFile, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("store interval must be positive, got %s; use NewStoreWithSyncFile", interval)
+	}
 
 	s := &StoreWithAsyncFile{
-		MemStorage: storage,
-		writer:     writer,
-		interval:   interval,
+		Storage:  storage,
+		writer:   writer,
+		interval: interval,
 	}
 	go s.StartFlush(notifyCtx)
 	return s, nil
@@ -41,6 +51,11 @@ func (s *StoreWithAsyncFile) StartFlush(notifyCtx context.Context) {
 		if err != nil {
 			logger.Log.Error(err.Error())
 		}
+		if c, ok := s.Storage.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				logger.Log.Error(err.Error())
+			}
+		}
 	}()
 
 	for {
@@ -63,6 +78,13 @@ func (s *StoreWithAsyncFile) StartFlush(notifyCtx context.Context) {
 }
 
 func (s *StoreWithAsyncFile) flushToFile() error {
+	if c, ok := s.Storage.(checkpointer); ok {
+		// пустой снимок тоже записывается: журнал очищается, и без снимка удаления были бы потеряны
+		return c.Checkpoint(context.TODO(), func(snapshot []models.Metrics) error {
+			return s.writer.Write(snapshot)
+		})
+	}
+
 	metrics, err := s.GetAllMetrics(context.TODO())
 	if err != nil {
 		return err
@@ -72,10 +94,6 @@ func (s *StoreWithAsyncFile) flushToFile() error {
 	for k := range metrics {
 		tmp = append(tmp, metrics[k])
 	}
-	if len(tmp) > 0 {
-		if err := s.writer.Write(tmp); err != nil {
-			return err
-		}
-	}
-	return nil
+	// пустой снимок тоже записывается, иначе после удаления последней метрики в файле остался бы старый
+	return s.writer.Write(tmp)
 }
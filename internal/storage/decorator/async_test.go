@@ -0,0 +1,104 @@
+package decorator
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+// jsonWriter кодирует снимок, как настоящий файл, и запоминает последний
+type jsonWriter struct {
+	mu     sync.Mutex
+	last   []byte
+	writes int
+}
+
+func (w *jsonWriter) Write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = data
+	w.writes++
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	return nil
+}
+
+func TestNewStoreWithAsyncFile_InvalidInterval(t *testing.T) {
+	_, err := NewStoreWithAsyncFile(context.Background(), storage.NewMemStorage(), 0, &jsonWriter{})
+	assert.Error(t, err)
+}
+
+// TestStoreWithAsyncFile_ConcurrentUpdateAndFlush рассчитан на запуск с -race: сброс в файл кодирует
+// метрики, пока обработчики их обновляют
+func TestStoreWithAsyncFile_ConcurrentUpdateAndFlush(t *testing.T) {
+	w := &jsonWriter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := NewStoreWithAsyncFile(ctx, storage.NewMemStorage(), time.Millisecond, w)
+	require.NoError(t, err)
+
+	const writers, perWriter = 4, 300
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				assert.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{
+					{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))},
+					{ID: "g", MType: models.Gauge, Value: toPtr(float64(j))},
+				}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	cancel()
+	require.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		var snapshot []models.Metrics
+		if w.last == nil || json.Unmarshal(w.last, &snapshot) != nil {
+			return false
+		}
+		for _, m := range snapshot {
+			if m.ID == "c" {
+				return *m.Delta == writers*perWriter
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStoreWithAsyncFile_WritesEmptySnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &jsonWriter{}
+	s, err := NewStoreWithAsyncFile(ctx, storage.NewMemStorage(), time.Hour, w)
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.0)}))
+	require.NoError(t, s.flushToFile())
+
+	_, err = s.DeleteExpired(context.Background(), []models.Expiration{
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "g"}, Before: time.Now().Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.flushToFile())
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	assert.JSONEq(t, `[]`, string(w.last))
+}
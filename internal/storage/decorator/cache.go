@@ -0,0 +1,400 @@
+package decorator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+)
+
+// Invalidator сообщает другим серверам с общей базой о метриках, измененных этим сервером
+type Invalidator interface {
+	Publish(ctx context.Context, keys []models.MetricKey) error
+}
+
+// StoreWithCache хранит в памяти текущие значения метрик из хранилища в базе. Записи идут в базу
+// параллельно и после успешного ответа применяются к кэшу так же, как их применяет база; если запись
+// метрики пересеклась с другой записью той же метрики, порядок в базе неизвестен, и метрика удаляется
+// из кэша. Чтения отдаются из кэша, а промахи читаются из базы и кэшируются.
+//
+// После Warm кэш полный: метрики, которой нет в кэше, нет и в базе. Метрики, измененные другими
+// серверами (Invalidate), удаляются из кэша и перечитываются из базы при следующем обращении, Reset
+// сбрасывает кэш целиком.
+//
+// Метрики, возвращаемые из кэша, - общие неизменяемые снимки, вызывающий не должен их изменять.
+type StoreWithCache struct {
+	service.Storage
+	invalidator Invalidator
+	now         func() time.Time
+
+	mu      sync.RWMutex
+	metrics map[models.MetricKey]*models.Metrics
+	// complete - в кэше все метрики базы, кроме stale
+	complete bool
+	// stale - метрики полного кэша, измененные другими серверами и еще не перечитанные
+	stale map[models.MetricKey]struct{}
+	// writing - метрики, запись которых начата и еще не применена к кэшу
+	writing map[models.MetricKey]*inflight
+	// fills - идущие чтения из базы
+	fills map[*fill]struct{}
+}
+
+// inflight - начатые записи метрики
+type inflight struct {
+	count int
+	// conflict - записи пересеклись, их порядок в базе неизвестен
+	conflict bool
+}
+
+// fill - чтение из базы для заполнения кэша. Метрики, которые за время чтения менялись, не кэшируются:
+// прочитанное значение может не включать изменение или, наоборот, включать запись, которая еще будет
+// применена к кэшу.
+type fill struct {
+	changed map[models.MetricKey]struct{}
+	// reset - за время чтения кэш сброшен, прочитанное не кэшируется
+	reset bool
+}
+
+func NewStoreWithCache(storage service.Storage) *StoreWithCache {
+	return &StoreWithCache{
+		Storage: storage,
+		now:     time.Now,
+		metrics: make(map[models.MetricKey]*models.Metrics),
+		stale:   make(map[models.MetricKey]struct{}),
+		writing: make(map[models.MetricKey]*inflight),
+		fills:   make(map[*fill]struct{}),
+	}
+}
+
+// WithInvalidator включает рассылку ключей измененных метрик другим серверам
+func (s *StoreWithCache) WithInvalidator(i Invalidator) *StoreWithCache {
+	s.invalidator = i
+	return s
+}
+
+// Warm загружает в кэш все метрики
+func (s *StoreWithCache) Warm(ctx context.Context) error {
+	_, err := s.load(ctx, nil)
+	return err
+}
+
+func (s *StoreWithCache) UpdateMetric(ctx context.Context, value models.Metrics) error {
+	return s.update(ctx, []models.Metrics{value}, func(ctx context.Context) error {
+		return s.Storage.UpdateMetric(ctx, value)
+	})
+}
+
+func (s *StoreWithCache) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return s.update(ctx, values, func(ctx context.Context) error {
+		return s.Storage.UpdateMetrics(ctx, values)
+	})
+}
+
+func (s *StoreWithCache) update(ctx context.Context, values []models.Metrics, write func(ctx context.Context) error) error {
+	keys := make([]models.MetricKey, 0, len(values))
+	seen := make(map[models.MetricKey]struct{}, len(values))
+	for _, v := range values {
+		if _, ok := seen[v.Key()]; !ok {
+			seen[v.Key()] = struct{}{}
+			keys = append(keys, v.Key())
+		}
+	}
+
+	s.begin(keys)
+	err := write(ctx)
+	if err != nil {
+		// запись могла дойти до базы, поэтому значения перечитываются
+		s.Invalidate(keys...)
+	} else {
+		s.apply(values)
+	}
+	s.end(keys)
+
+	s.publish(ctx, keys)
+	return err
+}
+
+// begin отмечает метрики, запись которых начинается
+func (s *StoreWithCache) begin(keys []models.MetricKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		w, ok := s.writing[key]
+		if !ok {
+			w = &inflight{}
+			s.writing[key] = w
+		}
+		w.count++
+		w.conflict = w.conflict || w.count > 1
+	}
+	s.changed(keys)
+}
+
+// end снимает отметку begin после применения записи к кэшу
+func (s *StoreWithCache) end(keys []models.MetricKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if w := s.writing[key]; w != nil {
+			if w.count--; w.count <= 0 {
+				delete(s.writing, key)
+			}
+		}
+	}
+}
+
+// changed сообщает идущим чтениям из базы об измененных метриках. Вызывается под mu.
+func (s *StoreWithCache) changed(keys []models.MetricKey) {
+	for f := range s.fills {
+		for _, key := range keys {
+			f.changed[key] = struct{}{}
+		}
+	}
+}
+
+// apply применяет записанные в базу метрики к кэшу: delta прибавляется, value заменяет сохраненное.
+// Метрики, значение которых в базе неизвестно, пропускаются, пересекшиеся записи инвалидируются.
+func (s *StoreWithCache) apply(values []models.Metrics) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range values {
+		key := v.Key()
+		if s.conflicted(key) {
+			s.invalidate(key)
+			continue
+		}
+		cur, ok := s.metrics[key]
+		if !ok && !s.absent(key) {
+			continue
+		}
+		next := &models.Metrics{ID: v.ID, MType: v.MType, UpdatedAt: &now}
+		if ok {
+			next.Delta, next.Value = cur.Delta, cur.Value
+		}
+		if v.Delta != nil {
+			delta := *v.Delta
+			if next.Delta != nil {
+				delta += *next.Delta
+			}
+			next.Delta = &delta
+		}
+		if v.Value != nil {
+			value := *v.Value
+			next.Value = &value
+		}
+		s.metrics[key] = next
+	}
+}
+
+// conflicted - запись метрики пересеклась с другой. Вызывается под mu.
+func (s *StoreWithCache) conflicted(key models.MetricKey) bool {
+	w := s.writing[key]
+	return w != nil && w.conflict
+}
+
+// absent - метрики точно нет в базе. Вызывается под mu.
+func (s *StoreWithCache) absent(key models.MetricKey) bool {
+	if !s.complete {
+		return false
+	}
+	_, ok := s.stale[key]
+	return !ok
+}
+
+func (s *StoreWithCache) GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error) {
+	s.mu.RLock()
+	complete := s.complete
+	stale := make([]models.MetricKey, 0, len(s.stale))
+	for key := range s.stale {
+		stale = append(stale, key)
+	}
+	s.mu.RUnlock()
+
+	if !complete {
+		return s.load(ctx, nil)
+	}
+	var loaded map[models.MetricKey]*models.Metrics
+	if len(stale) > 0 {
+		var err error
+		if loaded, err = s.load(ctx, stale); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.RLock()
+	result := make(map[models.MetricKey]*models.Metrics, len(s.metrics))
+	for key, m := range s.metrics {
+		result[key] = m
+	}
+	s.mu.RUnlock()
+	for key, m := range loaded {
+		result[key] = m
+	}
+	return result, nil
+}
+
+func (s *StoreWithCache) GetMetric(ctx context.Context, mType, id string) (*models.Metrics, error) {
+	key := models.MetricKey{MType: mType, ID: id}
+	metrics, err := s.GetMetrics(ctx, []models.MetricKey{key})
+	if err != nil {
+		return nil, err
+	}
+	return metrics[key], nil
+}
+
+func (s *StoreWithCache) GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	result := make(map[models.MetricKey]*models.Metrics, len(keys))
+	var missing []models.MetricKey
+	s.mu.RLock()
+	for _, key := range keys {
+		if m, ok := s.metrics[key]; ok {
+			result[key] = m
+		} else if !s.absent(key) {
+			missing = append(missing, key)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return result, nil
+	}
+	loaded, err := s.load(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for key, m := range loaded {
+		result[key] = m
+	}
+	return result, nil
+}
+
+// load читает из базы метрики по ключам или, если keys == nil, все метрики и кладет их в кэш.
+// Чтение не задерживает записи; метрики, записанные или инвалидированные за время чтения, не кэшируются.
+func (s *StoreWithCache) load(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	f := &fill{changed: make(map[models.MetricKey]struct{})}
+	s.mu.Lock()
+	for key := range s.writing {
+		f.changed[key] = struct{}{}
+	}
+	s.fills[f] = struct{}{}
+	s.mu.Unlock()
+
+	var loaded map[models.MetricKey]*models.Metrics
+	var err error
+	if keys == nil {
+		loaded, err = s.Storage.GetAllMetrics(ctx)
+	} else {
+		loaded, err = s.Storage.GetMetrics(ctx, keys)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.fills, f)
+	if err != nil {
+		return nil, err
+	}
+	if f.reset {
+		// пока шло чтение, другой сервер изменил неизвестные метрики: прочитанное может быть устаревшим
+		return loaded, nil
+	}
+	if keys == nil {
+		s.metrics = make(map[models.MetricKey]*models.Metrics, len(loaded))
+		// измененные за время чтения метрики перечитываются при следующем обращении
+		s.stale = f.changed
+		s.complete = true
+	}
+	for _, key := range keys {
+		if _, ok := f.changed[key]; !ok {
+			delete(s.stale, key)
+		}
+	}
+	for key, m := range loaded {
+		if _, ok := f.changed[key]; !ok {
+			s.metrics[key] = m
+		}
+	}
+	return loaded, nil
+}
+
+// DeleteExpired удаляет устаревшие метрики из базы и из кэша
+func (s *StoreWithCache) DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error) {
+	candidates := make([]models.MetricKey, 0, len(expired))
+	for _, e := range expired {
+		candidates = append(candidates, e.MetricKey)
+	}
+
+	s.begin(candidates)
+	deleted, err := s.Storage.DeleteExpired(ctx, expired)
+	keys := candidates
+	if err != nil {
+		s.Invalidate(keys...)
+	} else {
+		keys = make([]models.MetricKey, 0, len(deleted))
+		for _, m := range deleted {
+			keys = append(keys, m.Key())
+		}
+		s.mu.Lock()
+		for _, key := range keys {
+			if s.conflicted(key) {
+				s.invalidate(key)
+			} else {
+				delete(s.metrics, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+	s.end(candidates)
+
+	s.publish(ctx, keys)
+	return deleted, err
+}
+
+// Invalidate удаляет метрики из кэша, следующее обращение перечитает их из базы
+func (s *StoreWithCache) Invalidate(keys ...models.MetricKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.invalidate(key)
+	}
+	s.changed(keys)
+}
+
+// invalidate удаляет метрику из кэша. Вызывается под mu.
+func (s *StoreWithCache) invalidate(key models.MetricKey) {
+	delete(s.metrics, key)
+	if s.complete {
+		s.stale[key] = struct{}{}
+	}
+}
+
+// Reset сбрасывает кэш целиком
+func (s *StoreWithCache) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = make(map[models.MetricKey]*models.Metrics)
+	s.stale = make(map[models.MetricKey]struct{})
+	s.complete = false
+	for f := range s.fills {
+		f.reset = true
+	}
+}
+
+// publish сообщает другим серверам об измененных метриках. Ошибка не возвращается: запись уже применена,
+// а кэши других серверов останутся устаревшими до их перезапуска или следующего изменения этих метрик.
+func (s *StoreWithCache) publish(ctx context.Context, keys []models.MetricKey) {
+	if s.invalidator == nil || len(keys) == 0 {
+		return
+	}
+	if err := s.invalidator.Publish(ctx, keys); err != nil {
+		logger.Log.Warn("Cache invalidation is not published", zap.Int("metrics", len(keys)), zap.Error(err))
+	}
+}
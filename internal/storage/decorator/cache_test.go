@@ -0,0 +1,371 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+// countingStorage считает чтения из хранилища и может вернуть ошибку записи
+type countingStorage struct {
+	service.Storage
+	mu       sync.Mutex
+	reads    int
+	writeErr error
+}
+
+func (s *countingStorage) read() {
+	s.mu.Lock()
+	s.reads++
+	s.mu.Unlock()
+}
+
+func (s *countingStorage) readCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
+
+func (s *countingStorage) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	if err := s.Storage.UpdateMetrics(ctx, values); err != nil {
+		return err
+	}
+	return s.writeErr
+}
+
+func (s *countingStorage) GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error) {
+	s.read()
+	return s.Storage.GetAllMetrics(ctx)
+}
+
+func (s *countingStorage) GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	s.read()
+	return s.Storage.GetMetrics(ctx, keys)
+}
+
+type recordingInvalidator struct {
+	published [][]models.MetricKey
+}
+
+func (i *recordingInvalidator) Publish(_ context.Context, keys []models.MetricKey) error {
+	i.published = append(i.published, keys)
+	return nil
+}
+
+func newCountingStorage(t *testing.T, initial ...models.Metrics) *countingStorage {
+	t.Helper()
+	mem := storage.NewMemStorage()
+	require.NoError(t, mem.UpdateMetrics(context.Background(), initial))
+	return &countingStorage{Storage: mem}
+}
+
+func TestStoreWithCache_ReadsFromCacheAfterWarm(t *testing.T) {
+	ctx := context.Background()
+	db := newCountingStorage(t,
+		models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))},
+		models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.5)},
+	)
+	s := NewStoreWithCache(db)
+	require.NoError(t, s.Warm(ctx))
+
+	require.NoError(t, s.UpdateMetrics(ctx, []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(2))},
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(3))},
+		{ID: "g", MType: models.Gauge, Value: toPtr(2.5)},
+		{ID: "new", MType: models.Gauge, Value: toPtr(7.0)},
+	}))
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}))
+
+	counter, err := s.GetMetric(ctx, models.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), *counter.Delta)
+	missing, err := s.GetMetric(ctx, models.Gauge, "c")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	all, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	want, err := db.Storage.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, values(want), values(all))
+	assert.Equal(t, 1, db.readCount(), "only the warm-up reads the database")
+}
+
+func TestStoreWithCache_ReadThrough(t *testing.T) {
+	ctx := context.Background()
+	db := newCountingStorage(t, models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))})
+	s := NewStoreWithCache(db)
+
+	// без прогрева значение счетчика неизвестно: запись не кэшируется, чтение идет в базу
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}))
+	for i := 0; i < 2; i++ {
+		m, err := s.GetMetric(ctx, models.Counter, "c")
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), *m.Delta)
+	}
+	assert.Equal(t, 1, db.readCount())
+
+	// неизвестная метрика без полного кэша каждый раз ищется в базе
+	for i := 0; i < 2; i++ {
+		m, err := s.GetMetric(ctx, models.Gauge, "unknown")
+		require.NoError(t, err)
+		assert.Nil(t, m)
+	}
+	assert.Equal(t, 3, db.readCount())
+
+	_, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	_, err = s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, db.readCount())
+}
+
+func TestStoreWithCache_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	db := newCountingStorage(t,
+		models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))},
+		models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.5)},
+	)
+	s := NewStoreWithCache(db)
+	require.NoError(t, s.Warm(ctx))
+
+	// другой сервер изменил счетчик и создал новую метрику
+	require.NoError(t, db.Storage.UpdateMetrics(ctx, []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(10))},
+		{ID: "other", MType: models.Gauge, Value: toPtr(3.0)},
+	}))
+	s.Invalidate(models.MetricKey{MType: models.Counter, ID: "c"}, models.MetricKey{MType: models.Gauge, ID: "other"})
+
+	all, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[models.MetricKey]float64{
+		{MType: models.Counter, ID: "c"}:   15,
+		{MType: models.Gauge, ID: "g"}:     1.5,
+		{MType: models.Gauge, ID: "other"}: 3,
+	}, values(all))
+
+	// перечитанные метрики снова отдаются из кэша
+	reads := db.readCount()
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}))
+	m, err := s.GetMetric(ctx, models.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), *m.Delta)
+	assert.Equal(t, reads, db.readCount())
+
+	s.Reset()
+	_, err = s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, reads+1, db.readCount())
+}
+
+func TestStoreWithCache_WriteError(t *testing.T) {
+	ctx := context.Background()
+	db := newCountingStorage(t, models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))})
+	s := NewStoreWithCache(db)
+	require.NoError(t, s.Warm(ctx))
+
+	// ошибка после записи: значение в базе изменилось, кэш должен его перечитать
+	db.writeErr = errors.New("connection reset")
+	assert.Error(t, s.UpdateMetrics(ctx, []models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}}))
+	m, err := s.GetMetric(ctx, models.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *m.Delta)
+}
+
+func TestStoreWithCache_DeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	db := newCountingStorage(t,
+		models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))},
+		models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.5)},
+	)
+	invalidator := &recordingInvalidator{}
+	s := NewStoreWithCache(db).WithInvalidator(invalidator)
+	require.NoError(t, s.Warm(ctx))
+
+	deleted, err := s.DeleteExpired(ctx, []models.Expiration{
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "g"}, Before: time.Now().Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+
+	m, err := s.GetMetric(ctx, models.Gauge, "g")
+	require.NoError(t, err)
+	assert.Nil(t, m)
+	assert.Equal(t, [][]models.MetricKey{{{MType: models.Gauge, ID: "g"}}}, invalidator.published)
+}
+
+func TestStoreWithCache_PublishesWrittenKeys(t *testing.T) {
+	ctx := context.Background()
+	invalidator := &recordingInvalidator{}
+	s := NewStoreWithCache(newCountingStorage(t)).WithInvalidator(invalidator)
+
+	require.NoError(t, s.UpdateMetrics(ctx, []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(2))},
+		{ID: "c", MType: models.Gauge, Value: toPtr(1.0)},
+	}))
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.0)}))
+
+	assert.Equal(t, [][]models.MetricKey{
+		{{MType: models.Counter, ID: "c"}, {MType: models.Gauge, ID: "c"}},
+		{{MType: models.Gauge, ID: "g"}},
+	}, invalidator.published)
+}
+
+// TestStoreWithCache_ConcurrentGauges проверяет, что после конкурентных записей кэш совпадает с базой
+func TestStoreWithCache_ConcurrentGauges(t *testing.T) {
+	ctx := context.Background()
+	db := newCountingStorage(t)
+	s := NewStoreWithCache(db)
+	require.NoError(t, s.Warm(ctx))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				assert.NoError(t, s.UpdateMetrics(ctx, []models.Metrics{
+					{ID: "g", MType: models.Gauge, Value: toPtr(float64(i*100 + j))},
+					{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))},
+				}))
+				if j%10 == 0 {
+					s.Invalidate(models.MetricKey{MType: models.Gauge, ID: "g"})
+				}
+				_, err := s.GetAllMetrics(ctx)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cached, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	want, err := db.Storage.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, values(want), values(cached))
+	assert.Equal(t, 1000.0, values(cached)[models.MetricKey{MType: models.Counter, ID: "c"}])
+}
+
+// slowStorage после чтения метрик из базы ждет release, сообщив о прочитанном в read
+type slowStorage struct {
+	service.Storage
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStorage) GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	metrics, err := s.Storage.GetMetrics(ctx, keys)
+	s.read <- struct{}{}
+	<-s.release
+	return metrics, err
+}
+
+// TestStoreWithCache_WriteDuringLoad проверяет, что чтение из базы не задерживает записи, а значение,
+// устаревшее за время чтения, не попадает в кэш
+func TestStoreWithCache_WriteDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemStorage()
+	require.NoError(t, mem.UpdateMetric(ctx, models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))}))
+	db := &slowStorage{Storage: mem, read: make(chan struct{}), release: make(chan struct{})}
+	s := NewStoreWithCache(db)
+
+	loaded := make(chan *models.Metrics)
+	go func() {
+		m, err := s.GetMetric(ctx, models.Counter, "c")
+		assert.NoError(t, err)
+		loaded <- m
+	}()
+	<-db.read
+
+	written := make(chan error)
+	go func() {
+		written <- s.UpdateMetric(ctx, models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))})
+	}()
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write waits for the database read")
+	}
+	close(db.release)
+	assert.Equal(t, int64(5), *(<-loaded).Delta)
+
+	go func() {
+		for range db.read {
+		}
+	}()
+	defer close(db.read)
+	m, err := s.GetMetric(ctx, models.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *m.Delta)
+}
+
+func values(metrics map[models.MetricKey]*models.Metrics) map[models.MetricKey]float64 {
+	result := make(map[models.MetricKey]float64, len(metrics))
+	for k, m := range metrics {
+		if m.Delta != nil {
+			result[k] = float64(*m.Delta)
+		} else {
+			result[k] = *m.Value
+		}
+	}
+	return result
+}
+
+// blockingWriteStorage задерживает запись метрики blocked до release
+type blockingWriteStorage struct {
+	service.Storage
+	blocked models.MetricKey
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingWriteStorage) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	if values[0].Key() == s.blocked {
+		s.started <- struct{}{}
+		<-s.release
+	}
+	return s.Storage.UpdateMetrics(ctx, values)
+}
+
+// TestStoreWithCache_ParallelWrites проверяет, что записи идут в базу параллельно, а пересекшиеся записи
+// одной метрики перечитываются из базы
+func TestStoreWithCache_ParallelWrites(t *testing.T) {
+	ctx := context.Background()
+	slow := models.MetricKey{MType: models.Gauge, ID: "slow"}
+	db := &blockingWriteStorage{Storage: storage.NewMemStorage(), blocked: slow,
+		started: make(chan struct{}), release: make(chan struct{})}
+	s := NewStoreWithCache(db)
+	require.NoError(t, s.Warm(ctx))
+
+	done := make(chan error)
+	go func() {
+		done <- s.UpdateMetrics(ctx, []models.Metrics{{ID: "slow", MType: models.Gauge, Value: toPtr(1.0)}})
+	}()
+	<-db.started
+
+	// запись другой метрики не ждет медленную
+	require.NoError(t, s.UpdateMetrics(ctx, []models.Metrics{{ID: "fast", MType: models.Gauge, Value: toPtr(2.0)}}))
+	// запись той же метрики доходит до базы раньше: в базе останется значение медленной записи
+	db.blocked = models.MetricKey{}
+	require.NoError(t, s.UpdateMetrics(ctx, []models.Metrics{{ID: "slow", MType: models.Gauge, Value: toPtr(3.0)}}))
+	close(db.release)
+	require.NoError(t, <-done)
+
+	cached, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	want, err := db.Storage.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, values(want), values(cached))
+	assert.Equal(t, 1.0, values(cached)[slow])
+}
@@ -0,0 +1,45 @@
+package decorator
+
+import (
+	"context"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+)
+
+// Replicator пересылает изменения хранилища на другие серверы
+type Replicator interface {
+	// Replicate применяет пакет через apply и, если он применен, ставит его в очередь на пересылку
+	Replicate(ctx context.Context, metrics []models.Metrics, apply func(ctx context.Context, metrics []models.Metrics) error) error
+	// ReplicateDeleted удаляет метрики через del и ставит ключи удаленных в очередь на пересылку
+	ReplicateDeleted(ctx context.Context, expired []models.Expiration,
+		del func(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error)) ([]models.Metrics, error)
+}
+
+// StoreWithReplication пересылает на реплики все записи и удаления, прошедшие через хранилище: пакеты
+// сервиса, приемников StatsD и Graphite и удаления устаревших метрик.
+type StoreWithReplication struct {
+	service.Storage
+	replicator Replicator
+}
+
+func NewStoreWithReplication(storage service.Storage, replicator Replicator) *StoreWithReplication {
+	return &StoreWithReplication{Storage: storage, replicator: replicator}
+}
+
+func (s *StoreWithReplication) UpdateMetric(ctx context.Context, value models.Metrics) error {
+	return s.replicator.Replicate(ctx, []models.Metrics{value}, func(ctx context.Context, metrics []models.Metrics) error {
+		return s.Storage.UpdateMetric(ctx, metrics[0])
+	})
+}
+
+func (s *StoreWithReplication) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return s.replicator.Replicate(ctx, values, s.Storage.UpdateMetrics)
+}
+
+func (s *StoreWithReplication) DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error) {
+	return s.replicator.ReplicateDeleted(ctx, expired, s.Storage.DeleteExpired)
+}
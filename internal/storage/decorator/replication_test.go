@@ -0,0 +1,63 @@
+package decorator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+// recordingReplicator применяет изменения и запоминает пересланные
+type recordingReplicator struct {
+	forwarded [][]models.Metrics
+	deleted   [][]models.Metrics
+}
+
+func (r *recordingReplicator) Replicate(ctx context.Context, metrics []models.Metrics,
+	apply func(ctx context.Context, metrics []models.Metrics) error) error {
+	if err := apply(ctx, metrics); err != nil {
+		return err
+	}
+	r.forwarded = append(r.forwarded, metrics)
+	return nil
+}
+
+func (r *recordingReplicator) ReplicateDeleted(ctx context.Context, expired []models.Expiration,
+	del func(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error)) ([]models.Metrics, error) {
+	deleted, err := del(ctx, expired)
+	if err == nil && len(deleted) > 0 {
+		r.deleted = append(r.deleted, deleted)
+	}
+	return deleted, err
+}
+
+func TestStoreWithReplication(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemStorage()
+	replicator := &recordingReplicator{}
+	s := NewStoreWithReplication(mem, replicator)
+
+	single := models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.5)}
+	batch := []models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(2))}}
+	require.NoError(t, s.UpdateMetric(ctx, single))
+	require.NoError(t, s.UpdateMetrics(ctx, batch))
+	require.NoError(t, s.UpdateMetrics(ctx, nil))
+	assert.Equal(t, [][]models.Metrics{{single}, batch}, replicator.forwarded)
+
+	deleted, err := s.DeleteExpired(ctx, []models.Expiration{
+		{MetricKey: single.Key(), Before: time.Now().Add(time.Minute)},
+	})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.Len(t, replicator.deleted, 1)
+	assert.Equal(t, single.Key(), replicator.deleted[0][0].Key())
+
+	all, err := mem.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
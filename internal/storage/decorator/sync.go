@@ -0,0 +1,173 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	"github.com/ValentinaKh/go-metrics/internal/logger"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+var errStoreClosed = errors.New("file store is closed")
+
+// StoreWithSyncFile is a decorator for storage.MemStorage that durably writes metrics to a file
+// before UpdateMetric/UpdateMetrics return (STORE_INTERVAL=0).
+//
+// Запись группируется (group commit): одна горутина-лидер пишет снимок хранилища и делает fsync,
+// а остальные, чьи изменения уже попали в этот снимок, просто дожидаются его завершения.
+// При ошибке записи изменение остается в памяти, но вызывающий получает ошибку.
+// Хранилище не встраивается: наружу доступны только изменения, дожидающиеся записи на диск, и чтение.
+type StoreWithSyncFile struct {
+	mem    *storage.MemStorage
+	writer fileworker.SyncWriter
+
+	// applyMu упорядочивает изменения памяти и снятие снимка, чтобы номер снимка покрывал
+	// ровно те изменения, что в него вошли
+	applyMu sync.Mutex
+	applied uint64
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	durable  uint64
+	flushing bool
+	closed   bool
+}
+
+func NewStoreWithSyncFile(notifyCtx context.Context, storage *storage.MemStorage, writer fileworker.SyncWriter) *StoreWithSyncFile {
+	s := &StoreWithSyncFile{
+		mem:    storage,
+		writer: writer,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go func() {
+		<-notifyCtx.Done()
+		s.close()
+	}()
+	return s
+}
+
+func (s *StoreWithSyncFile) UpdateMetric(ctx context.Context, value models.Metrics) error {
+	s.applyMu.Lock()
+	if err := s.mem.UpdateMetric(ctx, value); err != nil {
+		s.applyMu.Unlock()
+		return err
+	}
+	s.applied++
+	seq := s.applied
+	s.applyMu.Unlock()
+
+	return s.waitDurable(seq)
+}
+
+func (s *StoreWithSyncFile) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	s.applyMu.Lock()
+	if err := s.mem.UpdateMetrics(ctx, values); err != nil {
+		s.applyMu.Unlock()
+		return err
+	}
+	s.applied++
+	seq := s.applied
+	s.applyMu.Unlock()
+
+	return s.waitDurable(seq)
+}
+
+// DeleteExpired удаляет устаревшие метрики и дожидается записи снимка без них
+func (s *StoreWithSyncFile) DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error) {
+	s.applyMu.Lock()
+	deleted, err := s.mem.DeleteExpired(ctx, expired)
+	if err != nil || len(deleted) == 0 {
+		s.applyMu.Unlock()
+		return deleted, err
+	}
+	s.applied++
+	seq := s.applied
+	s.applyMu.Unlock()
+
+	return deleted, s.waitDurable(seq)
+}
+
+func (s *StoreWithSyncFile) GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error) {
+	return s.mem.GetAllMetrics(ctx)
+}
+
+func (s *StoreWithSyncFile) GetMetric(ctx context.Context, mType, id string) (*models.Metrics, error) {
+	return s.mem.GetMetric(ctx, mType, id)
+}
+
+func (s *StoreWithSyncFile) GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	return s.mem.GetMetrics(ctx, keys)
+}
+
+// waitDurable ждет, пока изменение с номером seq окажется на диске. Если запись никто не выполняет,
+// горутина сама становится лидером и пишет снимок, покрывающий все примененные к этому моменту изменения.
+func (s *StoreWithSyncFile) waitDurable(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.durable < seq {
+		if s.closed {
+			return errStoreClosed
+		}
+		if s.flushing {
+			s.cond.Wait()
+			continue
+		}
+
+		s.flushing = true
+		s.mu.Unlock()
+		upTo, err := s.flush()
+		s.mu.Lock()
+		s.flushing = false
+		if err == nil && upTo > s.durable {
+			s.durable = upTo
+		}
+		s.cond.Broadcast()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StoreWithSyncFile) flush() (uint64, error) {
+	s.applyMu.Lock()
+	metrics, err := s.mem.GetAllMetrics(context.TODO())
+	upTo := s.applied
+	snapshot := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		snapshot = append(snapshot, *m)
+	}
+	s.applyMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.writer.Write(snapshot); err != nil {
+		return 0, err
+	}
+	if err := s.writer.Sync(); err != nil {
+		return 0, err
+	}
+	return upTo, nil
+}
+
+// close дожидается текущей записи и закрывает файл. Последующие изменения завершаются ошибкой.
+func (s *StoreWithSyncFile) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.flushing {
+		s.cond.Wait()
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	if err := s.writer.Close(); err != nil {
+		logger.Log.Error("Error closing file store", zap.Error(err))
+		return
+	}
+	logger.Log.Info("SyncFileStore stopped")
+}
@@ -0,0 +1,186 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+func toPtr[T int64 | float64](value T) *T {
+	return &value
+}
+
+// fakeWriter запоминает снимки и считает вызовы fsync
+type fakeWriter struct {
+	mu        sync.Mutex
+	delay     time.Duration
+	err       error
+	snapshots [][]models.Metrics
+	syncs     int
+	closed    bool
+}
+
+// withoutUpdatedAt возвращает копии метрик без времени обновления, чтобы сравнивать только значения
+func withoutUpdatedAt(metrics []models.Metrics) []models.Metrics {
+	res := make([]models.Metrics, len(metrics))
+	for i, m := range metrics {
+		m.UpdatedAt = nil
+		res[i] = m
+	}
+	return res
+}
+
+func (w *fakeWriter) Write(v any) error {
+	time.Sleep(w.delay)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.snapshots = append(w.snapshots, v.([]models.Metrics))
+	return nil
+}
+
+func (w *fakeWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.syncs++
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *fakeWriter) stats() (int, int, []models.Metrics) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var last []models.Metrics
+	if len(w.snapshots) > 0 {
+		last = w.snapshots[len(w.snapshots)-1]
+	}
+	return len(w.snapshots), w.syncs, last
+}
+
+func TestStoreWithSyncFile_PersistsBeforeReturn(t *testing.T) {
+	w := &fakeWriter{}
+	s := NewStoreWithSyncFile(context.Background(), storage.NewMemStorage(), w)
+
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "a", MType: models.Gauge, Value: toPtr(1.0)}))
+	writes, syncs, last := w.stats()
+	assert.Equal(t, 1, writes)
+	assert.Equal(t, 1, syncs)
+	assert.Equal(t, []models.Metrics{{ID: "a", MType: models.Gauge, Value: toPtr(1.0)}}, withoutUpdatedAt(last))
+
+	require.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{{ID: "b", MType: models.Counter, Delta: toPtr(int64(2))}}))
+	writes, syncs, last = w.stats()
+	assert.Equal(t, 2, writes)
+	assert.Equal(t, 2, syncs)
+	assert.Len(t, last, 2)
+}
+
+func TestStoreWithSyncFile_GroupCommit(t *testing.T) {
+	w := &fakeWriter{delay: 20 * time.Millisecond}
+	s := NewStoreWithSyncFile(context.Background(), storage.NewMemStorage(), w)
+
+	const writers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.UpdateMetric(context.Background(),
+				models.Metrics{ID: fmt.Sprintf("m%d", i), MType: models.Counter, Delta: toPtr(int64(1))}))
+		}()
+	}
+	wg.Wait()
+
+	writes, syncs, last := w.stats()
+	assert.Less(t, writes, writers, "concurrent updates must share fsyncs")
+	assert.Equal(t, writes, syncs)
+	assert.Len(t, last, writers)
+}
+
+func TestStoreWithSyncFile_WriteError(t *testing.T) {
+	w := &fakeWriter{err: errors.New("disk full")}
+	s := NewStoreWithSyncFile(context.Background(), storage.NewMemStorage(), w)
+
+	err := s.UpdateMetric(context.Background(), models.Metrics{ID: "a", MType: models.Gauge, Value: toPtr(1.0)})
+	assert.EqualError(t, err, "disk full")
+}
+
+func TestStoreWithSyncFile_Closed(t *testing.T) {
+	w := &fakeWriter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewStoreWithSyncFile(ctx, storage.NewMemStorage(), w)
+	cancel()
+
+	require.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.closed
+	}, time.Second, 10*time.Millisecond)
+	err := s.UpdateMetric(context.Background(), models.Metrics{ID: "a", MType: models.Gauge, Value: toPtr(1.0)})
+	assert.ErrorIs(t, err, errStoreClosed)
+}
+
+func TestStoreWithSyncFile_RestoreFromFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "metrics.json")
+	writer, err := fileworker.NewFileWriter(file)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewStoreWithSyncFile(ctx, storage.NewMemStorage(), writer)
+
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(3))}))
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(4))}))
+
+	// без остановки: данные уже должны быть на диске
+	_, err = os.Stat(file)
+	require.NoError(t, err)
+	restored := storage.NewMemStorage()
+	require.NoError(t, service.LoadMetrics(file, restored))
+	metrics, err := restored.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *metrics[models.MetricKey{MType: models.Counter, ID: "c"}].Delta)
+	cancel()
+}
+
+func TestStoreWithSyncFile_NoUnsyncedWrites(t *testing.T) {
+	w := &fakeWriter{}
+	s := NewStoreWithSyncFile(context.Background(), storage.NewMemStorage(), w)
+
+	// методы MemStorage, меняющие память без записи снимка, недоступны
+	assert.NotImplements(t, (*interface {
+		Restore(ctx context.Context, values []models.Metrics) error
+	})(nil), s)
+	assert.NotImplements(t, (*interface {
+		Delete(keys ...models.MetricKey)
+	})(nil), s)
+	assert.NotImplements(t, (*interface {
+		GetAndClear() map[models.MetricKey]*models.Metrics
+	})(nil), s)
+
+	// поэтому загрузка метрик в такое хранилище дожидается записи на диск
+	file := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(file, []byte(`[{"id":"g","type":"gauge","value":2.5}]`), 0o600))
+	require.NoError(t, service.LoadMetrics(file, s))
+	_, syncs, last := w.stats()
+	assert.Equal(t, 1, syncs)
+	assert.Equal(t, []models.Metrics{{ID: "g", MType: models.Gauge, Value: toPtr(2.5)}}, withoutUpdatedAt(last))
+}
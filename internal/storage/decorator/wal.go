@@ -0,0 +1,254 @@
+package decorator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+// StoreWithWAL is a decorator for storage.MemStorage that appends every update batch to a write-ahead
+// log before applying it, so updates made between file snapshots survive a crash.
+//
+// В журнал пишутся значения метрик после применения пакета (для счетчика - накопленная сумма), а не
+// приращения. Поэтому повторное воспроизведение записи, уже попавшей в снимок, не удваивает счетчики.
+// Запись обновления - JSON-массив метрик, запись удаления устаревших метрик - объект walDeletion.
+// Хранилище не встраивается: наружу доступны только изменения, попадающие в журнал, и чтение.
+type StoreWithWAL struct {
+	mem *storage.MemStorage
+	wal *fileworker.WAL
+
+	// mu упорядочивает записи журнала и изменения памяти
+	mu sync.Mutex
+}
+
+// walDeletion - запись журнала об удалении метрик
+type walDeletion struct {
+	Deleted []models.MetricKey `json:"deleted"`
+}
+
+func NewStoreWithWAL(storage *storage.MemStorage, wal *fileworker.WAL) *StoreWithWAL {
+	return &StoreWithWAL{
+		mem: storage,
+		wal: wal,
+	}
+}
+
+func (s *StoreWithWAL) UpdateMetric(ctx context.Context, value models.Metrics) error {
+	return s.UpdateMetrics(ctx, []models.Metrics{value})
+}
+
+func (s *StoreWithWAL) UpdateMetrics(ctx context.Context, values []models.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.resultingValues(ctx, values)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := s.wal.Append(payload); err != nil {
+		return err
+	}
+	return s.mem.UpdateMetrics(ctx, values)
+}
+
+func (s *StoreWithWAL) GetAllMetrics(ctx context.Context) (map[models.MetricKey]*models.Metrics, error) {
+	return s.mem.GetAllMetrics(ctx)
+}
+
+func (s *StoreWithWAL) GetMetric(ctx context.Context, mType, id string) (*models.Metrics, error) {
+	return s.mem.GetMetric(ctx, mType, id)
+}
+
+func (s *StoreWithWAL) GetMetrics(ctx context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	return s.mem.GetMetrics(ctx, keys)
+}
+
+// resultingValues вычисляет значения метрик, которые получатся после применения values
+func (s *StoreWithWAL) resultingValues(ctx context.Context, values []models.Metrics) ([]models.Metrics, error) {
+	keys := make([]models.MetricKey, 0, len(values))
+	for _, v := range values {
+		keys = append(keys, v.Key())
+	}
+	current, err := s.mem.GetMetrics(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	result := make([]models.Metrics, 0, len(values))
+	index := make(map[models.MetricKey]int, len(values))
+	for _, v := range values {
+		i, seen := index[v.Key()]
+		var base *models.Metrics
+		if seen {
+			base = &result[i]
+		} else if m, ok := current[v.Key()]; ok {
+			base = m
+		}
+
+		next := models.Metrics{ID: v.ID, MType: v.MType, Hash: v.Hash, UpdatedAt: &now}
+		switch v.MType {
+		case models.Counter:
+			var sum int64
+			if base != nil && base.Delta != nil {
+				sum = *base.Delta
+			}
+			if v.Delta != nil {
+				sum += *v.Delta
+			}
+			next.Delta = &sum
+		case models.Gauge:
+			next.Value = copyPtr(v.Value)
+		}
+
+		if seen {
+			result[i] = next
+		} else {
+			index[v.Key()] = len(result)
+			result = append(result, next)
+		}
+	}
+	return result, nil
+}
+
+// DeleteExpired удаляет устаревшие метрики, предварительно записав удаление в журнал
+func (s *StoreWithWAL) DeleteExpired(ctx context.Context, expired []models.Expiration) ([]models.Metrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]models.MetricKey, 0, len(expired))
+	for _, e := range expired {
+		keys = append(keys, e.MetricKey)
+	}
+	current, err := s.mem.GetMetrics(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	// под s.mu хранилище не меняется, поэтому в журнал попадают ровно те метрики, что будут удалены
+	var deleted []models.Metrics
+	var record walDeletion
+	for _, e := range expired {
+		if m, ok := current[e.MetricKey]; ok && m.UpdatedAt != nil && m.UpdatedAt.Before(e.Before) {
+			deleted = append(deleted, *m)
+			record.Deleted = append(record.Deleted, e.MetricKey)
+		}
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.wal.Append(payload); err != nil {
+		return nil, err
+	}
+	s.mem.Delete(record.Deleted...)
+	return deleted, nil
+}
+
+// Replay восстанавливает в памяти изменения из журнала. Вызывается после загрузки последнего снимка.
+// Возвращает число воспроизведенных записей.
+func (s *StoreWithWAL) Replay(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// для каждой метрики важно только последнее состояние: значение или удаление (nil)
+	latest := make(map[models.MetricKey]*models.Metrics)
+	var order []models.MetricKey
+	set := func(key models.MetricKey, m *models.Metrics) {
+		if _, ok := latest[key]; !ok {
+			order = append(order, key)
+		}
+		latest[key] = m
+	}
+	records := 0
+	err := s.wal.Replay(func(payload []byte) error {
+		records++
+		if len(payload) > 0 && payload[0] == '{' {
+			var record walDeletion
+			if err := json.Unmarshal(payload, &record); err != nil {
+				return fmt.Errorf("decode wal record %d: %w", records, err)
+			}
+			for _, key := range record.Deleted {
+				set(key, nil)
+			}
+			return nil
+		}
+		var batch []models.Metrics
+		if err := json.Unmarshal(payload, &batch); err != nil {
+			return fmt.Errorf("decode wal record %d: %w", records, err)
+		}
+		for i := range batch {
+			set(batch[i].Key(), &batch[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// записи содержат итоговые значения, поэтому они заменяют загруженные из снимка, а не прибавляются к ним
+	var restored []models.Metrics
+	var deleted []models.MetricKey
+	for _, key := range order {
+		if m := latest[key]; m != nil {
+			restored = append(restored, *m)
+		} else {
+			deleted = append(deleted, key)
+		}
+	}
+	s.mem.Delete(deleted...)
+	if err := s.mem.Restore(ctx, restored); err != nil {
+		return 0, err
+	}
+	return records, nil
+}
+
+// Checkpoint передает write копию всех метрик и после ее успешной записи удаляет из журнала
+// вошедшие в нее записи
+func (s *StoreWithWAL) Checkpoint(ctx context.Context, write func(snapshot []models.Metrics) error) error {
+	s.mu.Lock()
+	metrics, err := s.mem.GetAllMetrics(ctx)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	snapshot := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		snapshot = append(snapshot, models.Metrics{
+			ID: m.ID, MType: m.MType, Hash: m.Hash,
+			Delta: copyPtr(m.Delta), Value: copyPtr(m.Value), UpdatedAt: copyPtr(m.UpdatedAt),
+		})
+	}
+	off := s.wal.Size()
+	s.mu.Unlock()
+
+	if err := write(snapshot); err != nil {
+		return err
+	}
+	return s.wal.TruncateFront(off)
+}
+
+// Close закрывает журнал
+func (s *StoreWithWAL) Close() error {
+	return s.wal.Close()
+}
+
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,272 @@
+package decorator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ValentinaKh/go-metrics/internal/fileworker"
+	models "github.com/ValentinaKh/go-metrics/internal/model"
+	"github.com/ValentinaKh/go-metrics/internal/service"
+	"github.com/ValentinaKh/go-metrics/internal/storage"
+)
+
+func openTestWAL(t *testing.T, path string) *fileworker.WAL {
+	t.Helper()
+	wal, err := fileworker.OpenWAL(path, fileworker.WALSyncAlways, 0)
+	require.NoError(t, err)
+	return wal
+}
+
+func TestStoreWithWAL_ReplayAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	s := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(3))}))
+	require.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(4))},
+		{ID: "g", MType: models.Gauge, Value: toPtr(1.5)},
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))},
+	}))
+	// сбой: журнал не закрыт, снимка нет
+
+	restored := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+	defer restored.Close()
+	records, err := restored.Replay(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, records)
+
+	metrics, err := restored.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), *metrics[models.MetricKey{MType: models.Counter, ID: "c"}].Delta)
+	assert.Equal(t, 1.5, *metrics[models.MetricKey{MType: models.Gauge, ID: "g"}].Value)
+}
+
+func TestStoreWithWAL_ReplayOverSnapshotIsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	s := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))}))
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(2))}))
+
+	// снимок записан, но сбой произошел до очистки журнала
+	mem := storage.NewMemStorage()
+	require.NoError(t, mem.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(7))}))
+
+	restored := NewStoreWithWAL(mem, openTestWAL(t, path))
+	defer restored.Close()
+	_, err := restored.Replay(context.Background())
+	require.NoError(t, err)
+
+	metrics, err := restored.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *metrics[models.MetricKey{MType: models.Counter, ID: "c"}].Delta)
+}
+
+func TestStoreWithWAL_CheckpointTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	wal := openTestWAL(t, path)
+	s := NewStoreWithWAL(storage.NewMemStorage(), wal)
+	defer s.Close()
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.0)}))
+
+	err := s.Checkpoint(context.Background(), func([]models.Metrics) error { return errors.New("disk full") })
+	assert.EqualError(t, err, "disk full")
+	assert.NotZero(t, wal.Size(), "failed snapshot must keep the log")
+
+	var snapshot []models.Metrics
+	require.NoError(t, s.Checkpoint(context.Background(), func(m []models.Metrics) error {
+		// изменение во время записи снимка не входит в него и должно остаться в журнале
+		require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(2.0)}))
+		snapshot = m
+		return nil
+	}))
+	assert.Equal(t, []models.Metrics{{ID: "g", MType: models.Gauge, Value: toPtr(1.0)}}, withoutUpdatedAt(snapshot))
+
+	records := 0
+	require.NoError(t, wal.Replay(func([]byte) error {
+		records++
+		return nil
+	}))
+	assert.Equal(t, 1, records)
+}
+
+func TestStoreWithWAL_SameNameDifferentTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	s := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "m", MType: models.Gauge, Value: toPtr(1.0)}))
+	require.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{
+		{ID: "m", MType: models.Counter, Delta: toPtr(int64(2))},
+		{ID: "m", MType: models.Counter, Delta: toPtr(int64(3))},
+	}))
+
+	restored := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+	defer restored.Close()
+	_, err := restored.Replay(context.Background())
+	require.NoError(t, err)
+
+	gauge, err := restored.GetMetric(context.Background(), models.Gauge, "m")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *gauge.Value)
+	counter, err := restored.GetMetric(context.Background(), models.Counter, "m")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *counter.Delta)
+}
+
+func TestStoreWithWAL_DeleteExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	s := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+	require.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{
+		{ID: "old", MType: models.Gauge, Value: toPtr(1.0)},
+		{ID: "kept", MType: models.Gauge, Value: toPtr(2.0)},
+	}))
+	size := s.wal.Size()
+
+	deleted, err := s.DeleteExpired(context.Background(), []models.Expiration{
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "missing"}, Before: time.Now().Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+	assert.Equal(t, size, s.wal.Size(), "nothing deleted - nothing logged")
+
+	deleted, err = s.DeleteExpired(context.Background(), []models.Expiration{
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "old"}, Before: time.Now().Add(time.Hour)},
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "kept"}, Before: time.Now().Add(-time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "old", deleted[0].ID)
+
+	// снимок, записанный до удаления, еще содержит метрику: журнал должен ее удалить
+	mem := storage.NewMemStorage()
+	require.NoError(t, mem.UpdateMetric(context.Background(), models.Metrics{ID: "old", MType: models.Gauge, Value: toPtr(1.0)}))
+	restored := NewStoreWithWAL(mem, openTestWAL(t, path))
+	defer restored.Close()
+	records, err := restored.Replay(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, records)
+
+	metrics, err := restored.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []models.MetricKey{{MType: models.Gauge, ID: "kept"}}, keysOf(metrics))
+}
+
+func TestStoreWithWAL_ReplayKeepsUpdateTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	s := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.0)}))
+	logged, err := s.GetMetric(context.Background(), models.Gauge, "g")
+	require.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+	restored := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+	defer restored.Close()
+	_, err = restored.Replay(context.Background())
+	require.NoError(t, err)
+
+	got, err := restored.GetMetric(context.Background(), models.Gauge, "g")
+	require.NoError(t, err)
+	assert.WithinDuration(t, *logged.UpdatedAt, *got.UpdatedAt, 5*time.Millisecond)
+}
+
+func keysOf(metrics map[models.MetricKey]*models.Metrics) []models.MetricKey {
+	keys := make([]models.MetricKey, 0, len(metrics))
+	for k := range metrics {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestStoreWithAsyncFile_WithWAL(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "metrics.json")
+	wal := openTestWAL(t, filepath.Join(dir, "metrics.wal"))
+	writer, err := fileworker.NewSnapshotWriter(file, 0)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := NewStoreWithAsyncFile(ctx, NewStoreWithWAL(storage.NewMemStorage(), wal), time.Hour, writer)
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}))
+	assert.NotZero(t, wal.Size())
+
+	// финальный снимок при остановке очищает и закрывает журнал
+	cancel()
+	require.Eventually(t, func() bool {
+		return errors.Is(wal.Sync(), os.ErrClosed)
+	}, time.Second, 10*time.Millisecond)
+	assert.Zero(t, wal.Size())
+}
+
+func TestStoreWithAsyncFile_WithWAL_CheckpointAfterDeletingAll(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "metrics.json")
+	walPath := filepath.Join(dir, "metrics.wal")
+	wal := openTestWAL(t, walPath)
+	writer, err := fileworker.NewSnapshotWriter(file, 0)
+	require.NoError(t, err)
+
+	// снимки пишутся вручную: фоновая запись при остановке гонялась бы с перезапуском ниже
+	s := &StoreWithAsyncFile{Storage: NewStoreWithWAL(storage.NewMemStorage(), wal), writer: writer, interval: time.Hour}
+	require.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.0)}))
+	require.NoError(t, s.flushToFile())
+
+	deleted, err := s.DeleteExpired(ctx, []models.Expiration{
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "g"}, Before: time.Now().Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.NoError(t, s.flushToFile())
+	assert.Zero(t, wal.Size())
+	require.NoError(t, writer.Close())
+	require.NoError(t, wal.Close())
+
+	// после перезапуска удаленная метрика не возвращается
+	mem := storage.NewMemStorage()
+	require.NoError(t, service.LoadMetrics(file, mem))
+	restored := NewStoreWithWAL(mem, openTestWAL(t, walPath))
+	defer restored.Close()
+	_, err = restored.Replay(ctx)
+	require.NoError(t, err)
+	metrics, err := restored.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+func TestStoreWithWAL_NoUnloggedWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.wal")
+	s := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+
+	// методы MemStorage, меняющие память в обход журнала, недоступны
+	assert.NotImplements(t, (*interface {
+		Restore(ctx context.Context, values []models.Metrics) error
+	})(nil), s)
+	assert.NotImplements(t, (*interface {
+		Delete(keys ...models.MetricKey)
+	})(nil), s)
+	assert.NotImplements(t, (*interface {
+		GetAndClear() map[models.MetricKey]*models.Metrics
+	})(nil), s)
+
+	// поэтому загрузка снимка в хранилище с журналом тоже попадает в журнал
+	file := filepath.Join(dir, "metrics.json")
+	require.NoError(t, os.WriteFile(file, []byte(`[{"id":"g","type":"gauge","value":2.5}]`), 0o600))
+	require.NoError(t, service.LoadMetrics(file, s))
+	require.NoError(t, s.Close())
+
+	restored := NewStoreWithWAL(storage.NewMemStorage(), openTestWAL(t, path))
+	defer restored.Close()
+	_, err := restored.Replay(context.Background())
+	require.NoError(t, err)
+	m, err := restored.GetMetric(context.Background(), models.Gauge, "g")
+	require.NoError(t, err)
+	require.NotNil(t, m)
+	assert.Equal(t, 2.5, *m.Value)
+}
@@ -2,99 +2,248 @@ package storage
 
 import (
 	"context"
-	"fmt"
 	"sync"
+	"time"
 
 	models "github.com/ValentinaKh/go-metrics/internal/model"
 )
 
-// MemStorage is a simple in-memory storage for metrics
+// DefaultShards - число шардов MemStorage по умолчанию
+const DefaultShards = 32
+
+// MemStorage is a simple in-memory storage for metrics.
+//
+// Метрика определяется парой (тип, имя): gauge и counter с одним именем хранятся независимо.
+// Метрики разложены по шардам по хешу имени, у каждого шарда своя RWMutex, поэтому запись в разные
+// шарды и чтение не блокируют друг друга целиком. Пакет UpdateMetrics применяется к каждому шарду
+// атомарно, но конкурентное чтение может увидеть пакет, примененный не ко всем шардам.
+//
+// Метрики, возвращаемые GetAllMetrics, GetMetric, GetMetrics и GetAndClear, - неизменяемые снимки:
+// последующие обновления их не затрагивают. Вызывающий не должен их изменять.
+//
+// Каждое обновление проставляет метрике UpdatedAt, по которому DeleteExpired удаляет устаревшие метрики.
 type MemStorage struct {
-	mutex   sync.Mutex
-	storage map[string]*models.Metrics
+	shards []*shard
+	now    func() time.Time
+}
+
+type shard struct {
+	mutex   sync.RWMutex
+	storage map[models.MetricKey]*models.Metrics
 }
 
 func NewMemStorage() *MemStorage {
-	return &MemStorage{
-		mutex:   sync.Mutex{},
-		storage: make(map[string]*models.Metrics),
+	return NewShardedMemStorage(DefaultShards)
+}
+
+// NewShardedMemStorage создает хранилище из n шардов, n < 1 считается за 1
+func NewShardedMemStorage(n int) *MemStorage {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{storage: make(map[models.MetricKey]*models.Metrics)}
+	}
+	return &MemStorage{shards: shards, now: time.Now}
+}
+
+// shardIndex - FNV-1a от имени метрики по модулю числа шардов
+func (s *MemStorage) shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
 	}
+	return int(h % uint32(len(s.shards)))
 }
 
 func (s *MemStorage) UpdateMetric(_ context.Context, value models.Metrics) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	sh := s.shards[s.shardIndex(value.ID)]
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+	return sh.update(value, s.now())
+}
 
-	key := value.ID
-	metric, ok := s.storage[key]
-	if !ok {
-		s.storage[key] = &value
-	} else {
-		if metric.MType != value.MType {
-			return fmt.Errorf("incorrect type")
-		}
+func (s *MemStorage) UpdateMetrics(_ context.Context, values []models.Metrics) error {
+	now := s.now()
+	if len(s.shards) == 1 {
+		return s.shards[0].updateAll(values, now)
+	}
 
-		switch value.MType {
-		case models.Counter:
-			metric.Delta = addIntPtr(metric.Delta, value.Delta)
-		case models.Gauge:
-			metric.Value = value.Value
+	// метрики группируются по шардам с сохранением порядка, чтобы брать каждую блокировку один раз
+	groups := make(map[int][]models.Metrics)
+	var order []int
+	for _, value := range values {
+		i := s.shardIndex(value.ID)
+		if _, ok := groups[i]; !ok {
+			order = append(order, i)
+		}
+		groups[i] = append(groups[i], value)
+	}
+	for _, i := range order {
+		if err := s.shards[i].updateAll(groups[i], now); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (s *MemStorage) GetAndClear() map[string]*models.Metrics {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	copyMap := make(map[string]*models.Metrics)
-	for k, v := range s.storage {
-		copyMap[k] = v
+func (s *MemStorage) GetAndClear() map[models.MetricKey]*models.Metrics {
+	copyMap := make(map[models.MetricKey]*models.Metrics)
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+		for k, v := range sh.storage {
+			copyMap[k] = v
+		}
+		clear(sh.storage)
+		sh.mutex.Unlock()
 	}
-	clear(s.storage)
 	return copyMap
 }
 
-func (s *MemStorage) GetAllMetrics(_ context.Context) (map[string]*models.Metrics, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	copyMap := make(map[string]*models.Metrics)
-	for k, v := range s.storage {
-		copyMap[k] = v
+func (s *MemStorage) GetAllMetrics(_ context.Context) (map[models.MetricKey]*models.Metrics, error) {
+	copyMap := make(map[models.MetricKey]*models.Metrics)
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		for k, v := range sh.storage {
+			copyMap[k] = v
+		}
+		sh.mutex.RUnlock()
 	}
 	return copyMap, nil
 }
 
-func addIntPtr(a, b *int64) *int64 {
-	va := int64(0)
-	if a != nil {
-		va = *a
+// GetMetric возвращает метрику по типу и имени или nil, если такой метрики нет
+func (s *MemStorage) GetMetric(_ context.Context, mType, id string) (*models.Metrics, error) {
+	sh := s.shards[s.shardIndex(id)]
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+	return sh.get(mType, id), nil
+}
+
+// GetMetrics возвращает найденные по ключам метрики, отсутствующие пропускаются
+func (s *MemStorage) GetMetrics(_ context.Context, keys []models.MetricKey) (map[models.MetricKey]*models.Metrics, error) {
+	result := make(map[models.MetricKey]*models.Metrics, len(keys))
+	for _, key := range keys {
+		sh := s.shards[s.shardIndex(key.ID)]
+		sh.mutex.RLock()
+		if m := sh.get(key.MType, key.ID); m != nil {
+			result[key] = m
+		}
+		sh.mutex.RUnlock()
 	}
-	res := va + *b
-	return &res
+	return result, nil
 }
 
-func (s *MemStorage) UpdateMetrics(_ context.Context, values []models.Metrics) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// Restore кладет метрики в хранилище как есть, заменяя сохраненные: значения счетчиков не суммируются,
+// время обновления сохраняется. Используется при восстановлении из снимка и журнала. Метрикам без времени
+// обновления проставляется текущее.
+func (s *MemStorage) Restore(_ context.Context, values []models.Metrics) error {
+	now := s.now()
+	for i := range values {
+		m := cloneMetric(&values[i])
+		if m.UpdatedAt == nil {
+			m.UpdatedAt = &now
+		}
+		sh := s.shards[s.shardIndex(m.ID)]
+		sh.mutex.Lock()
+		sh.storage[m.Key()] = m
+		sh.mutex.Unlock()
+	}
+	return nil
+}
+
+// Delete удаляет метрики по ключам
+func (s *MemStorage) Delete(keys ...models.MetricKey) {
+	for _, key := range keys {
+		sh := s.shards[s.shardIndex(key.ID)]
+		sh.mutex.Lock()
+		delete(sh.storage, key)
+		sh.mutex.Unlock()
+	}
+}
+
+// DeleteExpired удаляет метрики, не обновлявшиеся с момента Before, и возвращает удаленные.
+// Метрика, обновленная после того, как ее сочли устаревшей, не удаляется.
+func (s *MemStorage) DeleteExpired(_ context.Context, expired []models.Expiration) ([]models.Metrics, error) {
+	var deleted []models.Metrics
+	for _, e := range expired {
+		sh := s.shards[s.shardIndex(e.ID)]
+		sh.mutex.Lock()
+		if m, ok := sh.storage[e.MetricKey]; ok && m.UpdatedAt != nil && m.UpdatedAt.Before(e.Before) {
+			delete(sh.storage, e.MetricKey)
+			deleted = append(deleted, *m)
+		}
+		sh.mutex.Unlock()
+	}
+	return deleted, nil
+}
 
+// get ищет метрику в шарде, вызывается под блокировкой шарда
+func (sh *shard) get(mType, id string) *models.Metrics {
+	return sh.storage[models.MetricKey{MType: mType, ID: id}]
+}
+
+func (sh *shard) updateAll(values []models.Metrics, now time.Time) error {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
 	for _, value := range values {
-		key := value.ID
-		metric, ok := s.storage[key]
-		if !ok {
-			s.storage[key] = &value
-		} else {
-			if metric.MType != value.MType {
-				return fmt.Errorf("incorrect type")
-			}
-
-			switch value.MType {
-			case models.Counter:
-				metric.Delta = addIntPtr(metric.Delta, value.Delta)
-			case models.Gauge:
-				metric.Value = value.Value
-			}
+		if err := sh.update(value, now); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// update применяет значение к шарду, вызывается под блокировкой шарда. Сохраненная метрика никогда
+// не меняется на месте: вместо этого в шард кладется новая копия (copy-on-write).
+func (sh *shard) update(value models.Metrics, now time.Time) error {
+	key := value.Key()
+	metric, ok := sh.storage[key]
+	if !ok {
+		next := cloneMetric(&value)
+		next.UpdatedAt = &now
+		sh.storage[key] = next
+		return nil
+	}
+
+	next := *metric
+	switch value.MType {
+	case models.Counter:
+		next.Delta = addIntPtr(metric.Delta, value.Delta)
+	case models.Gauge:
+		next.Value = clonePtr(value.Value)
+	}
+	next.UpdatedAt = &now
+	sh.storage[key] = &next
+	return nil
+}
+
+// cloneMetric копирует метрику вместе со значениями, на которые указывают Delta и Value
+func cloneMetric(m *models.Metrics) *models.Metrics {
+	c := *m
+	c.Delta = clonePtr(m.Delta)
+	c.Value = clonePtr(m.Value)
+	c.UpdatedAt = clonePtr(m.UpdatedAt)
+	// агрегаты считаются при чтении и в хранилище не попадают
+	c.Aggregates = nil
+	return &c
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func addIntPtr(a, b *int64) *int64 {
+	va := int64(0)
+	if a != nil {
+		va = *a
+	}
+	res := va + *b
+	return &res
+}
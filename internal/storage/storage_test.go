@@ -2,9 +2,11 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"github.com/stretchr/testify/require"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -13,34 +15,34 @@ import (
 
 func Test_memStorage_GetAndClear(t *testing.T) {
 	type fields struct {
-		storage map[string]*models.Metrics
+		storage map[models.MetricKey]*models.Metrics
 	}
 	tests := []struct {
 		name   string
 		fields fields
-		want   map[string]*models.Metrics
+		want   map[models.MetricKey]*models.Metrics
 	}{
 		{
 			name: "Clear",
-			fields: fields{storage: map[string]*models.Metrics{
-				"counter1": {
+			fields: fields{storage: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
 				},
 			}},
-			want: map[string]*models.Metrics{
-				"counter1": {
+			want: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -48,25 +50,22 @@ func Test_memStorage_GetAndClear(t *testing.T) {
 			},
 		}, {
 			name:   "empty map",
-			fields: fields{storage: map[string]*models.Metrics{}},
-			want:   map[string]*models.Metrics{},
+			fields: fields{storage: map[models.MetricKey]*models.Metrics{}},
+			want:   map[models.MetricKey]*models.Metrics{},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &MemStorage{
-				mutex:   sync.Mutex{},
-				storage: tt.fields.storage,
-			}
+			s := newMemStorageFrom(tt.fields.storage)
 			assert.Equal(t, tt.want, s.GetAndClear())
-			assert.Empty(t, s.storage)
+			assert.Empty(t, s.all())
 		})
 	}
 }
 
 func Test_memStorage_UpdateMetric(t *testing.T) {
 	type fields struct {
-		storage map[string]*models.Metrics
+		storage map[models.MetricKey]*models.Metrics
 	}
 	type args struct {
 		key   string
@@ -77,17 +76,17 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 		fields  fields
 		args    args
 		wantErr bool
-		want    map[string]*models.Metrics
+		want    map[models.MetricKey]*models.Metrics
 	}{
 		{
 			name: "Add counter1",
-			fields: fields{storage: map[string]*models.Metrics{
-				"counter1": {
+			fields: fields{storage: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -102,13 +101,13 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 				},
 			},
 			wantErr: false,
-			want: map[string]*models.Metrics{
-				"counter1": {
+			want: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(100)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -117,8 +116,8 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 		},
 		{
 			name: "Add gauge1",
-			fields: fields{storage: map[string]*models.Metrics{
-				"gauge1": {
+			fields: fields{storage: map[models.MetricKey]*models.Metrics{
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -133,8 +132,8 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 				},
 			},
 			wantErr: false,
-			want: map[string]*models.Metrics{
-				"gauge1": {
+			want: map[models.MetricKey]*models.Metrics{
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(58.5),
@@ -143,13 +142,13 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 		},
 		{
 			name: "Add new counter2",
-			fields: fields{storage: map[string]*models.Metrics{
-				"counter1": {
+			fields: fields{storage: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -164,18 +163,18 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 				},
 			},
 			wantErr: false,
-			want: map[string]*models.Metrics{
-				"counter1": {
+			want: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"counter2": {
+				{MType: models.Counter, ID: "counter2"}: {
 					ID:    "counter2",
 					MType: models.Counter,
 					Delta: toPtr(int64(25)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -183,14 +182,14 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 			},
 		},
 		{
-			name: "wrong type",
-			fields: fields{storage: map[string]*models.Metrics{
-				"counter1": {
+			name: "same name, other type",
+			fields: fields{storage: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -201,17 +200,22 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 				value: models.Metrics{
 					ID:    "counter1",
 					MType: models.Gauge,
-					Delta: toPtr(int64(25)),
+					Value: toPtr(2.5),
 				},
 			},
-			wantErr: true,
-			want: map[string]*models.Metrics{
-				"counter1": {
+			wantErr: false,
+			want: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "counter1"}: {
+					ID:    "counter1",
+					MType: models.Gauge,
+					Value: toPtr(2.5),
+				},
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -221,13 +225,10 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &MemStorage{
-				mutex:   sync.Mutex{},
-				storage: tt.fields.storage,
-			}
+			s := newMemStorageFrom(tt.fields.storage)
 			err := s.UpdateMetric(context.TODO(), tt.args.value)
 			assert.Equal(t, tt.wantErr, err != nil)
-			assert.Equal(t, tt.want, s.storage)
+			assert.Equal(t, tt.want, withoutUpdatedAt(s.all()))
 
 		})
 	}
@@ -235,34 +236,34 @@ func Test_memStorage_UpdateMetric(t *testing.T) {
 
 func Test_memStorage_GetAllMetrics(t *testing.T) {
 	type fields struct {
-		storage map[string]*models.Metrics
+		storage map[models.MetricKey]*models.Metrics
 	}
 	tests := []struct {
 		name   string
 		fields fields
-		want   map[string]*models.Metrics
+		want   map[models.MetricKey]*models.Metrics
 	}{
 		{
 			name: "not empty",
-			fields: fields{storage: map[string]*models.Metrics{
-				"counter1": {
+			fields: fields{storage: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
 				},
 			}},
-			want: map[string]*models.Metrics{
-				"counter1": {
+			want: map[models.MetricKey]*models.Metrics{
+				{MType: models.Counter, ID: "counter1"}: {
 					ID:    "counter1",
 					MType: models.Counter,
 					Delta: toPtr(int64(42)),
 				},
-				"gauge1": {
+				{MType: models.Gauge, ID: "gauge1"}: {
 					ID:    "gauge1",
 					MType: models.Gauge,
 					Value: toPtr(3.14),
@@ -270,16 +271,13 @@ func Test_memStorage_GetAllMetrics(t *testing.T) {
 			},
 		}, {
 			name:   "empty map",
-			fields: fields{storage: map[string]*models.Metrics{}},
-			want:   map[string]*models.Metrics{},
+			fields: fields{storage: map[models.MetricKey]*models.Metrics{}},
+			want:   map[models.MetricKey]*models.Metrics{},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &MemStorage{
-				mutex:   sync.Mutex{},
-				storage: tt.fields.storage,
-			}
+			s := newMemStorageFrom(tt.fields.storage)
 			metrics, err := s.GetAllMetrics(context.TODO())
 			assert.Nil(t, err)
 			assert.Equal(t, tt.want, metrics)
@@ -302,7 +300,7 @@ func TestMemStorage_UpdateMetrics(t *testing.T) {
 				{ID: "NewGauge", MType: models.Gauge, Value: float64Ptr(42.5)},
 			},
 			assertions: func(t *testing.T, s *MemStorage) {
-				metric := s.storage["NewGauge"]
+				metric := s.all()[models.MetricKey{MType: models.Gauge, ID: "NewGauge"}]
 				assert.Equal(t, models.Gauge, metric.MType)
 				assert.Equal(t, float64Ptr(42.5), metric.Value)
 			},
@@ -313,7 +311,7 @@ func TestMemStorage_UpdateMetrics(t *testing.T) {
 				{ID: "NewCounter", MType: models.Counter, Delta: int64Ptr(100)},
 			},
 			assertions: func(t *testing.T, s *MemStorage) {
-				metric := s.storage["NewCounter"]
+				metric := s.all()[models.MetricKey{MType: models.Counter, ID: "NewCounter"}]
 				assert.Equal(t, models.Counter, metric.MType)
 				assert.Equal(t, int64Ptr(100), metric.Delta)
 			},
@@ -324,7 +322,7 @@ func TestMemStorage_UpdateMetrics(t *testing.T) {
 				{ID: "ExistingGauge", MType: models.Gauge, Value: float64Ptr(20.0)},
 			},
 			assertions: func(t *testing.T, s *MemStorage) {
-				metric := s.storage["ExistingGauge"]
+				metric := s.all()[models.MetricKey{MType: models.Gauge, ID: "ExistingGauge"}]
 				assert.Equal(t, float64Ptr(20.0), metric.Value)
 			},
 		},
@@ -334,7 +332,7 @@ func TestMemStorage_UpdateMetrics(t *testing.T) {
 				{ID: "AccCounter", MType: models.Counter, Delta: int64Ptr(3)},
 			},
 			assertions: func(t *testing.T, s *MemStorage) {
-				metric := s.storage["AccCounter"]
+				metric := s.all()[models.MetricKey{MType: models.Counter, ID: "AccCounter"}]
 				assert.Equal(t, int64Ptr(3), metric.Delta)
 			},
 		},
@@ -348,16 +346,16 @@ func TestMemStorage_UpdateMetrics(t *testing.T) {
 			},
 			assertions: func(t *testing.T, s *MemStorage) {
 
-				metric := s.storage["G1"]
+				metric := s.all()[models.MetricKey{MType: models.Gauge, ID: "G1"}]
 				assert.Equal(t, float64Ptr(200), metric.Value)
 
-				metric = s.storage["C1"]
+				metric = s.all()[models.MetricKey{MType: models.Counter, ID: "C1"}]
 				assert.Equal(t, int64Ptr(5), metric.Delta)
 
-				metric = s.storage["G2"]
+				metric = s.all()[models.MetricKey{MType: models.Gauge, ID: "G2"}]
 				assert.Equal(t, float64Ptr(300), metric.Value)
 
-				metric = s.storage["C2"]
+				metric = s.all()[models.MetricKey{MType: models.Counter, ID: "C2"}]
 				assert.Equal(t, int64Ptr(1), metric.Delta)
 			},
 		},
@@ -375,6 +373,347 @@ func TestMemStorage_UpdateMetrics(t *testing.T) {
 	}
 }
 
+func TestMemStorage_Sharded(t *testing.T) {
+	for _, shards := range []int{0, 1, 7, DefaultShards} {
+		t.Run(fmt.Sprintf("shards=%d", shards), func(t *testing.T) {
+			s := NewShardedMemStorage(shards)
+
+			const writers, perWriter = 8, 200
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < perWriter; i++ {
+						assert.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{
+							{ID: "total", MType: models.Counter, Delta: toPtr(int64(1))},
+							{ID: fmt.Sprintf("g%d", i%50), MType: models.Gauge, Value: toPtr(float64(i))},
+						}))
+						_, err := s.GetAllMetrics(context.Background())
+						assert.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			metrics, err := s.GetAllMetrics(context.Background())
+			require.NoError(t, err)
+			assert.Len(t, metrics, 51)
+			assert.Equal(t, int64(writers*perWriter), *metrics[models.MetricKey{MType: models.Counter, ID: "total"}].Delta)
+
+			assert.Len(t, s.GetAndClear(), 51)
+			metrics, err = s.GetAllMetrics(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, metrics)
+		})
+	}
+}
+
+func TestMemStorage_SameNameDifferentTypes(t *testing.T) {
+	s := NewMemStorage()
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "m", MType: models.Gauge, Value: toPtr(1.0)}))
+	require.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{
+		{ID: "m", MType: models.Counter, Delta: toPtr(int64(1))},
+		{ID: "m", MType: models.Counter, Delta: toPtr(int64(2))},
+		{ID: "m", MType: models.Gauge, Value: toPtr(2.0)},
+	}))
+
+	assert.Equal(t, map[models.MetricKey]*models.Metrics{
+		{MType: models.Gauge, ID: "m"}:   {ID: "m", MType: models.Gauge, Value: toPtr(2.0)},
+		{MType: models.Counter, ID: "m"}: {ID: "m", MType: models.Counter, Delta: toPtr(int64(3))},
+	}, withoutUpdatedAt(s.all()))
+}
+
+func TestMemStorage_GetMetric(t *testing.T) {
+	s := newMemStorageFrom(map[models.MetricKey]*models.Metrics{
+		{MType: models.Counter, ID: "c"}: {ID: "c", MType: models.Counter, Delta: toPtr(int64(5))},
+		{MType: models.Gauge, ID: "g"}:   {ID: "g", MType: models.Gauge, Value: toPtr(1.5)},
+	})
+	tests := []struct {
+		name  string
+		mType string
+		id    string
+		want  *models.Metrics
+	}{
+		{name: "counter", mType: models.Counter, id: "c", want: &models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))}},
+		{name: "gauge", mType: models.Gauge, id: "g", want: &models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.5)}},
+		{name: "wrong type", mType: models.Gauge, id: "c"},
+		{name: "missing", mType: models.Gauge, id: "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetMetric(context.Background(), tt.mType, tt.id)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	got, err := s.GetMetrics(context.Background(), []models.MetricKey{
+		{MType: models.Counter, ID: "c"},
+		{MType: models.Counter, ID: "g"},
+		{MType: models.Gauge, ID: "x"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[models.MetricKey]*models.Metrics{{MType: models.Counter, ID: "c"}: {ID: "c", MType: models.Counter, Delta: toPtr(int64(5))}}, got)
+}
+
+func TestMemStorage_SnapshotsAreImmutable(t *testing.T) {
+	s := NewMemStorage()
+	delta := int64(1)
+	value := 1.0
+	require.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: &delta},
+		{ID: "g", MType: models.Gauge, Value: &value},
+	}))
+	// изменение переданных значений не влияет на хранилище
+	delta, value = 100, 100
+
+	before, err := s.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	c, err := s.GetMetric(context.Background(), models.Counter, "c")
+	require.NoError(t, err)
+
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(2))}))
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(2.0)}))
+
+	assert.Equal(t, int64(1), *before[models.MetricKey{MType: models.Counter, ID: "c"}].Delta)
+	assert.Equal(t, 1.0, *before[models.MetricKey{MType: models.Gauge, ID: "g"}].Value)
+	assert.Equal(t, int64(1), *c.Delta)
+
+	after, err := s.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *after[models.MetricKey{MType: models.Counter, ID: "c"}].Delta)
+	assert.Equal(t, 2.0, *after[models.MetricKey{MType: models.Gauge, ID: "g"}].Value)
+}
+
+// TestMemStorage_ConcurrentUpdateAndRead рассчитан на запуск с -race: читатели разыменовывают
+// полученные метрики, пока писатели их обновляют
+func TestMemStorage_ConcurrentUpdateAndRead(t *testing.T) {
+	s := NewMemStorage()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			var last int64
+			for ctx.Err() == nil {
+				metrics, err := s.GetAllMetrics(ctx)
+				assert.NoError(t, err)
+				if m, ok := metrics[models.MetricKey{MType: models.Counter, ID: "c"}]; ok {
+					// счетчик только растет, снимок не может быть старше предыдущего
+					assert.GreaterOrEqual(t, *m.Delta, last)
+					last = *m.Delta
+				}
+				if m, ok := metrics[models.MetricKey{MType: models.Gauge, ID: "g"}]; ok {
+					_ = *m.Value
+				}
+				if m, _ := s.GetMetric(ctx, models.Counter, "c"); m != nil {
+					_ = *m.Delta
+				}
+			}
+		}()
+	}
+
+	const writers, perWriter = 4, 500
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				assert.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}))
+				assert.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(float64(i))}))
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	readers.Wait()
+
+	c, err := s.GetMetric(context.Background(), models.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(writers*perWriter), *c.Delta)
+}
+
+// benchMetrics - набор имен, похожий на метрики агента
+func benchMetrics(n int) []models.Metrics {
+	metrics := make([]models.Metrics, n)
+	for i := range metrics {
+		if i%2 == 0 {
+			metrics[i] = models.Metrics{ID: fmt.Sprintf("counter%d", i), MType: models.Counter, Delta: toPtr(int64(1))}
+		} else {
+			metrics[i] = models.Metrics{ID: fmt.Sprintf("gauge%d", i), MType: models.Gauge, Value: toPtr(float64(i))}
+		}
+	}
+	return metrics
+}
+
+// BenchmarkMemStorage_ParallelWrite сравнивает одну блокировку (shards=1) с шардированием при
+// конкурентной записи одиночных метрик
+func BenchmarkMemStorage_ParallelWrite(b *testing.B) {
+	metrics := benchMetrics(1000)
+	for _, shards := range []int{1, DefaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			s := NewShardedMemStorage(shards)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if err := s.UpdateMetric(context.Background(), metrics[i%len(metrics)]); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMemStorage_WriteWithReaders измеряет запись, пока читатели постоянно копируют хранилище
+// (как GetAllMetrics в обработчиках и flushToFile)
+func BenchmarkMemStorage_WriteWithReaders(b *testing.B) {
+	metrics := benchMetrics(10000)
+	for _, shards := range []int{1, DefaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			s := NewShardedMemStorage(shards)
+			if err := s.UpdateMetrics(context.Background(), metrics); err != nil {
+				b.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			var wg sync.WaitGroup
+			for r := 0; r < 2; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for ctx.Err() == nil {
+						_, _ = s.GetAllMetrics(ctx)
+					}
+				}()
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if err := s.UpdateMetric(context.Background(), metrics[i%len(metrics)]); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+			b.StopTimer()
+			cancel()
+			wg.Wait()
+		})
+	}
+}
+
+func TestMemStorage_UpdatedAt(t *testing.T) {
+	s := NewMemStorage()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}))
+	stale := now.Add(-time.Hour)
+	// время обновления от клиента игнорируется
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "g", MType: models.Gauge, Value: toPtr(1.0), UpdatedAt: &stale}))
+	first, err := s.GetMetric(context.Background(), models.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, now, *first.UpdatedAt)
+	g, err := s.GetMetric(context.Background(), models.Gauge, "g")
+	require.NoError(t, err)
+	assert.Equal(t, now, *g.UpdatedAt)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{{ID: "c", MType: models.Counter, Delta: toPtr(int64(1))}}))
+	second, err := s.GetMetric(context.Background(), models.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, now, *second.UpdatedAt)
+	assert.Equal(t, now.Add(-time.Minute), *first.UpdatedAt, "snapshot is not changed by later updates")
+}
+
+func TestMemStorage_Restore(t *testing.T) {
+	s := NewMemStorage()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "c", MType: models.Counter, Delta: toPtr(int64(5))}))
+
+	saved := now.Add(-time.Hour)
+	require.NoError(t, s.Restore(context.Background(), []models.Metrics{
+		{ID: "c", MType: models.Counter, Delta: toPtr(int64(2)), UpdatedAt: &saved},
+		{ID: "g", MType: models.Gauge, Value: toPtr(1.0)},
+	}))
+
+	assert.Equal(t, map[models.MetricKey]*models.Metrics{
+		{MType: models.Counter, ID: "c"}: {ID: "c", MType: models.Counter, Delta: toPtr(int64(2)), UpdatedAt: &saved},
+		{MType: models.Gauge, ID: "g"}:   {ID: "g", MType: models.Gauge, Value: toPtr(1.0), UpdatedAt: &now},
+	}, s.all())
+}
+
+func TestMemStorage_DeleteExpired(t *testing.T) {
+	s := NewMemStorage()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	require.NoError(t, s.UpdateMetrics(context.Background(), []models.Metrics{
+		{ID: "old", MType: models.Gauge, Value: toPtr(1.0)},
+		{ID: "touched", MType: models.Gauge, Value: toPtr(1.0)},
+		{ID: "old", MType: models.Counter, Delta: toPtr(int64(1))},
+	}))
+	now = now.Add(time.Hour)
+	// метрику обновили после того, как ее сочли устаревшей
+	require.NoError(t, s.UpdateMetric(context.Background(), models.Metrics{ID: "touched", MType: models.Gauge, Value: toPtr(2.0)}))
+
+	deleted, err := s.DeleteExpired(context.Background(), []models.Expiration{
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "old"}, Before: now},
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "touched"}, Before: now},
+		{MetricKey: models.MetricKey{MType: models.Gauge, ID: "missing"}, Before: now},
+	})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, models.MetricKey{MType: models.Gauge, ID: "old"}, deleted[0].Key())
+	assert.Equal(t, map[models.MetricKey]*models.Metrics{
+		{MType: models.Gauge, ID: "touched"}: {ID: "touched", MType: models.Gauge, Value: toPtr(2.0)},
+		{MType: models.Counter, ID: "old"}:   {ID: "old", MType: models.Counter, Delta: toPtr(int64(1))},
+	}, withoutUpdatedAt(s.all()))
+}
+
 func toPtr[T int64 | float64](value T) *T {
 	return &value
 }
+
+// newMemStorageFrom раскладывает готовые метрики по шардам
+func newMemStorageFrom(metrics map[models.MetricKey]*models.Metrics) *MemStorage {
+	s := NewMemStorage()
+	for k, v := range metrics {
+		s.shards[s.shardIndex(k.ID)].storage[k] = v
+	}
+	return s
+}
+
+// withoutUpdatedAt возвращает копии метрик без времени обновления, чтобы сравнивать только значения
+func withoutUpdatedAt(metrics map[models.MetricKey]*models.Metrics) map[models.MetricKey]*models.Metrics {
+	res := make(map[models.MetricKey]*models.Metrics, len(metrics))
+	for k, v := range metrics {
+		c := *v
+		c.UpdatedAt = nil
+		res[k] = &c
+	}
+	return res
+}
+
+// all возвращает содержимое всех шардов
+func (s *MemStorage) all() map[models.MetricKey]*models.Metrics {
+	res := make(map[models.MetricKey]*models.Metrics)
+	for _, sh := range s.shards {
+		for k, v := range sh.storage {
+			res[k] = v
+		}
+	}
+	return res
+}
@@ -3,10 +3,34 @@ package utils
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 )
 
+// TimestampHeader - время подписи запроса между серверами в секундах Unix
+const TimestampHeader = "X-Request-Timestamp"
+
 func Hash(key string, src []byte) []byte {
 	h := hmac.New(sha256.New, []byte(key))
 	h.Write(src)
 	return h.Sum(nil)
 }
+
+// RequestHash - подпись запроса между серверами. Кроме тела она покрывает метод, путь и время подписи,
+// поэтому подписываются и запросы без тела, а перехваченный запрос нельзя отправить на другой адрес.
+func RequestHash(key, method, path string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(key))
+	_, _ = fmt.Fprintf(h, "%s\n%s\n%d\n", method, path, timestamp)
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// SignRequest подписывает запрос между серверами ключом key на момент now
+func SignRequest(rq *http.Request, key string, body []byte, now time.Time) {
+	timestamp := now.Unix()
+	rq.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	rq.Header.Set("HashSHA256", hex.EncodeToString(RequestHash(key, rq.Method, rq.URL.Path, timestamp, body)))
+}
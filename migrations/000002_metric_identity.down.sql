@@ -0,0 +1,9 @@
+-- migrations/000002_metric_identity.down.sql
+-- Возврат уникальности по имени. Из метрик с одинаковым именем остается добавленная последней.
+DELETE FROM metrics m
+USING metrics newer
+WHERE m.name = newer.name AND m.id < newer.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_name ON metrics(name);
+
+DROP INDEX IF EXISTS idx_metrics_name_type;
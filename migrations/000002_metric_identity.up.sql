@@ -0,0 +1,5 @@
+-- migrations/000002_metric_identity.up.sql
+-- Метрика определяется парой (имя, тип): gauge и counter с одним именем хранятся в разных строках
+CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_name_type ON metrics(name, type_metrics);
+
+DROP INDEX IF EXISTS idx_metrics_name;
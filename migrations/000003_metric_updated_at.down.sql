@@ -0,0 +1,4 @@
+-- migrations/000003_metric_updated_at.down.sql
+DROP INDEX IF EXISTS idx_metrics_updated_at;
+
+ALTER TABLE metrics DROP COLUMN IF EXISTS updated_at;
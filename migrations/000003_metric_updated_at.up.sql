@@ -0,0 +1,5 @@
+-- migrations/000003_metric_updated_at.up.sql
+-- Время последнего обновления метрики для удаления устаревших
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS idx_metrics_updated_at ON metrics(updated_at);
@@ -0,0 +1,3 @@
+-- migrations/000004_gauge_windows.down.sql
+-- Удаление окон агрегатов gauge-метрик
+DROP TABLE IF EXISTS gauge_windows;
@@ -0,0 +1,8 @@
+-- migrations/000004_gauge_windows.up.sql
+-- Окна агрегатов gauge-метрик (min/max/sum/count), сохраняемые между перезапусками
+CREATE TABLE IF NOT EXISTS gauge_windows (
+    name TEXT NOT NULL,
+    window_ns BIGINT NOT NULL,
+    buckets JSONB NOT NULL,
+    PRIMARY KEY (name, window_ns)
+);
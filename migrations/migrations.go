@@ -0,0 +1,9 @@
+// Package migrations встраивает SQL-файлы миграций в бинарные файлы сервера и cmd/migrate
+package migrations
+
+import "embed"
+
+// FS - файлы миграций вида 000001_name.up.sql / 000001_name.down.sql
+//
+//go:embed *.sql
+var FS embed.FS